@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// blockRequest is the body accepted when blocking a number. At most one of
+// ExpiresAt (RFC 3339) and ExpiresIn (Go duration, e.g. "72h") may be set.
+type blockRequest struct {
+	PhoneNumber string `json:"phone_number"`
+	Reason      string `json:"reason"`
+	BlockedBy   string `json:"blocked_by"`
+	ExpiresAt   string `json:"expires_at"`
+	ExpiresIn   string `json:"expires_in"`
+}
+
+// isBlocked reports whether a phone number has a blocklist entry that has
+// not expired.
+func (h *handlers) isBlocked(ctx context.Context, phoneNumber string) (bool, error) {
+	return h.Store.BlockList.IsBlocked(ctx, phoneNumber, time.Now())
+}
+
+// blockNumber adds a phone number to the blocklist, replacing any existing
+// entry for it. A nil expiresAt blocks the number indefinitely.
+func (h *handlers) blockNumber(ctx context.Context, phoneNumber string, reason string, blockedBy string, expiresAt *time.Time) (*storage.BlockedNumber, error) {
+	blocked, err := h.Store.BlockList.Upsert(ctx, storage.BlockedNumber{
+		PhoneNumber: phoneNumber,
+		Reason:      reason,
+		BlockedBy:   blockedBy,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to block number: %w", err)
+	}
+
+	h.emitEvent(ctx, EventNumberBlocked, map[string]any{"blocked_number": blocked})
+
+	return blocked, nil
+}
+
+// parsePage reads the page and limit query parameters.
+func parsePage(ginCtx *gin.Context) (page int64, limit int64, err error) {
+	page, limit = 1, defaultPageLimit
+
+	if value := ginCtx.Query("page"); value != "" {
+		page, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+	}
+
+	if value := ginCtx.Query("limit"); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+
+	return page, limit, nil
+}
+
+// ListBlockedNumbers returns a page of blocklist entries, newest first.
+// Expired entries are left out unless include_expired=true.
+func (h *handlers) ListBlockedNumbers() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		page, limit, err := parsePage(ginCtx)
+		if err != nil {
+			apiError(ginCtx, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		includeExpired := ginCtx.Query("include_expired") == "true"
+		items, total, err := h.Store.BlockList.List(timedCtx, includeExpired, time.Now(), (page-1)*limit, limit)
+		if err != nil {
+			log.Printf("Error listing blocklist: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, gin.H{
+			"items": items,
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		})
+	}
+}
+
+// BlockNumber adds or replaces a blocklist entry.
+func (h *handlers) BlockNumber() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		var req blockRequest
+		if err := ginCtx.ShouldBindJSON(&req); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		if !utils.IsValidPhoneNumber(req.PhoneNumber) {
+			apiError(ginCtx, http.StatusBadRequest, "phone_number must be in E.164 format, e.g. +15105550123")
+			return
+		}
+
+		var expiresAt *time.Time
+
+		switch {
+		case req.ExpiresAt != "" && req.ExpiresIn != "":
+			apiError(ginCtx, http.StatusBadRequest, "set only one of expires_at and expires_in")
+			return
+		case req.ExpiresAt != "":
+			parsed, err := time.Parse(time.RFC3339, req.ExpiresAt)
+			if err != nil {
+				apiError(ginCtx, http.StatusBadRequest, "expires_at must be an RFC 3339 time")
+				return
+			}
+			expiresAt = &parsed
+		case req.ExpiresIn != "":
+			duration, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || duration <= 0 {
+				apiError(ginCtx, http.StatusBadRequest, "expires_in must be a positive duration, e.g. 72h")
+				return
+			}
+			parsed := time.Now().Add(duration)
+			expiresAt = &parsed
+		}
+
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			apiError(ginCtx, http.StatusBadRequest, "expiry must be in the future")
+			return
+		}
+
+		blockedBy := req.BlockedBy
+		if blockedBy == "" {
+			blockedBy = "admin-api"
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		blocked, err := h.blockNumber(timedCtx, req.PhoneNumber, req.Reason, blockedBy, expiresAt)
+		if err != nil {
+			log.Printf("Error blocking number: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		log.Printf("Blocked %s by %s", blocked.PhoneNumber, blocked.BlockedBy)
+		ginCtx.JSON(http.StatusCreated, blocked)
+	}
+}
+
+// UnblockNumber removes a phone number from the blocklist.
+func (h *handlers) UnblockNumber() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		phoneNumber := ginCtx.Param("phone_number")
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		deleted, err := h.Store.BlockList.Delete(timedCtx, phoneNumber)
+		if err != nil {
+			log.Printf("Error unblocking number: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !deleted {
+			apiError(ginCtx, http.StatusNotFound, "number is not blocked")
+			return
+		}
+
+		log.Printf("Unblocked %s", phoneNumber)
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBlockNumber(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "indefinite", body: `{"phone_number": "+14155550123", "reason": "spam"}`, wantStatus: http.StatusCreated},
+		{name: "expires in", body: `{"phone_number": "+14155550123", "expires_in": "72h"}`, wantStatus: http.StatusCreated},
+		{name: "expires at", body: `{"phone_number": "+14155550123", "expires_at": "2999-01-01T00:00:00Z"}`, wantStatus: http.StatusCreated},
+		{name: "not E.164", body: `{"phone_number": "415-555-0123"}`, wantStatus: http.StatusBadRequest},
+		{name: "both expiries", body: `{"phone_number": "+14155550123", "expires_in": "1h", "expires_at": "2999-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+		{name: "bad expires_at", body: `{"phone_number": "+14155550123", "expires_at": "tomorrow"}`, wantStatus: http.StatusBadRequest},
+		{name: "negative expires_in", body: `{"phone_number": "+14155550123", "expires_in": "-1h"}`, wantStatus: http.StatusBadRequest},
+		{name: "expiry in the past", body: `{"phone_number": "+14155550123", "expires_at": "2000-01-01T00:00:00Z"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, _ := newTestService(t)
+
+			rec := serveJSON(h.BlockNumber(), http.MethodPost, "/api/blocklist", "/api/blocklist", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			blocked, err := store.BlockList.IsBlocked(context.Background(), "+14155550123", time.Now())
+			if err != nil || blocked != (tt.wantStatus == http.StatusCreated) {
+				t.Errorf("IsBlocked = %v, %v, want %v", blocked, err, tt.wantStatus == http.StatusCreated)
+			}
+		})
+	}
+}
+
+func TestBlockNumberTwiceReplacesEntry(t *testing.T) {
+	h, store, _ := newTestService(t)
+
+	for _, reason := range []string{"spam", "abusive"} {
+		rec := serveJSON(h.BlockNumber(), http.MethodPost, "/api/blocklist", "/api/blocklist", `{"phone_number": "+14155550123", "reason": "`+reason+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201 (body %q)", rec.Code, rec.Body.String())
+		}
+	}
+
+	items, total, err := store.BlockList.List(context.Background(), true, time.Now(), 0, defaultPageLimit)
+	if err != nil || total != 1 || len(items) != 1 {
+		t.Fatalf("List = %+v, %d, %v, want one entry", items, total, err)
+	}
+	if items[0].Reason != "abusive" || items[0].BlockedBy != "admin-api" {
+		t.Errorf("entry = %+v, want the second reason, blocked by admin-api", items[0])
+	}
+}
+
+func TestListBlockedNumbers(t *testing.T) {
+	h, _, _ := newTestService(t)
+	ctx := context.Background()
+	expired := time.Now().Add(-time.Hour)
+	if _, err := h.blockNumber(ctx, "+14155550123", "spam", "admin-api", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.blockNumber(ctx, "+14155550124", "spam", "admin-api", &expired); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantTotal  int64
+	}{
+		{target: "/api/blocklist", wantStatus: http.StatusOK, wantTotal: 1},
+		{target: "/api/blocklist?include_expired=true", wantStatus: http.StatusOK, wantTotal: 2},
+		{target: "/api/blocklist?page=0", wantStatus: http.StatusBadRequest},
+		{target: "/api/blocklist?limit=1000", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serveJSON(h.ListBlockedNumbers(), http.MethodGet, "/api/blocklist", tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var page struct {
+				Total int64 `json:"total"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || page.Total != tt.wantTotal {
+				t.Errorf("total = %d, %v, want %d", page.Total, err, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestUnblockNumber(t *testing.T) {
+	h, store, _ := newTestService(t)
+	if _, err := h.blockNumber(context.Background(), "+14155550123", "spam", "admin-api", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveJSON(h.UnblockNumber(), http.MethodDelete, "/api/blocklist/:phone_number", "/api/blocklist/+14155550123", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204 (body %q)", rec.Code, rec.Body.String())
+	}
+	if blocked, err := store.BlockList.IsBlocked(context.Background(), "+14155550123", time.Now()); err != nil || blocked {
+		t.Errorf("IsBlocked = %v, %v, want the number unblocked", blocked, err)
+	}
+
+	rec = serveJSON(h.UnblockNumber(), http.MethodDelete, "/api/blocklist/:phone_number", "/api/blocklist/+14155550123", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second unblock status = %d, want 404 (body %q)", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEscalationPolicy returns the escalation policy.
+func (h *handlers) GetEscalationPolicy() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		policy, err := h.getEscalationPolicy(timedCtx)
+		if err != nil {
+			log.Printf("Error finding escalation policy: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if policy == nil {
+			apiError(ginCtx, http.StatusNotFound, "no escalation policy is configured")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, policy)
+	}
+}
+
+// UpdateEscalationPolicy replaces the escalation policy.
+func (h *handlers) UpdateEscalationPolicy() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		var policy storage.EscalationPolicy
+		if err := ginCtx.ShouldBindJSON(&policy); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		if err := validateEscalationPolicy(policy); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		problem, err := h.checkEscalationStaff(timedCtx, policy)
+		if err != nil {
+			log.Printf("Error finding staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if problem != "" {
+			apiError(ginCtx, http.StatusBadRequest, problem)
+			return
+		}
+
+		policy.Name = storage.DefaultEscalationPolicy
+		policy.UpdatedAt = time.Now()
+
+		saved, err := h.Store.Escalation.Save(timedCtx, policy)
+		if err != nil {
+			log.Printf("Error saving escalation policy: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		log.Printf("Updated escalation policy with %d tiers", len(saved.Tiers))
+		ginCtx.JSON(http.StatusOK, saved)
+	}
+}
+
+// DeleteEscalationPolicy removes the escalation policy, so calls and texts
+// go to every on-call member at once again.
+func (h *handlers) DeleteEscalationPolicy() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		deleted, err := h.Store.Escalation.Delete(timedCtx)
+		if err != nil {
+			log.Printf("Error deleting escalation policy: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !deleted {
+			apiError(ginCtx, http.StatusNotFound, "no escalation policy is configured")
+			return
+		}
+
+		log.Println("Deleted escalation policy")
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// checkEscalationStaff checks that every staff ID in the policy exists. It
+// returns a description of the first unknown ID.
+func (h *handlers) checkEscalationStaff(ctx context.Context, policy storage.EscalationPolicy) (string, error) {
+	for i, tier := range policy.Tiers {
+		for _, id := range tier.StaffIDs {
+			staff, err := h.Store.Staff.FindByPublicID(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			if staff == nil {
+				return fmt.Sprintf("tiers[%d].staff_ids: staff member %q not found", i, id), nil
+			}
+		}
+	}
+	return "", nil
+}
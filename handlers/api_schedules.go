@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// bindSchedule reads and validates a schedule from the request body. It
+// writes an error response and returns false when the schedule is invalid.
+func (h *handlers) bindSchedule(ctx context.Context, ginCtx *gin.Context) (storage.Schedule, bool) {
+	var schedule storage.Schedule
+	if err := ginCtx.ShouldBindJSON(&schedule); err != nil {
+		apiError(ginCtx, http.StatusBadRequest, "invalid JSON body")
+		return storage.Schedule{}, false
+	}
+
+	if err := validateSchedule(schedule); err != nil {
+		apiError(ginCtx, http.StatusBadRequest, err.Error())
+		return storage.Schedule{}, false
+	}
+
+	known, err := h.Store.Staff.PhoneNumberTaken(ctx, schedule.PhoneNumber, bson.ObjectID{})
+	if err != nil {
+		log.Printf("Error checking staff phone number: %v", err)
+		apiError(ginCtx, http.StatusInternalServerError, "server error")
+		return storage.Schedule{}, false
+	}
+	if !known {
+		apiError(ginCtx, http.StatusBadRequest, "phone_number does not belong to a staff member")
+		return storage.Schedule{}, false
+	}
+
+	return schedule, true
+}
+
+// ListSchedules returns every schedule entry, optionally only those for one
+// phone_number.
+func (h *handlers) ListSchedules() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		schedules, err := h.Store.Schedules.List(timedCtx, ginCtx.Query("phone_number"))
+		if err != nil {
+			log.Printf("Error listing schedules: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, schedules)
+	}
+}
+
+// GetSchedule returns one schedule entry by ID.
+func (h *handlers) GetSchedule() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		id, err := bson.ObjectIDFromHex(ginCtx.Param("id"))
+		if err != nil {
+			apiError(ginCtx, http.StatusNotFound, "schedule not found")
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		schedule, err := h.Store.Schedules.FindByID(timedCtx, id)
+		if err != nil {
+			log.Printf("Error finding schedule: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if schedule == nil {
+			apiError(ginCtx, http.StatusNotFound, "schedule not found")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, schedule)
+	}
+}
+
+// CreateSchedule adds a schedule entry.
+func (h *handlers) CreateSchedule() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		schedule, ok := h.bindSchedule(timedCtx, ginCtx)
+		if !ok {
+			return
+		}
+
+		schedule.ID = bson.NewObjectID()
+		if err := h.Store.Schedules.Insert(timedCtx, schedule); err != nil {
+			log.Printf("Error creating schedule: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		ginCtx.JSON(http.StatusCreated, schedule)
+	}
+}
+
+// UpdateSchedule replaces a schedule entry.
+func (h *handlers) UpdateSchedule() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		id, err := bson.ObjectIDFromHex(ginCtx.Param("id"))
+		if err != nil {
+			apiError(ginCtx, http.StatusNotFound, "schedule not found")
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		schedule, ok := h.bindSchedule(timedCtx, ginCtx)
+		if !ok {
+			return
+		}
+
+		schedule.ID = id
+		found, err := h.Store.Schedules.Replace(timedCtx, schedule)
+		if err != nil {
+			log.Printf("Error updating schedule: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !found {
+			apiError(ginCtx, http.StatusNotFound, "schedule not found")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, schedule)
+	}
+}
+
+// DeleteSchedule removes a schedule entry.
+func (h *handlers) DeleteSchedule() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		id, err := bson.ObjectIDFromHex(ginCtx.Param("id"))
+		if err != nil {
+			apiError(ginCtx, http.StatusNotFound, "schedule not found")
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		deleted, err := h.Store.Schedules.Delete(timedCtx, id)
+		if err != nil {
+			log.Printf("Error deleting schedule: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !deleted {
+			apiError(ginCtx, http.StatusNotFound, "schedule not found")
+			return
+		}
+
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// OnCallPreview returns who would be contacted at the time given by the at
+// query parameter (RFC 3339), or now if it is left out.
+func (h *handlers) OnCallPreview() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		at := h.now()
+		if value := ginCtx.Query("at"); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				apiError(ginCtx, http.StatusBadRequest, "at must be an RFC 3339 time")
+				return
+			}
+			at = parsed.In(h.location())
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		staff, fallback, err := h.getOnCallStaffAt(timedCtx, at)
+		if err != nil {
+			log.Printf("Error computing on-call staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		phoneNumbers := phoneNumbersOf(staff)
+		if phoneNumbers == nil {
+			phoneNumbers = []string{}
+		}
+
+		ginCtx.JSON(http.StatusOK, gin.H{
+			"at":            at.Format(time.RFC3339),
+			"phone_numbers": phoneNumbers,
+			"fallback":      fallback,
+		})
+	}
+}
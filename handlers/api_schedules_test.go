@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// mondayShift is a recurring Monday 09:00-17:00 schedule entry body.
+const mondayShift = `{"phone_number": "+15105550101", "start_time": "09:00", "end_time": "17:00", "day_of_week": 1, "recurring": true}`
+
+func TestCreateSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "created", body: mondayShift, wantStatus: http.StatusCreated},
+		{name: "always", body: `{"phone_number": "+15105550101", "always": true}`, wantStatus: http.StatusCreated},
+		{name: "unknown staff member", body: `{"phone_number": "+15105550109", "always": true}`, wantStatus: http.StatusBadRequest},
+		{name: "not E.164", body: `{"phone_number": "5105550101", "always": true}`, wantStatus: http.StatusBadRequest},
+		{name: "bad start time", body: `{"phone_number": "+15105550101", "start_time": "9am", "end_time": "17:00", "day_of_week": 1, "recurring": true}`, wantStatus: http.StatusBadRequest},
+		{name: "bad time zone", body: `{"phone_number": "+15105550101", "always": true, "timezone": "Mars/Olympus"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, _ := newTestService(t)
+			addStaff(t, store, "+15105550101", true)
+
+			rec := serveJSON(h.CreateSchedule(), http.MethodPost, "/api/schedules", "/api/schedules", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			schedules, err := store.Schedules.List(context.Background(), "")
+			wantCount := 0
+			if tt.wantStatus == http.StatusCreated {
+				wantCount = 1
+			}
+			if err != nil || len(schedules) != wantCount {
+				t.Errorf("schedules = %+v, %v, want %d", schedules, err, wantCount)
+			}
+		})
+	}
+}
+
+func TestListSchedules(t *testing.T) {
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	addStaff(t, store, "+15105550102", true)
+	addSchedule(t, store, "+15105550101")
+	addSchedule(t, store, "+15105550102")
+
+	tests := []struct {
+		target    string
+		wantCount int
+	}{
+		{target: "/api/schedules", wantCount: 2},
+		{target: "/api/schedules?phone_number=%2B15105550101", wantCount: 1},
+		{target: "/api/schedules?phone_number=%2B15105550109", wantCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec := serveJSON(h.ListSchedules(), http.MethodGet, "/api/schedules", tt.target, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+			}
+
+			var schedules []storage.Schedule
+			if err := json.Unmarshal(rec.Body.Bytes(), &schedules); err != nil || len(schedules) != tt.wantCount {
+				t.Errorf("schedules = %+v, %v, want %d", schedules, err, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestUpdateSchedule(t *testing.T) {
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	schedule := addSchedule(t, store, "+15105550101")
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		wantStatus int
+	}{
+		{name: "invalid", id: schedule.ID.Hex(), body: `{"phone_number": "+15105550101"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown ID", id: bson.NewObjectID().Hex(), body: mondayShift, wantStatus: http.StatusNotFound},
+		{name: "malformed ID", id: "nope", body: mondayShift, wantStatus: http.StatusNotFound},
+		{name: "replaced", id: schedule.ID.Hex(), body: mondayShift, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h.UpdateSchedule(), http.MethodPut, "/api/schedules/:id", "/api/schedules/"+tt.id, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	updated, err := store.Schedules.FindByID(context.Background(), schedule.ID)
+	if err != nil || updated == nil || updated.Always || updated.StartTime != "09:00" || updated.DayOfWeek != 1 {
+		t.Errorf("schedule = %+v, %v, want the Monday shift", updated, err)
+	}
+}
+
+func TestDeleteSchedule(t *testing.T) {
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	schedule := addSchedule(t, store, "+15105550101")
+
+	target := "/api/schedules/" + schedule.ID.Hex()
+	rec := serveJSON(h.DeleteSchedule(), http.MethodDelete, "/api/schedules/:id", target, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204 (body %q)", rec.Code, rec.Body.String())
+	}
+	if found, err := store.Schedules.FindByID(context.Background(), schedule.ID); err != nil || found != nil {
+		t.Errorf("schedule = %+v, %v, want it deleted", found, err)
+	}
+
+	rec = serveJSON(h.DeleteSchedule(), http.MethodDelete, "/api/schedules/:id", target, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404 (body %q)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOnCallPreview(t *testing.T) {
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	addStaff(t, store, "+15105550102", true)
+	if err := store.Schedules.Insert(context.Background(), storage.Schedule{
+		ID:          bson.NewObjectID(),
+		PhoneNumber: "+15105550101",
+		StartTime:   "09:00",
+		EndTime:     "17:00",
+		DayOfWeek:   1,
+		Recurring:   true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		at           string
+		wantStatus   int
+		wantPhones   []string
+		wantFallback bool
+	}{
+		{name: "on shift", at: "2025-06-02T10:00:00Z", wantStatus: http.StatusOK, wantPhones: []string{"+15105550101"}},
+		{name: "nobody on shift", at: "2025-06-02T20:00:00Z", wantStatus: http.StatusOK, wantPhones: []string{"+15105550101", "+15105550102"}, wantFallback: true},
+		{name: "bad time", at: "Monday", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h.OnCallPreview(), http.MethodGet, "/api/schedules/on-call", "/api/schedules/on-call?at="+tt.at, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var preview struct {
+				At           string   `json:"at"`
+				PhoneNumbers []string `json:"phone_numbers"`
+				Fallback     bool     `json:"fallback"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+				t.Fatal(err)
+			}
+			if preview.At != tt.at || !reflect.DeepEqual(preview.PhoneNumbers, tt.wantPhones) || preview.Fallback != tt.wantFallback {
+				t.Errorf("preview = %+v, want %s with %v (fallback %v)", preview, tt.at, tt.wantPhones, tt.wantFallback)
+			}
+		})
+	}
+}
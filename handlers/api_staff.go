@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// staffRequest is the body accepted when creating or updating staff. Fields
+// left out of an update are not changed.
+type staffRequest struct {
+	PhoneNumber *string `json:"phone_number"`
+	Active      *bool   `json:"active"`
+	// Email is the address for the EMAIL channel. An empty string removes it.
+	Email *string `json:"email"`
+	// Channels replaces the member's notification channels. An empty list
+	// resets them to SMS only.
+	Channels *[]string `json:"channels"`
+}
+
+// validateEmail checks an email address from a staff request and returns it
+// without any display name.
+func validateEmail(email string) (string, error) {
+	if email == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" {
+		return "", fmt.Errorf("email must be a plain address, e.g. volunteer@example.org")
+	}
+	return addr.Address, nil
+}
+
+// validateStaffChannels checks that a staff member can be reached on each of
+// their channels.
+func validateStaffChannels(staff storage.Staff) error {
+	for _, channel := range staff.Channels {
+		if channel == ChannelEmail && staff.Email == "" {
+			return fmt.Errorf("the EMAIL channel requires an email address")
+		}
+	}
+	return nil
+}
+
+// validateChannels checks that every channel has a registered notifier and
+// returns the channels without duplicates.
+func (h *handlers) validateChannels(channels []string) ([]string, error) {
+	seen := make(map[string]bool, len(channels))
+	var result []string
+	for _, channel := range channels {
+		if _, ok := h.Notifiers[channel]; !ok {
+			return nil, fmt.Errorf("unknown notification channel %q", channel)
+		}
+		if !seen[channel] {
+			seen[channel] = true
+			result = append(result, channel)
+		}
+	}
+	return result, nil
+}
+
+// newPublicID returns a random identifier for use in API paths.
+func newPublicID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func apiError(ginCtx *gin.Context, status int, message string) {
+	ginCtx.JSON(status, gin.H{"error": message})
+}
+
+// ListStaff returns every staff member.
+func (h *handlers) ListStaff() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		staff, err := h.Store.Staff.List(timedCtx)
+		if err != nil {
+			log.Printf("Error listing staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, staff)
+	}
+}
+
+// GetStaff returns one staff member by public ID.
+func (h *handlers) GetStaff() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		staff, err := h.Store.Staff.FindByPublicID(timedCtx, ginCtx.Param("id"))
+		if err != nil {
+			log.Printf("Error finding staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if staff == nil {
+			apiError(ginCtx, http.StatusNotFound, "staff member not found")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, staff)
+	}
+}
+
+// CreateStaff adds a staff member. New staff are active unless the request
+// says otherwise.
+func (h *handlers) CreateStaff() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		var req staffRequest
+		if err := ginCtx.ShouldBindJSON(&req); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		if req.PhoneNumber == nil || !utils.IsValidPhoneNumber(*req.PhoneNumber) {
+			apiError(ginCtx, http.StatusBadRequest, "phone_number must be in E.164 format, e.g. +15105550123")
+			return
+		}
+
+		var channels []string
+		if req.Channels != nil {
+			var err error
+			if channels, err = h.validateChannels(*req.Channels); err != nil {
+				apiError(ginCtx, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		var email string
+		if req.Email != nil {
+			var err error
+			if email, err = validateEmail(*req.Email); err != nil {
+				apiError(ginCtx, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		if err := validateStaffChannels(storage.Staff{Email: email, Channels: channels}); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		taken, err := h.Store.Staff.PhoneNumberTaken(timedCtx, *req.PhoneNumber, bson.ObjectID{})
+		if err != nil {
+			log.Printf("Error checking staff phone number: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if taken {
+			apiError(ginCtx, http.StatusConflict, "a staff member with this phone_number already exists")
+			return
+		}
+
+		publicID, err := newPublicID()
+		if err != nil {
+			log.Printf("Error generating staff ID: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		staff := storage.Staff{
+			ID:          bson.NewObjectID(),
+			PublicID:    publicID,
+			PhoneNumber: *req.PhoneNumber,
+			Active:      true,
+			Email:       email,
+			Channels:    channels,
+		}
+		if req.Active != nil {
+			staff.Active = *req.Active
+		}
+
+		if err := h.Store.Staff.Insert(timedCtx, staff); err != nil {
+			if errors.Is(err, storage.ErrDuplicate) {
+				apiError(ginCtx, http.StatusConflict, "a staff member with this phone_number already exists")
+				return
+			}
+			log.Printf("Error creating staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		log.Printf("Created staff member %s", staff.PublicID)
+		ginCtx.JSON(http.StatusCreated, staff)
+	}
+}
+
+// UpdateStaff changes a staff member's phone number, active flag, email or
+// notification channels. A phone number change is carried over to the
+// member's schedules.
+func (h *handlers) UpdateStaff() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		var req staffRequest
+		if err := ginCtx.ShouldBindJSON(&req); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		if req.PhoneNumber != nil && !utils.IsValidPhoneNumber(*req.PhoneNumber) {
+			apiError(ginCtx, http.StatusBadRequest, "phone_number must be in E.164 format, e.g. +15105550123")
+			return
+		}
+
+		var channels []string
+		if req.Channels != nil {
+			var err error
+			if channels, err = h.validateChannels(*req.Channels); err != nil {
+				apiError(ginCtx, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		var email string
+		if req.Email != nil {
+			var err error
+			if email, err = validateEmail(*req.Email); err != nil {
+				apiError(ginCtx, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		staff, err := h.Store.Staff.FindByPublicID(timedCtx, ginCtx.Param("id"))
+		if err != nil {
+			log.Printf("Error finding staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if staff == nil {
+			apiError(ginCtx, http.StatusNotFound, "staff member not found")
+			return
+		}
+
+		changed := false
+		oldPhoneNumber := staff.PhoneNumber
+
+		if req.PhoneNumber != nil && *req.PhoneNumber != staff.PhoneNumber {
+			taken, err := h.Store.Staff.PhoneNumberTaken(timedCtx, *req.PhoneNumber, staff.ID)
+			if err != nil {
+				log.Printf("Error checking staff phone number: %v", err)
+				apiError(ginCtx, http.StatusInternalServerError, "server error")
+				return
+			}
+			if taken {
+				apiError(ginCtx, http.StatusConflict, "a staff member with this phone_number already exists")
+				return
+			}
+
+			staff.PhoneNumber = *req.PhoneNumber
+			changed = true
+		}
+
+		if req.Active != nil {
+			staff.Active = *req.Active
+			changed = true
+		}
+
+		if req.Email != nil {
+			staff.Email = email
+			changed = true
+		}
+
+		if req.Channels != nil {
+			staff.Channels = channels
+			changed = true
+		}
+
+		if err := validateStaffChannels(*staff); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if changed {
+			if err := h.Store.Staff.Update(timedCtx, *staff); err != nil {
+				if errors.Is(err, storage.ErrDuplicate) {
+					apiError(ginCtx, http.StatusConflict, "a staff member with this phone_number already exists")
+					return
+				}
+				log.Printf("Error updating staff: %v", err)
+				apiError(ginCtx, http.StatusInternalServerError, "server error")
+				return
+			}
+		}
+
+		if staff.PhoneNumber != oldPhoneNumber {
+			if err := h.Store.Schedules.ChangePhoneNumber(timedCtx, oldPhoneNumber, staff.PhoneNumber); err != nil {
+				log.Printf("Error moving schedules to new phone number: %v", err)
+				apiError(ginCtx, http.StatusInternalServerError, "server error")
+				return
+			}
+		}
+
+		ginCtx.JSON(http.StatusOK, staff)
+	}
+}
+
+// DeleteStaff removes a staff member and their on-call schedule entries.
+func (h *handlers) DeleteStaff() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		staff, err := h.Store.Staff.FindByPublicID(timedCtx, ginCtx.Param("id"))
+		if err != nil {
+			log.Printf("Error finding staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if staff == nil {
+			apiError(ginCtx, http.StatusNotFound, "staff member not found")
+			return
+		}
+
+		// Schedules go first, so a member is never left on call without a
+		// staff record to resolve to.
+		if err := h.Store.Schedules.DeleteByPhoneNumber(timedCtx, staff.PhoneNumber); err != nil {
+			log.Printf("Error deleting staff schedules: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		deleted, err := h.Store.Staff.Delete(timedCtx, staff.PublicID)
+		if err != nil {
+			log.Printf("Error deleting staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !deleted {
+			apiError(ginCtx, http.StatusNotFound, "staff member not found")
+			return
+		}
+
+		log.Printf("Deleted staff member %s", ginCtx.Param("id"))
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// EnsureStaffPublicIDs assigns a public ID to staff members created before
+// the API existed, so every member can be addressed by /api/staff/:id.
+func (h *handlers) EnsureStaffPublicIDs(ctx context.Context) error {
+	staff, err := h.Store.Staff.ListWithoutPublicID(ctx)
+	if err != nil {
+		return fmt.Errorf("error finding staff without IDs: %w", err)
+	}
+
+	for _, member := range staff {
+		publicID, err := newPublicID()
+		if err != nil {
+			return err
+		}
+
+		if err := h.Store.Staff.SetPublicID(ctx, member.ID, publicID); err != nil {
+			return fmt.Errorf("error assigning staff ID: %w", err)
+		}
+	}
+
+	if len(staff) > 0 {
+		log.Printf("Assigned public IDs to %d staff members", len(staff))
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// failingSchedules is a schedule repository whose phone number writes fail.
+type failingSchedules struct {
+	storage.ScheduleRepository
+}
+
+func (failingSchedules) ChangePhoneNumber(ctx context.Context, from string, to string) error {
+	return errors.New("schedules unavailable")
+}
+
+func (failingSchedules) DeleteByPhoneNumber(ctx context.Context, phoneNumber string) error {
+	return errors.New("schedules unavailable")
+}
+
+// addSchedule stores an always-on schedule entry for a phone number.
+func addSchedule(t *testing.T, store storage.Store, phoneNumber string) storage.Schedule {
+	t.Helper()
+
+	schedule := storage.Schedule{ID: bson.NewObjectID(), PhoneNumber: phoneNumber, Always: true}
+	if err := store.Schedules.Insert(context.Background(), schedule); err != nil {
+		t.Fatal(err)
+	}
+	return schedule
+}
+
+func TestCreateStaff(t *testing.T) {
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "created", body: `{"phone_number": "+15105550102"}`, wantStatus: http.StatusCreated},
+		{name: "duplicate phone number", body: `{"phone_number": "+15105550101"}`, wantStatus: http.StatusConflict},
+		{name: "not E.164", body: `{"phone_number": "510-555-0103"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing phone number", body: `{"active": true}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(h.CreateStaff(), http.MethodPost, "/api/staff", "/api/staff", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	created, err := store.Staff.FindByPhoneNumber(context.Background(), "+15105550102")
+	if err != nil || created == nil || !created.Active || created.PublicID == "" {
+		t.Errorf("created staff = %+v, %v, want an active member with a public ID", created, err)
+	}
+}
+
+func TestUpdateStaff(t *testing.T) {
+	t.Run("phone number change moves schedules", func(t *testing.T) {
+		h, store, _ := newTestService(t)
+		staff := addStaff(t, store, "+15105550101", true)
+		schedule := addSchedule(t, store, staff.PhoneNumber)
+
+		rec := serveJSON(h.UpdateStaff(), http.MethodPatch, "/api/staff/:id", "/api/staff/"+staff.PublicID, `{"phone_number": "+15105550109"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+		}
+
+		var updated storage.Staff
+		if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil || updated.PhoneNumber != "+15105550109" {
+			t.Errorf("response = %+v, %v, want the new phone number", updated, err)
+		}
+
+		moved, err := store.Schedules.FindByID(context.Background(), schedule.ID)
+		if err != nil || moved == nil || moved.PhoneNumber != "+15105550109" {
+			t.Errorf("schedule = %+v, %v, want it moved to the new phone number", moved, err)
+		}
+	})
+
+	t.Run("schedule move failure is a server error", func(t *testing.T) {
+		h, store, _ := newTestService(t)
+		staff := addStaff(t, store, "+15105550101", true)
+		h.Store.Schedules = failingSchedules{store.Schedules}
+
+		rec := serveJSON(h.UpdateStaff(), http.MethodPatch, "/api/staff/:id", "/api/staff/"+staff.PublicID, `{"phone_number": "+15105550109"}`)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500 (body %q)", rec.Code, rec.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		wantStatus int
+	}{
+		{name: "duplicate phone number", id: "staff0101", body: `{"phone_number": "+15105550102"}`, wantStatus: http.StatusConflict},
+		{name: "not E.164", id: "staff0101", body: `{"phone_number": "15105550109"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown staff member", id: "nobody", body: `{"active": false}`, wantStatus: http.StatusNotFound},
+		{name: "deactivate", id: "staff0101", body: `{"active": false}`, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, _ := newTestService(t)
+			addStaff(t, store, "+15105550101", true)
+			addStaff(t, store, "+15105550102", true)
+
+			rec := serveJSON(h.UpdateStaff(), http.MethodPatch, "/api/staff/:id", "/api/staff/"+tt.id, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteStaff(t *testing.T) {
+	t.Run("removes schedules", func(t *testing.T) {
+		h, store, _ := newTestService(t)
+		staff := addStaff(t, store, "+15105550101", true)
+		addSchedule(t, store, staff.PhoneNumber)
+		other := addSchedule(t, store, "+15105550102")
+
+		rec := serveJSON(h.DeleteStaff(), http.MethodDelete, "/api/staff/:id", "/api/staff/"+staff.PublicID, "")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204 (body %q)", rec.Code, rec.Body.String())
+		}
+
+		ctx := context.Background()
+		if found, err := store.Staff.FindByPublicID(ctx, staff.PublicID); err != nil || found != nil {
+			t.Errorf("staff = %+v, %v, want it deleted", found, err)
+		}
+		schedules, err := store.Schedules.List(ctx, "")
+		if err != nil || len(schedules) != 1 || schedules[0].ID != other.ID {
+			t.Errorf("schedules = %+v, %v, want only the other member's schedule left", schedules, err)
+		}
+	})
+
+	t.Run("keeps the member when schedules cannot be removed", func(t *testing.T) {
+		h, store, _ := newTestService(t)
+		staff := addStaff(t, store, "+15105550101", true)
+		h.Store.Schedules = failingSchedules{store.Schedules}
+
+		rec := serveJSON(h.DeleteStaff(), http.MethodDelete, "/api/staff/:id", "/api/staff/"+staff.PublicID, "")
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500 (body %q)", rec.Code, rec.Body.String())
+		}
+		if found, err := store.Staff.FindByPublicID(context.Background(), staff.PublicID); err != nil || found == nil {
+			t.Errorf("staff = %+v, %v, want the member kept", found, err)
+		}
+	})
+
+	t.Run("unknown staff member", func(t *testing.T) {
+		h, _, _ := newTestService(t)
+
+		rec := serveJSON(h.DeleteStaff(), http.MethodDelete, "/api/staff/:id", "/api/staff/nobody", "")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404 (body %q)", rec.Code, rec.Body.String())
+		}
+	})
+}
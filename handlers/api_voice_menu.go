@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetVoiceMenu returns the voice menu.
+func (h *handlers) GetVoiceMenu() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		menu, err := h.getVoiceMenu(timedCtx)
+		if err != nil {
+			log.Printf("Error finding voice menu: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if menu == nil {
+			apiError(ginCtx, http.StatusNotFound, "no voice menu is configured")
+			return
+		}
+
+		ginCtx.JSON(http.StatusOK, menu)
+	}
+}
+
+// UpdateVoiceMenu replaces the voice menu.
+func (h *handlers) UpdateVoiceMenu() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		var menu storage.VoiceMenu
+		if err := ginCtx.ShouldBindJSON(&menu); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+
+		if err := validateVoiceMenu(&menu); err != nil {
+			apiError(ginCtx, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		problem, err := h.checkVoiceMenuStaff(timedCtx, &menu, "")
+		if err != nil {
+			log.Printf("Error finding staff: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if problem != "" {
+			apiError(ginCtx, http.StatusBadRequest, problem)
+			return
+		}
+
+		if err := h.Store.Config.SetVoiceMenu(timedCtx, &menu); err != nil {
+			log.Printf("Error saving voice menu: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		log.Printf("Updated voice menu with %d options", len(menu.Options))
+		ginCtx.JSON(http.StatusOK, menu)
+	}
+}
+
+// DeleteVoiceMenu removes the voice menu, so calls ring staff straight away
+// again.
+func (h *handlers) DeleteVoiceMenu() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		deleted, err := h.Store.Config.DeleteVoiceMenu(timedCtx)
+		if err != nil {
+			log.Printf("Error deleting voice menu: %v", err)
+			apiError(ginCtx, http.StatusInternalServerError, "server error")
+			return
+		}
+		if !deleted {
+			apiError(ginCtx, http.StatusNotFound, "no voice menu is configured")
+			return
+		}
+
+		log.Println("Deleted voice menu")
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// checkVoiceMenuStaff checks that every staff ID in the menu and its
+// submenus exists. It returns a description of the first unknown ID.
+func (h *handlers) checkVoiceMenuStaff(ctx context.Context, menu *storage.VoiceMenu, field string) (string, error) {
+	for i, option := range menu.Options {
+		prefix := fmt.Sprintf("%soptions[%d].", field, i)
+
+		for _, id := range option.StaffIDs {
+			staff, err := h.Store.Staff.FindByPublicID(ctx, id)
+			if err != nil {
+				return "", err
+			}
+			if staff == nil {
+				return fmt.Sprintf("%sstaff_ids: staff member %q not found", prefix, id), nil
+			}
+		}
+
+		if option.Menu != nil {
+			problem, err := h.checkVoiceMenuStaff(ctx, option.Menu, prefix+"menu.")
+			if problem != "" || err != nil {
+				return problem, err
+			}
+		}
+	}
+	return "", nil
+}
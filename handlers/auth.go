@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go/client"
+)
+
+// TwilioSignature rejects webhook requests that do not carry a valid
+// X-Twilio-Signature header. Twilio signs the full public URL it called, so
+// when the service runs behind a reverse proxy publicBaseURL must be set to
+// the scheme and host Twilio sees, e.g. https://relay.example.org.
+func TwilioSignature(authToken string, publicBaseURL string) gin.HandlerFunc {
+	validator := client.NewRequestValidator(authToken)
+
+	return func(ginCtx *gin.Context) {
+		signature := ginCtx.GetHeader("X-Twilio-Signature")
+		if signature == "" {
+			log.Printf("Rejecting request to %s without Twilio signature from IP: %s", ginCtx.Request.URL.Path, ginCtx.ClientIP())
+			ginCtx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		if err := ginCtx.Request.ParseForm(); err != nil {
+			log.Printf("Rejecting request to %s with unreadable form: %v", ginCtx.Request.URL.Path, err)
+			ginCtx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		requestURL := publicRequestURL(ginCtx.Request, publicBaseURL)
+		params := formParams(ginCtx.Request.PostForm)
+
+		if !validator.Validate(requestURL, params, signature) {
+			log.Printf("Rejecting request to %s with invalid Twilio signature from IP: %s", requestURL, ginCtx.ClientIP())
+			ginCtx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		ginCtx.Next()
+	}
+}
+
+// telnyxSignatureTolerance is how far a Telnyx webhook timestamp may be from
+// the current time, to limit replays of captured requests.
+const telnyxSignatureTolerance = 5 * time.Minute
+
+// TelnyxSignature rejects webhook requests that do not carry a valid
+// Telnyx-Signature-Ed25519 header. publicKey is the base64 key shown in the
+// Telnyx portal.
+func TelnyxSignature(publicKey string) (gin.HandlerFunc, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("telnyx public key must be a base64 Ed25519 key")
+	}
+
+	return func(ginCtx *gin.Context) {
+		signature, err := base64.StdEncoding.DecodeString(ginCtx.GetHeader("Telnyx-Signature-Ed25519"))
+		if err != nil || len(signature) == 0 {
+			log.Printf("Rejecting request to %s without Telnyx signature from IP: %s", ginCtx.Request.URL.Path, ginCtx.ClientIP())
+			ginCtx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		timestamp := ginCtx.GetHeader("Telnyx-Timestamp")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > telnyxSignatureTolerance {
+			log.Printf("Rejecting request to %s with stale Telnyx timestamp from IP: %s", ginCtx.Request.URL.Path, ginCtx.ClientIP())
+			ginCtx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(ginCtx.Request.Body, 1<<20))
+		if err != nil {
+			log.Printf("Rejecting request to %s with unreadable body: %v", ginCtx.Request.URL.Path, err)
+			ginCtx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ginCtx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		signed := append([]byte(timestamp+"|"), body...)
+		if !ed25519.Verify(key, signed, signature) {
+			log.Printf("Rejecting request to %s with invalid Telnyx signature from IP: %s", ginCtx.Request.URL.Path, ginCtx.ClientIP())
+			ginCtx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		ginCtx.Next()
+	}, nil
+}
+
+// RequestToken rejects requests whose token query parameter does not match
+// token. An empty token disables the check.
+func RequestToken(token string) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		if token == "" {
+			ginCtx.Next()
+			return
+		}
+
+		value, _ := ginCtx.GetQuery("token")
+		if value != token {
+			ginCtx.String(http.StatusUnauthorized, "Unauthorized")
+			ginCtx.Abort()
+			return
+		}
+
+		ginCtx.Next()
+	}
+}
+
+// AdminToken rejects admin API requests that do not carry token in an
+// "Authorization: Bearer" header.
+func AdminToken(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+
+	return func(ginCtx *gin.Context) {
+		header := []byte(ginCtx.GetHeader("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(header, expected) != 1 {
+			ginCtx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		ginCtx.Next()
+	}
+}
+
+// publicRequestURL rebuilds the URL Twilio requested. Without a configured
+// base URL it falls back to the forwarded headers set by most proxies.
+func publicRequestURL(req *http.Request, publicBaseURL string) string {
+	if publicBaseURL != "" {
+		return strings.TrimRight(publicBaseURL, "/") + req.URL.RequestURI()
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	host := req.Host
+	if forwardedHost := req.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+
+	return scheme + "://" + host + req.URL.RequestURI()
+}
+
+// formParams flattens a POST form into the single-valued map the Twilio
+// validator signs.
+func formParams(form url.Values) map[string]string {
+	params := make(map[string]string, len(form))
+	for key, values := range form {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	return params
+}
+
+// callbackURL builds a relative URL for Twilio to call back on. The request
+// token is only embedded when signature validation is off, since the
+// callback would otherwise be unauthenticated. Callbacks for the ?test
+// service keep the test parameter so they reach it again.
+func (h *handlers) callbackURL(path string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	if h.Config.Test {
+		params.Set("test", "")
+	}
+
+	if !h.Config.ValidateSignature && h.Config.RequestAuthToken != "" {
+		params.Set("token", h.Config.RequestAuthToken)
+	}
+
+	if len(params) == 0 {
+		return path
+	}
+
+	return path + "?" + params.Encode()
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Signature vector published with Twilio's request validation examples:
+// auth token 12345 signing https://mycompany.com/myapp.php?foo=1&bar=2 with
+// the form below.
+const (
+	testTwilioAuthToken = "12345"
+	testTwilioSignature = "vOEb5UThFn24KEfnOFLQY2AE5FY="
+)
+
+var testTwilioForm = url.Values{
+	"Digits":                {"1234"},
+	"CallSid":               {"CA1234567890ABCDE"},
+	"To":                    {"+18005551212"},
+	"Caller":                {"+14158675309"},
+	"From":                  {"+14158675309"},
+	"ReasonConferenceEnded": {"test"},
+	"Reason":                {"Participant"},
+}
+
+func newSignedRouter(publicBaseURL string, token string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/myapp.php", TwilioSignature(testTwilioAuthToken, publicBaseURL), RequestToken(token), func(ginCtx *gin.Context) {
+		ginCtx.String(http.StatusOK, ginCtx.PostForm("CallSid"))
+	})
+	return router
+}
+
+func TestTwilioSignature(t *testing.T) {
+	tests := []struct {
+		name          string
+		publicBaseURL string
+		target        string
+		headers       map[string]string
+		form          url.Values
+		token         string
+		wantStatus    int
+	}{
+		{
+			name:          "valid signature with public base URL",
+			publicBaseURL: "https://mycompany.com",
+			target:        "/myapp.php?foo=1&bar=2",
+			headers:       map[string]string{"X-Twilio-Signature": testTwilioSignature},
+			form:          testTwilioForm,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "trailing slash on public base URL",
+			publicBaseURL: "https://mycompany.com/",
+			target:        "/myapp.php?foo=1&bar=2",
+			headers:       map[string]string{"X-Twilio-Signature": testTwilioSignature},
+			form:          testTwilioForm,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:   "valid signature behind proxy headers",
+			target: "/myapp.php?foo=1&bar=2",
+			headers: map[string]string{
+				"X-Twilio-Signature": testTwilioSignature,
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Host":   "mycompany.com",
+			},
+			form:       testTwilioForm,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "proxy without public base URL",
+			target:     "/myapp.php?foo=1&bar=2",
+			headers:    map[string]string{"X-Twilio-Signature": testTwilioSignature},
+			form:       testTwilioForm,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:          "missing signature",
+			publicBaseURL: "https://mycompany.com",
+			target:        "/myapp.php?foo=1&bar=2",
+			form:          testTwilioForm,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "wrong signature",
+			publicBaseURL: "https://mycompany.com",
+			target:        "/myapp.php?foo=1&bar=2",
+			headers:       map[string]string{"X-Twilio-Signature": "RSOYDt4T1cUTdK1PDd93/VVr8B8="},
+			form:          testTwilioForm,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "tampered form",
+			publicBaseURL: "https://mycompany.com",
+			target:        "/myapp.php?foo=1&bar=2",
+			headers:       map[string]string{"X-Twilio-Signature": testTwilioSignature},
+			form: url.Values{
+				"Digits":                {"1234"},
+				"CallSid":               {"CA1234567890ABCDE"},
+				"To":                    {"+18005551212"},
+				"Caller":                {"+14158675309"},
+				"From":                  {"+15555550100"},
+				"ReasonConferenceEnded": {"test"},
+				"Reason":                {"Participant"},
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:          "tampered query",
+			publicBaseURL: "https://mycompany.com",
+			target:        "/myapp.php?foo=1&bar=3",
+			headers:       map[string]string{"X-Twilio-Signature": testTwilioSignature},
+			form:          testTwilioForm,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "signed request missing second factor token",
+			publicBaseURL: "https://mycompany.com",
+			target:        "/myapp.php?foo=1&bar=2",
+			headers:       map[string]string{"X-Twilio-Signature": testTwilioSignature},
+			form:          testTwilioForm,
+			token:         "secret",
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newSignedRouter(tt.publicBaseURL, tt.token)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.form.Encode()))
+			req.Host = "localhost:4514"
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != "CA1234567890ABCDE" {
+				t.Fatalf("handler did not receive form, got body %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTelnyxSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	middleware, err := TelnyxSignature(base64.StdEncoding.EncodeToString(publicKey))
+	if err != nil {
+		t.Fatalf("TelnyxSignature: %v", err)
+	}
+
+	const body = `{"data":{"event_type":"message.received"}}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	sign := func(timestamp string, payload string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(timestamp+"|"+payload)))
+	}
+
+	tests := []struct {
+		name       string
+		timestamp  string
+		signature  string
+		body       string
+		wantStatus int
+	}{
+		{name: "valid signature", timestamp: now, signature: sign(now, body), body: body, wantStatus: http.StatusOK},
+		{name: "missing signature", timestamp: now, body: body, wantStatus: http.StatusForbidden},
+		{name: "tampered body", timestamp: now, signature: sign(now, body), body: `{"data":{"event_type":"message.sent"}}`, wantStatus: http.StatusForbidden},
+		{name: "stale timestamp", timestamp: "1700000000", signature: sign("1700000000", body), body: body, wantStatus: http.StatusForbidden},
+		{name: "signature for another timestamp", timestamp: now, signature: sign("1700000000", body), body: body, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/sms", middleware, func(ginCtx *gin.Context) {
+				received, _ := io.ReadAll(ginCtx.Request.Body)
+				ginCtx.String(http.StatusOK, string(received))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/sms", strings.NewReader(tt.body))
+			req.Header.Set("Telnyx-Timestamp", tt.timestamp)
+			if tt.signature != "" {
+				req.Header.Set("Telnyx-Signature-Ed25519", tt.signature)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && rec.Body.String() != tt.body {
+				t.Fatalf("handler received body %q, want %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+
+	if _, err := TelnyxSignature("not a key"); err == nil {
+		t.Error("TelnyxSignature accepted an invalid public key")
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		token      string
+		target     string
+		wantStatus int
+	}{
+		{name: "disabled", token: "", target: "/sms", wantStatus: http.StatusOK},
+		{name: "matching", token: "secret", target: "/sms?token=secret", wantStatus: http.StatusOK},
+		{name: "missing", token: "secret", target: "/sms", wantStatus: http.StatusUnauthorized},
+		{name: "wrong", token: "secret", target: "/sms?token=nope", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/sms", RequestToken(tt.token), func(ginCtx *gin.Context) {
+				ginCtx.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCallbackURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{
+			name:   "signature validation omits token",
+			config: Config{RequestAuthToken: "secret", ValidateSignature: true},
+			want:   "/voice-status?from=%2B14158675309",
+		},
+		{
+			name:   "token embedded without signature validation",
+			config: Config{RequestAuthToken: "secret"},
+			want:   "/voice-status?from=%2B14158675309&token=secret",
+		},
+		{
+			name:   "test service keeps test parameter",
+			config: Config{RequestAuthToken: "secret", ValidateSignature: true}.TestConfig(),
+			want:   "/voice-status?from=%2B14158675309&test=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &handlers{Config: tt.config}
+			got := h.callbackURL("/voice-status", url.Values{"from": {"+14158675309"}})
+			if got != tt.want {
+				t.Fatalf("callbackURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestConfigKeepsSignatureValidation(t *testing.T) {
+	config := Config{
+		DatabaseName:      "dispatch_relay",
+		RequestAuthToken:  "secret",
+		ValidateSignature: true,
+	}
+
+	testConfig := config.TestConfig()
+	if testConfig.DatabaseName != "dispatch_relay_test" {
+		t.Fatalf("DatabaseName = %q, want dispatch_relay_test", testConfig.DatabaseName)
+	}
+	if !testConfig.SkipStaffIgnore {
+		t.Fatal("SkipStaffIgnore = false, want true")
+	}
+
+	for _, tt := range []struct {
+		config Config
+		want   string
+	}{
+		{config: config, want: "/voice-status"},
+		{config: testConfig, want: "/voice-status?test="},
+	} {
+		h := NewService(storage.NewMemoryStore(), NewFakeSMSProvider(), tt.config, MessageTemplates{})
+		got := h.callbackURL("/voice-status", nil)
+		if got != tt.want {
+			t.Fatalf("%s: callbackURL = %q, want %q with no token", tt.config.DatabaseName, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Escalation tier targets.
+const (
+	// EscalationTargetOnCall is the staff on-call now, optionally only on
+	// shifts of one schedule tier.
+	EscalationTargetOnCall = "ON_CALL"
+	// EscalationTargetAllActive is every active staff member.
+	EscalationTargetAllActive = "ALL_ACTIVE"
+	// EscalationTargetStaff is a fixed list of staff members.
+	EscalationTargetStaff = "STAFF"
+)
+
+const (
+	maxEscalationTiers = 10
+	// Twilio's <Dial> accepts ring timeouts from 5 to 600 seconds.
+	minEscalationTimeout = 5
+	maxEscalationTimeout = 600
+)
+
+// tierTimeout returns how long an escalation tier is tried.
+func tierTimeout(t storage.EscalationTier) time.Duration {
+	return time.Duration(t.TimeoutSeconds) * time.Second
+}
+
+// validateEscalationPolicy checks the tiers of a policy. It does not check
+// that the staff IDs exist.
+func validateEscalationPolicy(policy storage.EscalationPolicy) error {
+	if len(policy.Tiers) == 0 {
+		return fmt.Errorf("tiers must not be empty")
+	}
+	if len(policy.Tiers) > maxEscalationTiers {
+		return fmt.Errorf("a policy can have at most %d tiers", maxEscalationTiers)
+	}
+
+	for i, tier := range policy.Tiers {
+		switch tier.Target {
+		case EscalationTargetOnCall:
+			if tier.ScheduleTier < 0 || tier.ScheduleTier > maxScheduleTier {
+				return fmt.Errorf("tiers[%d].schedule_tier must be between 0 and %d", i, maxScheduleTier)
+			}
+		case EscalationTargetAllActive:
+		case EscalationTargetStaff:
+			if len(tier.StaffIDs) == 0 {
+				return fmt.Errorf("tiers[%d].staff_ids must not be empty for the STAFF target", i)
+			}
+		default:
+			return fmt.Errorf("tiers[%d].target must be ON_CALL, ALL_ACTIVE or STAFF", i)
+		}
+
+		if tier.TimeoutSeconds < minEscalationTimeout || tier.TimeoutSeconds > maxEscalationTimeout {
+			return fmt.Errorf("tiers[%d].timeout_seconds must be between %d and %d", i, minEscalationTimeout, maxEscalationTimeout)
+		}
+	}
+
+	return nil
+}
+
+// getEscalationPolicy returns the escalation policy, or nil if none is
+// configured.
+func (h *handlers) getEscalationPolicy(ctx context.Context) (*storage.EscalationPolicy, error) {
+	policy, err := h.Store.Escalation.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load escalation policy: %w", err)
+	}
+
+	if policy == nil || len(policy.Tiers) == 0 {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// escalationTierStaff returns the active staff a tier contacts at the given
+// time.
+func (h *handlers) escalationTierStaff(ctx context.Context, tier storage.EscalationTier, now time.Time) ([]storage.Staff, error) {
+	switch tier.Target {
+	case EscalationTargetOnCall:
+		staff, fallback, err := h.getOnCallStaffInTier(ctx, now, tier.ScheduleTier)
+		if err != nil {
+			return nil, err
+		}
+		// Backup tiers stay empty rather than waking everyone when nobody is
+		// on a backup shift.
+		if fallback && tier.ScheduleTier > 1 {
+			return nil, nil
+		}
+		return staff, nil
+
+	case EscalationTargetAllActive:
+		return h.getActiveStaff(ctx)
+
+	case EscalationTargetStaff:
+		found, err := h.Store.Staff.FindByPublicIDs(ctx, tier.StaffIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving escalation staff: %w", err)
+		}
+
+		var staff []storage.Staff
+		for _, member := range found {
+			if member.Active {
+				staff = append(staff, member)
+			}
+		}
+		return staff, nil
+	}
+
+	return nil, fmt.Errorf("unknown escalation target %q", tier.Target)
+}
+
+// nextEscalationTier returns the first tier at or after start that has
+// anyone to contact, with its staff. It returns -1 when no tier is left.
+func (h *handlers) nextEscalationTier(ctx context.Context, policy *storage.EscalationPolicy, start int, now time.Time) (int, []storage.Staff, error) {
+	for i := start; i < len(policy.Tiers); i++ {
+		staff, err := h.escalationTierStaff(ctx, policy.Tiers[i], now)
+		if err != nil {
+			return -1, nil, err
+		}
+		if len(staff) > 0 {
+			return i, staff, nil
+		}
+		log.Printf("Escalation: tier %d has nobody to contact, skipping", i+1)
+	}
+
+	return -1, nil, nil
+}
+
+// scheduleThreadEscalation records the tier a thread's alert went to and
+// when the next tier is due, if there is one.
+func (h *handlers) scheduleThreadEscalation(ctx context.Context, threadID bson.ObjectID, policy *storage.EscalationPolicy, tier int, now time.Time) error {
+	var next *time.Time
+	if tier+1 < len(policy.Tiers) {
+		at := now.Add(tierTimeout(policy.Tiers[tier]))
+		next = &at
+	}
+
+	if err := h.Store.Threads.SetEscalation(ctx, threadID, tier, next); err != nil {
+		return fmt.Errorf("failed to schedule escalation: %w", err)
+	}
+	return nil
+}
+
+// threadAlertGroup returns the group of staff responsible for a thread.
+// With an escalation policy a new thread goes to the first tier with anyone
+// to contact and schedules the next, and later texts go to the tier the
+// thread has reached. Otherwise the group is every on-call member.
+func (h *handlers) threadAlertGroup(ctx context.Context, thread *storage.Thread, isNew bool) ([]storage.Staff, error) {
+	policy, err := h.getEscalationPolicy(ctx)
+	if err != nil {
+		log.Printf("Error loading escalation policy, alerting all on-call staff: %v", err)
+	}
+	if policy == nil {
+		return h.getOnCallStaff(ctx)
+	}
+
+	now := h.now()
+
+	if !isNew {
+		tier := min(thread.EscalationTier, len(policy.Tiers)-1)
+		staff, err := h.escalationTierStaff(ctx, policy.Tiers[tier], now)
+		if err != nil || len(staff) == 0 {
+			return h.getOnCallStaff(ctx)
+		}
+		return staff, nil
+	}
+
+	tier, staff, err := h.nextEscalationTier(ctx, policy, 0, now)
+	if err != nil {
+		return nil, err
+	}
+	if tier < 0 {
+		log.Println("No escalation tier has anyone to contact, falling back to on-call staff")
+		return h.getOnCallStaff(ctx)
+	}
+
+	if err := h.scheduleThreadEscalation(ctx, thread.ID, policy, tier, now); err != nil {
+		log.Printf("Error scheduling escalation for thread %s: %v", thread.Code, err)
+	}
+	return staff, nil
+}
+
+// lastStaffAlert returns the body of the most recent staff alert for a
+// thread, so escalations repeat what earlier tiers were sent.
+func (h *handlers) lastStaffAlert(ctx context.Context, threadID bson.ObjectID) (string, error) {
+	message, err := h.Store.Messages.FindLast(ctx, threadID, MessageKindStaffNotification)
+	if err != nil {
+		return "", err
+	}
+	if message == nil {
+		return "", fmt.Errorf("no staff alert found for thread %s", threadID.Hex())
+	}
+	return message.Body, nil
+}
+
+// EscalatePendingThreads alerts the next escalation tier for every open
+// thread whose current tier did not acknowledge in time.
+func (h *handlers) EscalatePendingThreads(ctx context.Context) {
+	policy, err := h.getEscalationPolicy(ctx)
+	if err != nil {
+		log.Printf("Escalation: %v", err)
+		return
+	}
+
+	for {
+		now := time.Now()
+
+		// Claim the thread by clearing its due time, so it is escalated once
+		// even if several loops run.
+		thread, err := h.Store.Threads.ClaimDueEscalation(ctx, now)
+		if err != nil {
+			log.Printf("Escalation: error claiming thread: %v", err)
+			return
+		}
+		if thread == nil {
+			return
+		}
+
+		if policy == nil {
+			continue
+		}
+
+		h.escalateThread(ctx, policy, *thread, now.In(h.location()))
+	}
+}
+
+// escalateThread alerts the tier after the thread's current one.
+func (h *handlers) escalateThread(ctx context.Context, policy *storage.EscalationPolicy, thread storage.Thread, now time.Time) {
+	tier, staff, err := h.nextEscalationTier(ctx, policy, thread.EscalationTier+1, now)
+	if err != nil {
+		log.Printf("Escalation: error resolving next tier for thread %s: %v", thread.Code, err)
+		return
+	}
+	if tier < 0 {
+		log.Printf("Escalation: thread %s has no tiers left", thread.Code)
+		return
+	}
+
+	body, err := h.lastStaffAlert(ctx, thread.ID)
+	if err != nil {
+		log.Printf("Escalation: error finding alert for thread %s: %v", thread.Code, err)
+		return
+	}
+
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		log.Printf("Escalation: error fetching phone config: %v", err)
+		return
+	}
+
+	log.Printf("Escalation: thread %s not acknowledged, alerting tier %d (%d staff)", thread.Code, tier+1, len(staff))
+
+	h.notifyStaff(ctx, staff, Notification{
+		Kind:     MessageKindEscalation,
+		From:     phoneConfig.Outbound,
+		Body:     fmt.Sprintf("ESCALATED (no acknowledgement)\n\n%s", body),
+		ThreadID: thread.ID,
+	})
+
+	if err := h.scheduleThreadEscalation(ctx, thread.ID, policy, tier, now); err != nil {
+		log.Printf("Escalation: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func TestValidateEscalationPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		tiers   []storage.EscalationTier
+		wantErr bool
+	}{
+		{
+			name: "primary, backup, everyone",
+			tiers: []storage.EscalationTier{
+				{Target: EscalationTargetOnCall, ScheduleTier: 1, TimeoutSeconds: 20},
+				{Target: EscalationTargetOnCall, ScheduleTier: 2, TimeoutSeconds: 20},
+				{Target: EscalationTargetAllActive, TimeoutSeconds: 30},
+			},
+		},
+		{
+			name:  "named staff",
+			tiers: []storage.EscalationTier{{Target: EscalationTargetStaff, StaffIDs: []string{"a1b2c3d4e5f60718"}, TimeoutSeconds: 15}},
+		},
+		{
+			name:    "no tiers",
+			wantErr: true,
+		},
+		{
+			name:    "unknown target",
+			tiers:   []storage.EscalationTier{{Target: "EVERYONE", TimeoutSeconds: 20}},
+			wantErr: true,
+		},
+		{
+			name:    "staff target without staff",
+			tiers:   []storage.EscalationTier{{Target: EscalationTargetStaff, TimeoutSeconds: 20}},
+			wantErr: true,
+		},
+		{
+			name:    "timeout too short for Dial",
+			tiers:   []storage.EscalationTier{{Target: EscalationTargetAllActive, TimeoutSeconds: 2}},
+			wantErr: true,
+		},
+		{
+			name:    "schedule tier out of range",
+			tiers:   []storage.EscalationTier{{Target: EscalationTargetOnCall, ScheduleTier: 10, TimeoutSeconds: 20}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEscalationPolicy(storage.EscalationPolicy{Tiers: tt.tiers})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateEscalationPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialTwiML(t *testing.T) {
+	h := &handlers{Config: Config{ValidateSignature: true}}
+
+	tests := []struct {
+		name        string
+		tier        int
+		timeout     int
+		wantTimeout string
+		wantAction  string
+	}{
+		{
+			name:        "without escalation policy",
+			tier:        -1,
+			timeout:     defaultDialTimeout,
+			wantTimeout: `timeout="20"`,
+			wantAction:  `action="/voice-status?from=%2B14158675309"`,
+		},
+		{
+			name:        "second tier",
+			tier:        1,
+			timeout:     45,
+			wantTimeout: `timeout="45"`,
+			wantAction:  `action="/voice-status?from=%2B14158675309&amp;tier=1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.dialTwiML("Please hold.", "+15105550100", "+14158675309", tt.tier, tt.timeout, []string{"+15105550101", "+15105550102"})
+			if err != nil {
+				t.Fatalf("dialTwiML: %v", err)
+			}
+
+			for _, want := range []string{tt.wantTimeout, tt.wantAction, "<Number>+15105550101</Number><Number>+15105550102</Number>"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("TwiML is missing %s:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDialNumbersSkipsCaller(t *testing.T) {
+	staff := []storage.Staff{{PhoneNumber: "+15105550101"}, {PhoneNumber: "+14158675309"}}
+
+	got := dialNumbers(staff, "+14158675309")
+	if len(got) != 1 || got[0] != "+15105550101" {
+		t.Fatalf("dialNumbers = %v, want only +15105550101", got)
+	}
+}
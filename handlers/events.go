@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Event types sent to event webhooks.
+const (
+	EventThreadCreated     = "thread.created"
+	EventMessageReceived   = "message.received"
+	EventStaffNotified     = "staff.notified"
+	EventCallAnswered      = "call.answered"
+	EventCallMissed        = "call.missed"
+	EventVoicemailRecorded = "voicemail.recorded"
+	EventThreadClosed      = "thread.closed"
+	EventNumberBlocked     = "number.blocked"
+)
+
+const (
+	// maxEventAttempts is how many times a delivery is tried before it is
+	// marked FAILED.
+	maxEventAttempts = 8
+	// eventRetryBase is the wait after the first failed attempt. Each later
+	// wait doubles, up to eventRetryMax.
+	eventRetryBase = 30 * time.Second
+	eventRetryMax  = time.Hour
+	// eventAttemptLease keeps other workers off a delivery while it is being
+	// attempted.
+	eventAttemptLease = time.Minute
+)
+
+var eventHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// EventWebhook is a URL that receives every relay event, signed with Secret.
+type EventWebhook struct {
+	URL    string
+	Secret string
+}
+
+// ParseEventWebhooks parses a comma-separated list of event webhook URLs
+// that share one signing secret.
+func ParseEventWebhooks(urls string, secret string) ([]EventWebhook, error) {
+	var webhooks []EventWebhook
+	for _, rawURL := range utils.SplitAndTrim(urls, ",") {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("event webhook URL %q must be an http(s) URL", rawURL)
+		}
+		webhooks = append(webhooks, EventWebhook{URL: parsed.String(), Secret: secret})
+	}
+
+	if len(webhooks) > 0 && secret == "" {
+		return nil, fmt.Errorf("a signing secret is required")
+	}
+	return webhooks, nil
+}
+
+// Event is the JSON body of an event webhook request.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// RegisterEventWebhook adds a URL that receives every relay event.
+func (h *handlers) RegisterEventWebhook(webhook EventWebhook) {
+	h.EventWebhooks = append(h.EventWebhooks, webhook)
+}
+
+// emitEvent queues an event for every event webhook and starts the first
+// delivery attempts in the background. Failures are logged so that an
+// unreachable webhook never affects relaying.
+func (h *handlers) emitEvent(ctx context.Context, eventType string, data any) {
+	if len(h.EventWebhooks) == 0 {
+		return
+	}
+
+	now := time.Now()
+	event := Event{
+		ID:        bson.NewObjectID().Hex(),
+		Type:      eventType,
+		CreatedAt: now,
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+
+	for _, webhook := range h.EventWebhooks {
+		delivery := storage.WebhookDelivery{
+			ID:        bson.NewObjectID(),
+			EventID:   event.ID,
+			EventType: eventType,
+			URL:       webhook.URL,
+			Payload:   string(payload),
+			Status:    storage.DeliveryStatusPending,
+			// Leased to the goroutine below.
+			NextAttemptAt: now.Add(eventAttemptLease),
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
+		if err := h.Store.WebhookDeliveries.Insert(ctx, delivery); err != nil {
+			log.Printf("Error queueing %s event for %s: %v", eventType, webhook.URL, err)
+			continue
+		}
+
+		go func() {
+			attemptCtx, cancel := context.WithTimeout(context.Background(), eventAttemptLease)
+			defer cancel()
+			h.attemptDelivery(attemptCtx, delivery)
+		}()
+	}
+}
+
+// RetryEventDeliveries attempts every pending delivery that is due.
+func (h *handlers) RetryEventDeliveries(ctx context.Context) {
+	for {
+		now := time.Now()
+
+		delivery, err := h.Store.WebhookDeliveries.ClaimDue(ctx, now, now.Add(eventAttemptLease))
+		if err != nil {
+			log.Printf("Event webhooks: error claiming pending delivery: %v", err)
+			return
+		}
+		if delivery == nil {
+			return
+		}
+
+		h.attemptDelivery(ctx, *delivery)
+	}
+}
+
+// attemptDelivery makes one delivery attempt and records the outcome.
+func (h *handlers) attemptDelivery(ctx context.Context, delivery storage.WebhookDelivery) {
+	now := time.Now()
+	attempt := storage.DeliveryAttempt{At: now}
+
+	webhook, ok := h.findEventWebhook(delivery.URL)
+	if !ok {
+		attempt.Error = "webhook is no longer configured"
+	} else {
+		statusCode, err := postEvent(ctx, webhook, delivery.EventType, delivery.EventID, []byte(delivery.Payload), now)
+		attempt.StatusCode = statusCode
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+
+	attempts := delivery.Attempts + 1
+	delivery.Attempts = attempts
+	delivery.UpdatedAt = now
+	delivery.LastError = attempt.Error
+
+	switch {
+	case attempt.Error == "":
+		delivery.Status = storage.DeliveryStatusDelivered
+		log.Printf("Delivered %s event %s to %s", delivery.EventType, delivery.EventID, delivery.URL)
+	case !ok || attempts >= maxEventAttempts:
+		delivery.Status = storage.DeliveryStatusFailed
+		log.Printf("Giving up on %s event %s to %s after %d attempts: %s", delivery.EventType, delivery.EventID, delivery.URL, attempts, attempt.Error)
+	default:
+		delivery.NextAttemptAt = now.Add(eventRetryDelay(attempts))
+		log.Printf("Error delivering %s event %s to %s (attempt %d): %s", delivery.EventType, delivery.EventID, delivery.URL, attempts, attempt.Error)
+	}
+
+	if err := h.Store.WebhookDeliveries.RecordAttempt(ctx, delivery, attempt); err != nil {
+		log.Printf("Error recording delivery of event %s: %v", delivery.EventID, err)
+	}
+}
+
+func (h *handlers) findEventWebhook(rawURL string) (EventWebhook, bool) {
+	for _, webhook := range h.EventWebhooks {
+		if webhook.URL == rawURL {
+			return webhook, true
+		}
+	}
+	return EventWebhook{}, false
+}
+
+// eventRetryDelay returns how long to wait after the given number of failed
+// attempts.
+func eventRetryDelay(attempts int) time.Duration {
+	delay := eventRetryBase
+	for i := 1; i < attempts && delay < eventRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > eventRetryMax {
+		delay = eventRetryMax
+	}
+	return delay
+}
+
+// signEvent returns the signature of an event body: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret.
+func signEvent(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postEvent sends a signed event. Any status outside 2xx is an error.
+func postEvent(ctx context.Context, webhook EventWebhook, eventType string, eventID string, payload []byte, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Dispatch-Event", eventType)
+	req.Header.Set("X-Dispatch-Event-Id", eventID)
+	req.Header.Set("X-Dispatch-Timestamp", timestamp)
+	req.Header.Set("X-Dispatch-Signature", "sha256="+signEvent(webhook.Secret, timestamp, payload))
+
+	resp, err := eventHTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
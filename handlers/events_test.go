@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func TestParseEventWebhooks(t *testing.T) {
+	webhooks, err := ParseEventWebhooks("https://cad.example.org/events, http://logger.local/hook", "secret")
+	if err != nil {
+		t.Fatalf("ParseEventWebhooks: %v", err)
+	}
+	if len(webhooks) != 2 || webhooks[1].URL != "http://logger.local/hook" || webhooks[1].Secret != "secret" {
+		t.Fatalf("webhooks = %+v", webhooks)
+	}
+
+	if _, err := ParseEventWebhooks("https://cad.example.org/events", ""); err == nil {
+		t.Error("ParseEventWebhooks without a secret succeeded, want error")
+	}
+	if _, err := ParseEventWebhooks("cad.example.org/events", "secret"); err == nil {
+		t.Error("ParseEventWebhooks without a scheme succeeded, want error")
+	}
+	if webhooks, err := ParseEventWebhooks("", ""); err != nil || len(webhooks) != 0 {
+		t.Errorf("ParseEventWebhooks(\"\") = %v, %v, want no webhooks", webhooks, err)
+	}
+}
+
+func TestPostEventSignature(t *testing.T) {
+	payload, _ := json.Marshal(Event{ID: "evt1", Type: EventNumberBlocked, Data: map[string]any{
+		"blocked_number": storage.BlockedNumber{PhoneNumber: "+14158675309", Reason: "spam"},
+	}})
+	now := time.Unix(1767258000, 0)
+
+	var gotBody []byte
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	status, err := postEvent(context.Background(), EventWebhook{URL: server.URL, Secret: "whsec"}, EventNumberBlocked, "evt1", payload, now)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("postEvent = %d, %v", status, err)
+	}
+
+	if gotHeader.Get("X-Dispatch-Event") != EventNumberBlocked || gotHeader.Get("X-Dispatch-Event-Id") != "evt1" {
+		t.Fatalf("event headers = %v", gotHeader)
+	}
+	if gotHeader.Get("X-Dispatch-Timestamp") != "1767258000" {
+		t.Fatalf("timestamp = %q", gotHeader.Get("X-Dispatch-Timestamp"))
+	}
+
+	// Verify the way a receiver would.
+	mac := hmac.New(sha256.New, []byte("whsec"))
+	mac.Write([]byte(gotHeader.Get("X-Dispatch-Timestamp") + "."))
+	mac.Write(gotBody)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if gotHeader.Get("X-Dispatch-Signature") != want {
+		t.Fatalf("signature = %q, want %q", gotHeader.Get("X-Dispatch-Signature"), want)
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			BlockedNumber struct {
+				PhoneNumber string `json:"phone_number"`
+			} `json:"blocked_number"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(gotBody, &event); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if event.Type != EventNumberBlocked || event.Data.BlockedNumber.PhoneNumber != "+14158675309" {
+		t.Fatalf("event = %+v", event)
+	}
+}
+
+func TestPostEventRejectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	status, err := postEvent(context.Background(), EventWebhook{URL: server.URL, Secret: "whsec"}, EventCallMissed, "evt2", []byte(`{}`), time.Now())
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("postEvent = %d, %v, want 503 error", status, err)
+	}
+}
+
+func TestEventRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{20, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := eventRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("eventRetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	DirectionInbound  = "INBOUND"
+	DirectionOutbound = "OUTBOUND"
+
+	ChannelSMS   = "SMS"
+	ChannelVoice = "VOICE"
+)
+
+// Message kinds describe why a message was sent or received.
+const (
+	MessageKindReporterMessage     = "reporter_message"
+	MessageKindAutoReply           = "auto_reply"
+	MessageKindStaffNotification   = "staff_notification"
+	MessageKindStaffReply          = "staff_reply"
+	MessageKindStaffCommand        = "staff_command"
+	MessageKindCommandReply        = "command_reply"
+	MessageKindCall                = "call"
+	MessageKindCallStatus          = "call_status"
+	MessageKindMissedCall          = "missed_call_notification"
+	MessageKindScheduleReminder    = "schedule_reminder"
+	MessageKindEscalation          = "escalation"
+	MessageKindVoicemail           = "voicemail_notification"
+	MessageKindVoicemailTranscript = "voicemail_transcript"
+)
+
+// recordMessage stores a message and returns it with its ID. Failures are
+// logged and otherwise ignored so that a storage problem never stops a
+// message from being relayed.
+func (h *handlers) recordMessage(ctx context.Context, message storage.Message) storage.Message {
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	if message.ID.IsZero() {
+		message.ID = bson.NewObjectID()
+	}
+
+	if err := h.Store.Messages.Insert(ctx, message); err != nil {
+		log.Printf("Error recording %s message: %v", message.Kind, err)
+	}
+
+	return message
+}
+
+// sendAndRecord sends an SMS to each phone number and records the outcome on
+// the given thread.
+func (h *handlers) sendAndRecord(ctx context.Context, threadID bson.ObjectID, kind string, fromNumber string, phoneNumbers []string, body string) {
+	deliveries := h.sendMessageToGroup(ctx, fromNumber, phoneNumbers, body)
+
+	h.recordMessage(ctx, storage.Message{
+		ThreadID:   threadID,
+		Direction:  DirectionOutbound,
+		Channel:    ChannelSMS,
+		Kind:       kind,
+		From:       fromNumber,
+		To:         phoneNumbers,
+		Body:       body,
+		Deliveries: deliveries,
+	})
+}
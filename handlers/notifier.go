@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Notification is an alert for staff, such as a new dispatch message, a
+// missed call or a schedule reminder.
+type Notification struct {
+	// Kind is the message kind the alert is recorded under.
+	Kind string
+	// From is the dispatch number SMS alerts are sent from.
+	From string
+	Body string
+	// Vars are the template variables Body was rendered with, for notifiers
+	// that format alerts their own way.
+	Vars map[string]string
+	// ThreadID links the alert to a thread. Zero for alerts without one.
+	ThreadID bson.ObjectID
+}
+
+// Notifier delivers staff alerts over one channel. Notify is called with the
+// staff members who opted into the channel and returns one delivery per
+// recipient. Failures are reported on the delivery rather than as an error
+// so one unreachable recipient does not stop the others.
+type Notifier interface {
+	Channel() string
+	Notify(ctx context.Context, recipients []storage.Staff, notification Notification) []storage.MessageDelivery
+}
+
+// SMSNotifier sends staff alerts as SMS through the service's SMS provider.
+type SMSNotifier struct {
+	Provider SMSProvider
+}
+
+func (n *SMSNotifier) Channel() string {
+	return ChannelSMS
+}
+
+func (n *SMSNotifier) Notify(ctx context.Context, recipients []storage.Staff, notification Notification) []storage.MessageDelivery {
+	return sendSMS(ctx, n.Provider, notification.From, phoneNumbersOf(recipients), notification.Body)
+}
+
+// notificationChannels returns the channels a staff member receives alerts
+// on.
+func notificationChannels(s storage.Staff) []string {
+	if len(s.Channels) == 0 {
+		return []string{ChannelSMS}
+	}
+	return s.Channels
+}
+
+// notifyStaff sends an alert to each staff member over every channel they
+// opted into, and records one outbound message per channel.
+func (h *handlers) notifyStaff(ctx context.Context, staff []storage.Staff, notification Notification) {
+	byChannel := make(map[string][]storage.Staff)
+	for _, member := range staff {
+		for _, channel := range notificationChannels(member) {
+			byChannel[channel] = append(byChannel[channel], member)
+		}
+	}
+
+	channels := make([]string, 0, len(byChannel))
+	for channel := range byChannel {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	var allDeliveries []storage.MessageDelivery
+	for _, channel := range channels {
+		recipients := byChannel[channel]
+
+		var deliveries []storage.MessageDelivery
+		if notifier, ok := h.Notifiers[channel]; ok {
+			deliveries = notifier.Notify(ctx, recipients, notification)
+		} else {
+			log.Printf("No notifier configured for channel %s, skipping %d recipients", channel, len(recipients))
+			for _, member := range recipients {
+				deliveries = append(deliveries, storage.MessageDelivery{
+					Channel: channel,
+					To:      member.PhoneNumber,
+					Error:   fmt.Sprintf("channel %s is not configured", channel),
+				})
+			}
+		}
+
+		to := make([]string, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			to = append(to, delivery.To)
+		}
+
+		h.recordMessage(ctx, storage.Message{
+			ThreadID:   notification.ThreadID,
+			Direction:  DirectionOutbound,
+			Channel:    channel,
+			Kind:       notification.Kind,
+			From:       notification.From,
+			To:         to,
+			Body:       notification.Body,
+			Deliveries: deliveries,
+		})
+
+		allDeliveries = append(allDeliveries, deliveries...)
+	}
+
+	data := map[string]any{
+		"kind":       notification.Kind,
+		"body":       notification.Body,
+		"staff":      staff,
+		"deliveries": allDeliveries,
+	}
+	if !notification.ThreadID.IsZero() {
+		data["thread_id"] = notification.ThreadID
+	}
+	h.emitEvent(ctx, EventStaffNotified, data)
+
+	if notification.Kind != MessageKindScheduleReminder {
+		h.markStaffAlerted(ctx, staff, time.Now())
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+)
+
+// ChannelChat is the message channel chat webhook posts are recorded under.
+const ChannelChat = "CHAT"
+
+// Chat webhook formats.
+const (
+	ChatFormatSlack   = "slack"
+	ChatFormatDiscord = "discord"
+	// ChatFormatMatrix posts to a matrix-hookshot generic webhook.
+	ChatFormatMatrix = "matrix"
+)
+
+var chatHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// ChatWebhook is a group chat incoming webhook that receives every alert
+// posted with broadcastToChat.
+type ChatWebhook struct {
+	Format string
+	URL    string
+}
+
+// ParseChatWebhooks parses a comma-separated list of format=url entries,
+// e.g. "slack=https://hooks.slack.com/services/...".
+func ParseChatWebhooks(value string) ([]ChatWebhook, error) {
+	var webhooks []ChatWebhook
+	for _, entry := range utils.SplitAndTrim(value, ",") {
+		format, rawURL, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("chat webhook %q must be format=url", entry)
+		}
+
+		format = strings.ToLower(strings.TrimSpace(format))
+		switch format {
+		case ChatFormatSlack, ChatFormatDiscord, ChatFormatMatrix:
+		default:
+			return nil, fmt.Errorf("unknown chat webhook format %q", format)
+		}
+
+		parsed, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("chat webhook URL for %s must be an http(s) URL", format)
+		}
+
+		webhooks = append(webhooks, ChatWebhook{Format: format, URL: parsed.String()})
+	}
+	return webhooks, nil
+}
+
+// name identifies the webhook in logs and message records without exposing
+// the URL, which usually carries a secret.
+func (w ChatWebhook) name() string {
+	if parsed, err := url.Parse(w.URL); err == nil {
+		return w.Format + "@" + parsed.Host
+	}
+	return w.Format
+}
+
+// ChatAlert is the content of a chat webhook post.
+type ChatAlert struct {
+	Title      string
+	From       string
+	Body       string
+	ThreadID   string
+	ThreadCode string
+	Time       string
+	OnCall     []string
+}
+
+// chatAlertTitles are the headings for alert kinds posted to chat.
+var chatAlertTitles = map[string]string{
+	MessageKindStaffNotification: "Dispatch message",
+	MessageKindMissedCall:        "Missed call",
+}
+
+// newChatAlert builds a chat post from a staff alert and the staff on call.
+func newChatAlert(notification Notification, onCall []storage.Staff) ChatAlert {
+	title, ok := chatAlertTitles[notification.Kind]
+	if !ok {
+		title = "Dispatch alert"
+	}
+
+	alert := ChatAlert{
+		Title:      title,
+		From:       notification.Vars["from"],
+		Body:       notification.Vars["body"],
+		ThreadCode: notification.Vars["code"],
+		Time:       notification.Vars["time"],
+		OnCall:     phoneNumbersOf(onCall),
+	}
+	if !notification.ThreadID.IsZero() {
+		alert.ThreadID = notification.ThreadID.Hex()
+	}
+	return alert
+}
+
+func (a ChatAlert) onCallText() string {
+	if len(a.OnCall) == 0 {
+		return "nobody"
+	}
+	return strings.Join(a.OnCall, ", ")
+}
+
+func (a ChatAlert) threadText() string {
+	if a.ThreadCode == "" {
+		return a.ThreadID
+	}
+	return fmt.Sprintf("#%s (%s)", a.ThreadCode, a.ThreadID)
+}
+
+// fields returns the alert's labelled values in display order, leaving out
+// empty ones.
+func (a ChatAlert) fields() [][2]string {
+	var fields [][2]string
+	for _, field := range [][2]string{
+		{"From", a.From},
+		{"Message", a.Body},
+		{"Thread", a.threadText()},
+		{"Time", a.Time},
+		{"On call", a.onCallText()},
+	} {
+		if field[1] != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// payload renders the alert in the webhook's format.
+func (w ChatWebhook) payload(alert ChatAlert) any {
+	switch w.Format {
+	case ChatFormatSlack:
+		return slackPayload(alert)
+	case ChatFormatDiscord:
+		return discordPayload(alert)
+	default:
+		return matrixPayload(alert)
+	}
+}
+
+// slackEscape escapes the characters Slack treats as markup, so reporter
+// text cannot mention users or channels.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func slackPayload(alert ChatAlert) map[string]any {
+	var fallback []string
+	var fields []map[string]string
+	for _, field := range alert.fields() {
+		fallback = append(fallback, field[0]+": "+slackEscape(field[1]))
+		fields = append(fields, map[string]string{
+			"type": "mrkdwn",
+			"text": "*" + field[0] + "*\n" + slackEscape(field[1]),
+		})
+	}
+
+	return map[string]any{
+		"text": slackEscape(alert.Title) + "\n" + strings.Join(fallback, "\n"),
+		"blocks": []map[string]any{
+			{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": alert.Title},
+			},
+			{
+				"type":   "section",
+				"fields": fields,
+			},
+		},
+	}
+}
+
+func discordPayload(alert ChatAlert) map[string]any {
+	var fields []map[string]any
+	for _, field := range alert.fields() {
+		fields = append(fields, map[string]any{
+			"name":   field[0],
+			"value":  field[1],
+			"inline": field[0] != "Message",
+		})
+	}
+
+	return map[string]any{
+		"embeds": []map[string]any{
+			{
+				"title":  alert.Title,
+				"color":  0xd32f2f,
+				"fields": fields,
+			},
+		},
+		// Reporter text must never ping @everyone or roles.
+		"allowed_mentions": map[string]any{"parse": []string{}},
+	}
+}
+
+func matrixPayload(alert ChatAlert) map[string]any {
+	text := []string{alert.Title}
+	htmlLines := []string{"<strong>" + html.EscapeString(alert.Title) + "</strong>"}
+	for _, field := range alert.fields() {
+		text = append(text, field[0]+": "+field[1])
+		htmlLines = append(htmlLines, "<b>"+field[0]+":</b> "+strings.ReplaceAll(html.EscapeString(field[1]), "\n", "<br>"))
+	}
+
+	return map[string]any{
+		"text": strings.Join(text, "\n"),
+		"html": strings.Join(htmlLines, "<br>"),
+	}
+}
+
+// post sends the alert to the webhook.
+func (w ChatWebhook) post(ctx context.Context, alert ChatAlert) error {
+	body, err := json.Marshal(w.payload(alert))
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := chatHTTPClient.Do(req)
+	if err != nil {
+		// The error includes the URL, which must stay out of logs.
+		return fmt.Errorf("request failed: %w", errorWithoutURL(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// errorWithoutURL strips the request URL from HTTP client errors.
+func errorWithoutURL(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+// RegisterChatWebhook adds a group chat that receives new thread and missed
+// call alerts.
+func (h *handlers) RegisterChatWebhook(webhook ChatWebhook) {
+	h.ChatWebhooks = append(h.ChatWebhooks, webhook)
+}
+
+// broadcastToChat posts an alert to every chat webhook and records one
+// outbound message with a delivery per webhook.
+func (h *handlers) broadcastToChat(ctx context.Context, notification Notification, onCall []storage.Staff) {
+	if len(h.ChatWebhooks) == 0 {
+		return
+	}
+
+	alert := newChatAlert(notification, onCall)
+
+	deliveries := make([]storage.MessageDelivery, 0, len(h.ChatWebhooks))
+	to := make([]string, 0, len(h.ChatWebhooks))
+	for _, webhook := range h.ChatWebhooks {
+		delivery := storage.MessageDelivery{Channel: ChannelChat, To: webhook.name()}
+		if err := webhook.post(ctx, alert); err != nil {
+			log.Printf("Error posting to chat webhook %s: %v", webhook.name(), err)
+			delivery.Error = err.Error()
+		} else {
+			log.Printf("Posted to chat webhook %s", webhook.name())
+		}
+		deliveries = append(deliveries, delivery)
+		to = append(to, delivery.To)
+	}
+
+	h.recordMessage(ctx, storage.Message{
+		ThreadID:   notification.ThreadID,
+		Direction:  DirectionOutbound,
+		Channel:    ChannelChat,
+		Kind:       notification.Kind,
+		To:         to,
+		Body:       notification.Body,
+		Deliveries: deliveries,
+	})
+}
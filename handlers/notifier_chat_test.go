@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseChatWebhooks(t *testing.T) {
+	webhooks, err := ParseChatWebhooks("slack=https://hooks.slack.com/services/T/B/X, Discord=https://discord.com/api/webhooks/1/abc")
+	if err != nil {
+		t.Fatalf("ParseChatWebhooks: %v", err)
+	}
+	if len(webhooks) != 2 {
+		t.Fatalf("got %d webhooks, want 2", len(webhooks))
+	}
+	if webhooks[1].Format != ChatFormatDiscord || webhooks[1].URL != "https://discord.com/api/webhooks/1/abc" {
+		t.Fatalf("second webhook = %+v", webhooks[1])
+	}
+	if webhooks[0].name() != "slack@hooks.slack.com" {
+		t.Fatalf("name = %q, want the URL secret left out", webhooks[0].name())
+	}
+
+	for _, value := range []string{
+		"https://hooks.slack.com/services/T/B/X",
+		"teams=https://example.org/hook",
+		"slack=ftp://example.org/hook",
+	} {
+		if _, err := ParseChatWebhooks(value); err == nil {
+			t.Errorf("ParseChatWebhooks(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestChatWebhookPost(t *testing.T) {
+	threadID := bson.NewObjectID()
+	alert := newChatAlert(Notification{
+		Kind:     MessageKindStaffNotification,
+		Body:     "rendered SMS",
+		ThreadID: threadID,
+		Vars: map[string]string{
+			"from": "+14158675309",
+			"body": "Help <!channel> @everyone <b>now</b>",
+			"code": "K7QF",
+			"time": "Mon, 02 Mar 2026 09:00:00 PST",
+		},
+	}, []storage.Staff{{PhoneNumber: "+15105550101"}, {PhoneNumber: "+15105550102"}})
+
+	tests := []struct {
+		format  string
+		want    []string
+		notWant []string
+	}{
+		{
+			format:  ChatFormatSlack,
+			want:    []string{"Dispatch message", "+14158675309", "#K7QF (" + threadID.Hex() + ")", "+15105550101, +15105550102", "&lt;!channel&gt;"},
+			notWant: []string{"<!channel>"},
+		},
+		{
+			format: ChatFormatDiscord,
+			want:   []string{`"embeds"`, `"allowed_mentions":{"parse":[]}`, "+15105550102", "Mon, 02 Mar 2026 09:00:00 PST"},
+		},
+		{
+			format:  ChatFormatMatrix,
+			want:    []string{`"html"`, "&lt;b&gt;now&lt;/b&gt;", "<b>Thread:</b> #K7QF"},
+			notWant: []string{"<b>now</b><br>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+				}
+				raw, _ := io.ReadAll(r.Body)
+				body = string(raw)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			webhook := ChatWebhook{Format: tt.format, URL: server.URL}
+			if err := webhook.post(context.Background(), alert); err != nil {
+				t.Fatalf("post: %v", err)
+			}
+
+			// Compare against the decoded form so JSON escaping of <, > and &
+			// does not matter.
+			var decoded any
+			if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+				t.Fatalf("payload is not JSON: %v", err)
+			}
+			plain, _ := json.Marshal(decoded)
+			text := strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(string(plain))
+
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("payload is missing %q:\n%s", want, text)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(text, notWant) {
+					t.Errorf("payload contains %q:\n%s", notWant, text)
+				}
+			}
+		})
+	}
+}
+
+func TestChatWebhookPostErrorHidesURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	webhook := ChatWebhook{Format: ChatFormatSlack, URL: server.URL + "/services/secret"}
+	err := webhook.post(context.Background(), ChatAlert{Title: "Missed call"})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("post error = %v, want 403 status", err)
+	}
+
+	server.Close()
+	err = webhook.post(context.Background(), ChatAlert{Title: "Missed call"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("post error = %v, want an error without the URL", err)
+	}
+}
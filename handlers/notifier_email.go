@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+)
+
+// ChannelEmail is the notifier channel for staff alerts sent by email.
+const ChannelEmail = "EMAIL"
+
+// emailTimeout bounds each email, so a slow SMTP server cannot hold up the
+// webhook that raised the alert.
+const emailTimeout = 10 * time.Second
+
+// EmailNotifier sends staff alerts by email through an SMTP server.
+//
+// SubjectTemplate and BodyTemplate are rendered with the alert's template
+// variables plus {{message}}, the alert as it would be sent by SMS.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address, e.g. "Dispatch <dispatch@example.org>".
+	From            string
+	SubjectTemplate string
+	BodyTemplate    string
+}
+
+func (n *EmailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, recipients []storage.Staff, notification Notification) []storage.MessageDelivery {
+	vars := map[string]string{"message": notification.Body}
+	for key, value := range notification.Vars {
+		vars[key] = value
+	}
+
+	subject := utils.ReplaceTemplateVars(n.SubjectTemplate, vars)
+	body := utils.ReplaceTemplateVars(n.BodyTemplate, vars)
+
+	deliveries := make([]storage.MessageDelivery, 0, len(recipients))
+	for _, member := range recipients {
+		delivery := storage.MessageDelivery{Channel: ChannelEmail, To: member.Email}
+
+		if member.Email == "" {
+			log.Printf("Error sending email to staff member %s: no email address", member.PublicID)
+			delivery.To = member.PhoneNumber
+			delivery.Error = "staff member has no email address"
+		} else if err := n.send(ctx, member.Email, subject, body); err != nil {
+			log.Printf("Error sending email to %s: %v", member.Email, err)
+			delivery.Error = err.Error()
+		} else {
+			log.Printf("Sent email to %s", member.Email)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries
+}
+
+// send delivers one email, giving up at emailTimeout or when ctx ends.
+// Authentication is only attempted when a username is configured.
+func (n *EmailNotifier) send(ctx context.Context, to string, subject string, body string) error {
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildEmail(from.String(), to, subject, body, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// buildEmail formats a plain text email. The subject is encoded so that
+// reporter text in it cannot add headers.
+func buildEmail(from string, to string, subject string, body string, date time.Time) []byte {
+	subject = strings.Join(strings.Fields(subject), " ")
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+// smtpSink is a minimal SMTP server that accepts every message and keeps it
+// for inspection. Recipients in reject are refused at RCPT TO.
+type smtpSink struct {
+	listener net.Listener
+	reject   map[string]bool
+
+	mu       sync.Mutex
+	messages []sinkMessage
+}
+
+type sinkMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newSMTPSink(t *testing.T, reject ...string) *smtpSink {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	sink := &smtpSink{listener: listener, reject: make(map[string]bool)}
+	for _, address := range reject {
+		sink.reject[address] = true
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+	return sink
+}
+
+func (s *smtpSink) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 sink ready")
+
+	var current sinkMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 sink")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			current = sinkMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			to := strings.Trim(line[len("RCPT TO:"):], "<> ")
+			if s.reject[to] {
+				text.PrintfLine("550 no such user")
+				continue
+			}
+			current.To = append(current.To, to)
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			current.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case command == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpSink) received() []sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMessage(nil), s.messages...)
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sink := newSMTPSink(t, "bounce@example.org")
+
+	notifier := &EmailNotifier{
+		Host:            "127.0.0.1",
+		Port:            sink.port(),
+		From:            "Dispatch <dispatch@example.org>",
+		SubjectTemplate: "Dispatch alert from {{from}}",
+		BodyTemplate:    "{{message}}\n\nThread #{{code}}",
+	}
+
+	recipients := []storage.Staff{
+		{PhoneNumber: "+15105550101", Email: "alex@example.org"},
+		{PhoneNumber: "+15105550102", Email: "bounce@example.org"},
+		{PhoneNumber: "+15105550103"},
+	}
+
+	deliveries := notifier.Notify(context.Background(), recipients, Notification{
+		Kind: MessageKindStaffNotification,
+		Body: "Dispatch message received",
+		Vars: map[string]string{
+			"from": "+14158675309",
+			"code": "K7QF",
+		},
+	})
+
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d deliveries, want 3", len(deliveries))
+	}
+	if deliveries[0].Error != "" || deliveries[0].To != "alex@example.org" {
+		t.Fatalf("first delivery = %+v, want success to alex@example.org", deliveries[0])
+	}
+	if deliveries[1].Error == "" {
+		t.Fatalf("second delivery = %+v, want rejected recipient error", deliveries[1])
+	}
+	if deliveries[2].Error == "" || deliveries[2].To != "+15105550103" {
+		t.Fatalf("third delivery = %+v, want missing address error", deliveries[2])
+	}
+
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+
+	got := messages[0]
+	if got.From != "dispatch@example.org" {
+		t.Fatalf("envelope sender = %q", got.From)
+	}
+	if len(got.To) != 1 || got.To[0] != "alex@example.org" {
+		t.Fatalf("envelope recipients = %v", got.To)
+	}
+	// The sink reads DATA with textproto, which turns CRLF into LF.
+	for _, want := range []string{
+		"Subject: Dispatch alert from +14158675309\n",
+		"To: alex@example.org\n",
+		"Dispatch message received\n\nThread #K7QF",
+	} {
+		if !strings.Contains(got.Data, want) {
+			t.Fatalf("message is missing %q:\n%s", want, got.Data)
+		}
+	}
+}
+
+func TestBuildEmailSubjectCannotAddHeaders(t *testing.T) {
+	msg := string(buildEmail("dispatch@example.org", "alex@example.org", "hello\r\nBcc: victim@example.org", "body", time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)))
+
+	header, _, _ := strings.Cut(msg, "\r\n\r\n")
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Fatalf("subject injected a header:\n%s", header)
+	}
+	if !strings.Contains(header, "Subject: hello Bcc: victim@example.org\r\n") {
+		t.Fatalf("unexpected subject line:\n%s", header)
+	}
+}
+
+func TestEmailNotifierInvalidSender(t *testing.T) {
+	notifier := &EmailNotifier{Host: "127.0.0.1", Port: 1, From: "not an address"}
+
+	deliveries := notifier.Notify(context.Background(), []storage.Staff{{Email: "alex@example.org"}}, Notification{})
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Error, "invalid sender address") {
+		t.Fatalf("deliveries = %+v, want invalid sender error", deliveries)
+	}
+}
+
+func TestEmailNotifierGivesUpOnSilentServer(t *testing.T) {
+	// The server accepts connections but never greets, like a blackholed
+	// SMTP host.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	notifier := &EmailNotifier{
+		Host: "127.0.0.1",
+		Port: listener.Addr().(*net.TCPAddr).Port,
+		From: "dispatch@example.org",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	deliveries := notifier.Notify(ctx, []storage.Staff{{Email: "alex@example.org"}}, Notification{})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Notify took %s, want it to stop when the context ends", elapsed)
+	}
+	if len(deliveries) != 1 || deliveries[0].Error == "" {
+		t.Fatalf("deliveries = %+v, want a timeout error", deliveries)
+	}
+}
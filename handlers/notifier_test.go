@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+// failingNotifier is an EMAIL notifier whose every delivery fails.
+type failingNotifier struct {
+	recipients []string
+}
+
+func (n *failingNotifier) Channel() string {
+	return ChannelEmail
+}
+
+func (n *failingNotifier) Notify(ctx context.Context, recipients []storage.Staff, notification Notification) []storage.MessageDelivery {
+	deliveries := make([]storage.MessageDelivery, 0, len(recipients))
+	for _, member := range recipients {
+		n.recipients = append(n.recipients, member.PhoneNumber)
+		deliveries = append(deliveries, storage.MessageDelivery{Channel: ChannelEmail, To: member.Email, Error: "mail server unavailable"})
+	}
+	return deliveries
+}
+
+func TestNotifyStaffDeliversDespiteFailingChannel(t *testing.T) {
+	h, store, notifier := newTestService(t)
+	messages := &recordingMessages{MessageRepository: store.Messages}
+	h.Store.Messages = messages
+	email := &failingNotifier{}
+	h.RegisterNotifier(email)
+
+	staff := []storage.Staff{
+		{PhoneNumber: "+15105550101", Email: "a@example.org", Channels: []string{ChannelSMS, ChannelEmail}},
+		{PhoneNumber: "+15105550102"},
+	}
+	h.notifyStaff(context.Background(), staff, Notification{Kind: MessageKindStaffNotification, From: testOutboundNumber, Body: "New message"})
+
+	if got, want := notifier.recipients(), []string{"+15105550101", "+15105550102"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("texted %v, want %v", got, want)
+	}
+	if want := []string{"+15105550101"}; !reflect.DeepEqual(email.recipients, want) {
+		t.Errorf("emailed %v, want %v", email.recipients, want)
+	}
+
+	byChannel := map[string]storage.Message{}
+	for _, message := range messages.inserted {
+		byChannel[message.Channel] = message
+	}
+	if sms := byChannel[ChannelSMS]; len(sms.Deliveries) != 2 || sms.Deliveries[0].Error != "" || sms.Deliveries[1].Error != "" {
+		t.Errorf("SMS record = %+v, want two successful deliveries", sms)
+	}
+	if failed := byChannel[ChannelEmail]; len(failed.Deliveries) != 1 || failed.Deliveries[0].Error == "" {
+		t.Errorf("EMAIL record = %+v, want one failed delivery", failed)
+	}
+}
+
+func TestNotifyStaffChannels(t *testing.T) {
+	tests := []struct {
+		name      string
+		staff     storage.Staff
+		wantSMS   []string
+		wantError bool
+	}{
+		{name: "no channels defaults to SMS", staff: storage.Staff{PhoneNumber: "+15105550101"}, wantSMS: []string{"+15105550101"}},
+		{name: "email only is not texted", staff: storage.Staff{PhoneNumber: "+15105550101", Email: "a@example.org", Channels: []string{ChannelEmail}}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, notifier := newTestService(t)
+			messages := &recordingMessages{MessageRepository: store.Messages}
+			h.Store.Messages = messages
+
+			h.notifyStaff(context.Background(), []storage.Staff{tt.staff}, Notification{Kind: MessageKindStaffNotification, From: testOutboundNumber, Body: "New message"})
+
+			if got := notifier.recipients(); !reflect.DeepEqual(got, tt.wantSMS) {
+				t.Errorf("texted %v, want %v", got, tt.wantSMS)
+			}
+
+			// No EMAIL notifier is registered, so an EMAIL delivery is
+			// recorded as failed.
+			if len(messages.inserted) != 1 {
+				t.Fatalf("stored %+v, want one message", messages.inserted)
+			}
+			delivery := messages.inserted[0].Deliveries[0]
+			if (delivery.Error != "") != tt.wantError {
+				t.Errorf("delivery = %+v, want error %v", delivery, tt.wantError)
+			}
+		})
+	}
+}
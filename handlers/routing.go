@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Routing modes decide who is alerted about a new thread.
+const (
+	// RoutingModeAll alerts the whole on-call group.
+	RoutingModeAll = "ALL"
+	// RoutingModeRoundRobin takes turns through the group.
+	RoutingModeRoundRobin = "ROUND_ROBIN"
+	// RoutingModeLeastRecent alerts whoever was alerted least recently.
+	RoutingModeLeastRecent = "LEAST_RECENT"
+)
+
+// roundRobinCursorKey is the config entry holding the phone number of the
+// last staff member picked by round-robin routing.
+const roundRobinCursorKey = "routing_round_robin_last"
+
+// threadAlertRecipients returns the staff to alert about a text on a thread.
+// A new thread goes to one responder picked from its group unless routing
+// mode is ALL. Later texts go to that responder until the group is alerted.
+func (h *handlers) threadAlertRecipients(ctx context.Context, thread *storage.Thread, isNew bool) ([]storage.Staff, error) {
+	if !isNew && thread.AssignedTo != "" && thread.GroupAlertAt != nil {
+		assigned, err := h.Store.Staff.FindByPublicID(ctx, thread.AssignedTo)
+		if err != nil {
+			log.Printf("Error finding assigned staff for thread %s: %v", thread.Code, err)
+		} else if assigned != nil && assigned.Active {
+			return []storage.Staff{*assigned}, nil
+		}
+	}
+
+	group, err := h.threadAlertGroup(ctx, thread, isNew)
+	if err != nil || !isNew {
+		return group, err
+	}
+
+	return h.routeThread(ctx, thread, group)
+}
+
+// routeThread picks one responder from the group for a new thread and
+// schedules the rest of the group to be alerted if the thread is not
+// acknowledged in time. Threads are not routed while an escalation policy
+// is set.
+func (h *handlers) routeThread(ctx context.Context, thread *storage.Thread, group []storage.Staff) ([]storage.Staff, error) {
+	mode := h.Config.RoutingMode
+	if mode == "" || mode == RoutingModeAll || len(group) <= 1 {
+		return group, nil
+	}
+
+	// An escalation policy takes over routing. Its tiers already decide who
+	// hears about a thread first and who is alerted after them.
+	policy, err := h.getEscalationPolicy(ctx)
+	if err != nil {
+		log.Printf("Error loading escalation policy, routing thread %s: %v", thread.Code, err)
+	}
+	if policy != nil {
+		return group, nil
+	}
+
+	var picked storage.Staff
+	switch mode {
+	case RoutingModeRoundRobin:
+		picked = h.nextRoundRobin(ctx, group)
+	case RoutingModeLeastRecent:
+		picked = pickLeastRecent(group)
+	default:
+		log.Printf("Unknown routing mode %q, alerting the whole group", mode)
+		return group, nil
+	}
+
+	groupAlertAt := time.Now().Add(h.Config.RoutingAckTimeout)
+	if err := h.Store.Threads.Assign(ctx, thread.ID, picked.PublicID, groupAlertAt); err != nil {
+		log.Printf("Error assigning thread %s, alerting the whole group: %v", thread.Code, err)
+		return group, nil
+	}
+
+	thread.AssignedTo = picked.PublicID
+	thread.GroupAlertAt = &groupAlertAt
+
+	log.Printf("Routing thread %s to %s (%s)", thread.Code, staffLabel(picked), mode)
+	return []storage.Staff{picked}, nil
+}
+
+// roundRobinAttempts bounds how often nextRoundRobin retries after losing a
+// race to move the cursor.
+const roundRobinAttempts = 5
+
+// roundRobinBackoff is the longest nextRoundRobin waits before retrying.
+const roundRobinBackoff = 20 * time.Millisecond
+
+// nextRoundRobin picks the group member after the last one picked and moves
+// the cursor to them. The cursor only moves if nobody moved it since it was
+// read, so threads opened at the same time go to different responders. After
+// roundRobinAttempts lost races it gives up on moving the cursor and returns
+// the member after the last position it read.
+func (h *handlers) nextRoundRobin(ctx context.Context, group []storage.Staff) storage.Staff {
+	var last string
+	for attempt := range roundRobinAttempts {
+		if attempt > 0 {
+			// Back off a little so racing writers stop colliding.
+			select {
+			case <-ctx.Done():
+			case <-time.After(rand.N(roundRobinBackoff)):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		var err error
+		last, err = h.Store.Config.Get(ctx, roundRobinCursorKey)
+		if err != nil {
+			log.Printf("Error reading round-robin position, starting over: %v", err)
+			return pickRoundRobin(group, "")
+		}
+
+		picked := pickRoundRobin(group, last)
+		moved, err := h.Store.Config.CompareAndSet(ctx, roundRobinCursorKey, last, picked.PhoneNumber)
+		if err != nil {
+			log.Printf("Error saving round-robin position: %v", err)
+			return picked
+		}
+		if moved {
+			return picked
+		}
+	}
+
+	log.Printf("Round-robin position kept changing, picking without moving it")
+	return pickRoundRobin(group, last)
+}
+
+// pickRoundRobin returns the group member after the one with phone number
+// last, in phone number order, wrapping around to the first.
+func pickRoundRobin(group []storage.Staff, last string) storage.Staff {
+	sorted := append([]storage.Staff(nil), group...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PhoneNumber < sorted[j].PhoneNumber })
+
+	for _, member := range sorted {
+		if member.PhoneNumber > last {
+			return member
+		}
+	}
+	return sorted[0]
+}
+
+// pickLeastRecent returns the group member alerted longest ago. Members who
+// were never alerted come first, then ties go by phone number.
+func pickLeastRecent(group []storage.Staff) storage.Staff {
+	picked := group[0]
+	for _, member := range group[1:] {
+		if alertedBefore(member, picked) {
+			picked = member
+		}
+	}
+	return picked
+}
+
+func alertedBefore(a storage.Staff, b storage.Staff) bool {
+	switch {
+	case a.LastAlertedAt == nil && b.LastAlertedAt == nil:
+		return a.PhoneNumber < b.PhoneNumber
+	case a.LastAlertedAt == nil:
+		return true
+	case b.LastAlertedAt == nil:
+		return false
+	case a.LastAlertedAt.Equal(*b.LastAlertedAt):
+		return a.PhoneNumber < b.PhoneNumber
+	default:
+		return a.LastAlertedAt.Before(*b.LastAlertedAt)
+	}
+}
+
+// markStaffAlerted records when staff were last alerted, for least-recent
+// routing.
+func (h *handlers) markStaffAlerted(ctx context.Context, staff []storage.Staff, at time.Time) {
+	var ids []bson.ObjectID
+	for _, member := range staff {
+		if !member.ID.IsZero() {
+			ids = append(ids, member.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	if err := h.Store.Staff.MarkAlerted(ctx, ids, at); err != nil {
+		log.Printf("Error recording staff alert time: %v", err)
+	}
+}
+
+// AlertUnacknowledgedThreads alerts the whole group for every routed thread
+// its responder did not acknowledge in time.
+func (h *handlers) AlertUnacknowledgedThreads(ctx context.Context) {
+	for {
+		// Claim the thread by clearing its due time, so the group is alerted
+		// once even if several loops run.
+		thread, err := h.Store.Threads.ClaimDueGroupAlert(ctx, time.Now())
+		if err != nil {
+			log.Printf("Routing: error claiming thread: %v", err)
+			return
+		}
+		if thread == nil {
+			return
+		}
+
+		if err := h.alertThreadGroup(ctx, thread); err != nil {
+			log.Printf("Routing: error alerting group for thread %s: %v", thread.Code, err)
+		}
+	}
+}
+
+// alertThreadGroup alerts everyone in a thread's group except the responder
+// who already had it.
+func (h *handlers) alertThreadGroup(ctx context.Context, thread *storage.Thread) error {
+	group, err := h.threadAlertGroup(ctx, thread, false)
+	if err != nil {
+		return err
+	}
+
+	var rest []storage.Staff
+	for _, member := range group {
+		if member.PublicID != thread.AssignedTo {
+			rest = append(rest, member)
+		}
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+
+	body, err := h.lastStaffAlert(ctx, thread.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find alert: %w", err)
+	}
+
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Routing: thread %s not acknowledged, alerting %d more staff", thread.Code, len(rest))
+
+	h.notifyStaff(ctx, rest, Notification{
+		Kind:     MessageKindEscalation,
+		From:     phoneConfig.Outbound,
+		Body:     fmt.Sprintf("UNACKNOWLEDGED (assigned responder did not reply)\n\n%s", body),
+		ThreadID: thread.ID,
+	})
+	return nil
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func TestPickRoundRobin(t *testing.T) {
+	group := []storage.Staff{
+		{PhoneNumber: "+15550000003"},
+		{PhoneNumber: "+15550000001"},
+		{PhoneNumber: "+15550000002"},
+	}
+
+	tests := []struct {
+		name string
+		last string
+		want string
+	}{
+		{"first pick", "", "+15550000001"},
+		{"next in order", "+15550000001", "+15550000002"},
+		{"wraps around", "+15550000003", "+15550000001"},
+		{"last no longer on call", "+15550000000", "+15550000001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickRoundRobin(group, tt.last); got.PhoneNumber != tt.want {
+				t.Errorf("pickRoundRobin(%q) = %s, want %s", tt.last, got.PhoneNumber, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickLeastRecent(t *testing.T) {
+	earlier := time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		group []storage.Staff
+		want  string
+	}{
+		{
+			name: "oldest alert",
+			group: []storage.Staff{
+				{PhoneNumber: "+15550000001", LastAlertedAt: &later},
+				{PhoneNumber: "+15550000002", LastAlertedAt: &earlier},
+			},
+			want: "+15550000002",
+		},
+		{
+			name: "never alerted first",
+			group: []storage.Staff{
+				{PhoneNumber: "+15550000001", LastAlertedAt: &earlier},
+				{PhoneNumber: "+15550000002"},
+			},
+			want: "+15550000002",
+		},
+		{
+			name: "ties by phone number",
+			group: []storage.Staff{
+				{PhoneNumber: "+15550000002", LastAlertedAt: &earlier},
+				{PhoneNumber: "+15550000001", LastAlertedAt: &earlier},
+			},
+			want: "+15550000001",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickLeastRecent(tt.group); got.PhoneNumber != tt.want {
+				t.Errorf("pickLeastRecent = %s, want %s", got.PhoneNumber, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrentRoundRobinTakesTurns(t *testing.T) {
+	const rounds = 3
+
+	forEachStore(t, func(t *testing.T, store storage.Store) {
+		h, _, _ := newTestService(t)
+		h.Store = store
+		h.Config.RoutingMode = RoutingModeRoundRobin
+		h.Config.RoutingAckTimeout = 5 * time.Minute
+
+		group := []storage.Staff{
+			addStaff(t, store, "+15105550101", true),
+			addStaff(t, store, "+15105550102", true),
+			addStaff(t, store, "+15105550103", true),
+		}
+
+		picks := make([]string, rounds*len(group))
+		var wg sync.WaitGroup
+		for i := range picks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				picks[i] = h.nextRoundRobin(context.Background(), group).PhoneNumber
+			}()
+		}
+		wg.Wait()
+
+		counts := map[string]int{}
+		for _, phoneNumber := range picks {
+			counts[phoneNumber]++
+		}
+		for _, member := range group {
+			if counts[member.PhoneNumber] != rounds {
+				t.Errorf("picked %s %d times, want %d (picks %v)", member.PhoneNumber, counts[member.PhoneNumber], rounds, picks)
+			}
+		}
+	})
+}
+
+// contendedConfig is a config repository where another writer always moves
+// the round-robin cursor first.
+type contendedConfig struct {
+	storage.ConfigRepository
+	attempts int
+}
+
+func (c *contendedConfig) CompareAndSet(ctx context.Context, key string, old string, value string) (bool, error) {
+	c.attempts++
+	return false, nil
+}
+
+func TestRoundRobinGivesUpOnContendedCursor(t *testing.T) {
+	h, store, _ := newTestService(t)
+	group := []storage.Staff{
+		addStaff(t, store, "+15105550101", true),
+		addStaff(t, store, "+15105550102", true),
+	}
+	if err := store.Config.Set(context.Background(), roundRobinCursorKey, "+15105550101"); err != nil {
+		t.Fatal(err)
+	}
+	config := &contendedConfig{ConfigRepository: store.Config}
+	h.Store.Config = config
+
+	if picked := h.nextRoundRobin(context.Background(), group); picked.PhoneNumber != "+15105550102" {
+		t.Errorf("picked %s, want +15105550102", picked.PhoneNumber)
+	}
+	if config.attempts != roundRobinAttempts {
+		t.Errorf("tried %d times, want %d", config.attempts, roundRobinAttempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config.attempts = 0
+	if picked := h.nextRoundRobin(ctx, group); picked.PhoneNumber != "+15105550101" {
+		t.Errorf("picked %s with a cancelled context, want +15105550101", picked.PhoneNumber)
+	}
+	if config.attempts != 0 {
+		t.Errorf("tried %d times with a cancelled context, want 0", config.attempts)
+	}
+}
+
+func TestEscalationPolicyTakesOverRouting(t *testing.T) {
+	ctx := context.Background()
+	h, store, _ := newTestService(t)
+	h.Config.RoutingMode = RoutingModeRoundRobin
+	h.Config.RoutingAckTimeout = 5 * time.Minute
+	addStaff(t, store, "+15105550101", true)
+	addStaff(t, store, "+15105550102", true)
+
+	routed := addThread(t, store, "+14155550123", "ABCD")
+	recipients, err := h.threadAlertRecipients(ctx, &routed, true)
+	if err != nil || len(recipients) != 1 || routed.AssignedTo == "" {
+		t.Fatalf("without a policy: recipients = %v, %v, assigned to %q, want one routed responder", recipients, err, routed.AssignedTo)
+	}
+
+	if _, err := store.Escalation.Save(ctx, storage.EscalationPolicy{
+		Name:  "everyone",
+		Tiers: []storage.EscalationTier{{Target: EscalationTargetAllActive, TimeoutSeconds: 60}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	thread := addThread(t, store, "+14155550124", "EFGH")
+	recipients, err = h.threadAlertRecipients(ctx, &thread, true)
+	if err != nil || len(recipients) != 2 {
+		t.Errorf("with a policy: recipients = %v, %v, want the whole first tier", recipients, err)
+	}
+
+	stored, err := store.Threads.FindByID(ctx, thread.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("FindByID = %v, %v", stored, err)
+	}
+	if stored.AssignedTo != "" || stored.GroupAlertAt != nil {
+		t.Errorf("thread assigned to %q with group alert at %v, want it left to the escalation policy", stored.AssignedTo, stored.GroupAlertAt)
+	}
+}
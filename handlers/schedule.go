@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+)
+
+// isValidClockTime reports whether s is a 24-hour HH:MM time. Schedule times
+// are compared as strings, so "9:00" must be written as "09:00".
+func isValidClockTime(s string) bool {
+	if len(s) != 5 || s[2] != ':' {
+		return false
+	}
+
+	_, err := time.Parse("15:04", s)
+	return err == nil
+}
+
+// isValidDate reports whether s is a YYYY-MM-DD date.
+func isValidDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+var locationCache sync.Map
+
+// loadLocation loads an IANA time zone, caching the result.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locationCache.Store(name, loc)
+	return loc, nil
+}
+
+// scheduleLocation returns the schedule's own time zone, or fallback if it has none
+// or it cannot be loaded.
+func scheduleLocation(s storage.Schedule, fallback *time.Location) *time.Location {
+	if s.Timezone == "" {
+		return fallback
+	}
+
+	loc, err := loadLocation(s.Timezone)
+	if err != nil {
+		log.Printf("Schedule %s has unknown timezone %q, using %s", s.ID.Hex(), s.Timezone, fallback)
+		return fallback
+	}
+
+	return loc
+}
+
+// validateSchedule checks the fields of a schedule entry. It does not check
+// that the phone number belongs to a staff member.
+func validateSchedule(s storage.Schedule) error {
+	if !utils.IsValidPhoneNumber(s.PhoneNumber) {
+		return fmt.Errorf("phone_number must be in E.164 format, e.g. +15105550123")
+	}
+
+	if s.Timezone != "" {
+		if _, err := loadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("timezone must be an IANA time zone, e.g. America/Los_Angeles")
+		}
+	}
+
+	if s.Date != "" && !isValidDate(s.Date) {
+		return fmt.Errorf("date must be in YYYY-MM-DD format")
+	}
+
+	if s.Tier < 0 || s.Tier > maxScheduleTier {
+		return fmt.Errorf("tier must be between 1 and %d", maxScheduleTier)
+	}
+
+	if s.Always {
+		return nil
+	}
+
+	if !isValidClockTime(s.StartTime) {
+		return fmt.Errorf("start_time must be in HH:MM 24-hour format, e.g. 09:00")
+	}
+
+	if !isValidClockTime(s.EndTime) {
+		return fmt.Errorf("end_time must be in HH:MM 24-hour format, e.g. 17:30")
+	}
+
+	// An end before the start is an overnight shift that ends the next day.
+	if s.EndTime == s.StartTime {
+		return fmt.Errorf("end_time must differ from start_time; use always for round-the-clock cover")
+	}
+
+	if s.Recurring {
+		if s.DayOfWeek < 0 || s.DayOfWeek > 6 {
+			return fmt.Errorf("day_of_week must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	} else if s.Date == "" {
+		return fmt.Errorf("date is required for schedules that are not recurring")
+	}
+
+	return nil
+}
+
+// maxScheduleTier is the highest escalation tier a shift can have.
+const maxScheduleTier = 9
+
+// scheduleTier returns the shift's escalation tier, treating an unset tier as
+// primary.
+func scheduleTier(s storage.Schedule) int {
+	if s.Tier == 0 {
+		return 1
+	}
+	return s.Tier
+}
+
+// crossesMidnight reports whether a schedule's shift ends on the day after it
+// starts, e.g. 22:00-06:00.
+func crossesMidnight(s storage.Schedule) bool {
+	return !s.Always && s.EndTime < s.StartTime
+}
+
+// startsOn reports whether a schedule has a shift starting on the calendar
+// date of date. Recurring entries don't apply before their date, if one is
+// set.
+func startsOn(s storage.Schedule, date time.Time) bool {
+	if s.Always {
+		return true
+	}
+
+	dateStr := date.Format("2006-01-02")
+
+	if s.Recurring {
+		return int(date.Weekday()) == s.DayOfWeek && (s.Date == "" || dateStr >= s.Date)
+	}
+
+	return s.Date == dateStr
+}
+
+// occursOn reports whether any part of a schedule's shift falls on the
+// calendar date of t in the schedule's time zone, or fallback if it has
+// none, including the early-morning end of an overnight shift that started
+// the day before.
+func occursOn(s storage.Schedule, t time.Time, fallback *time.Location) bool {
+	date := t.In(scheduleLocation(s, fallback))
+
+	if startsOn(s, date) {
+		return true
+	}
+
+	return crossesMidnight(s) && startsOn(s, date.AddDate(0, 0, -1))
+}
+
+// coversTime reports whether t falls within a schedule's shift. Start and
+// end times are inclusive and read as wall-clock times in the schedule's
+// time zone, or fallback if it has none. Because the comparison uses the
+// local wall clock, a 09:00 shift starts at 09:00 on both sides of a DST
+// change.
+//
+// An overnight shift belongs to the day it starts on: a recurring Monday
+// (day_of_week 1) entry from 22:00 to 06:00 covers Monday 22:00 through
+// Tuesday 06:00. The Tuesday early-morning hours are not matched by a Tuesday
+// entry.
+func coversTime(s storage.Schedule, t time.Time, fallback *time.Location) bool {
+	if s.Always {
+		return true
+	}
+
+	t = t.In(scheduleLocation(s, fallback))
+
+	clock := t.Format("15:04")
+
+	if !crossesMidnight(s) {
+		return startsOn(s, t) && s.StartTime <= clock && clock <= s.EndTime
+	}
+
+	if startsOn(s, t) && clock >= s.StartTime {
+		return true
+	}
+
+	return startsOn(s, t.AddDate(0, 0, -1)) && clock <= s.EndTime
+}
+
+// findCandidateSchedules returns the schedule entries that may have a shift
+// starting on any of the given dates. Callers narrow the result down with
+// startsOn, occursOn or coversTime.
+func (h *handlers) findCandidateSchedules(ctx context.Context, dates ...time.Time) ([]storage.Schedule, error) {
+	var daysOfWeek []int
+	var dateStrs []string
+	for _, date := range dates {
+		daysOfWeek = append(daysOfWeek, int(date.Weekday()))
+		dateStrs = append(dateStrs, date.Format("2006-01-02"))
+	}
+
+	return h.Store.Schedules.FindCandidates(ctx, daysOfWeek, dateStrs)
+}
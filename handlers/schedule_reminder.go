@@ -5,60 +5,32 @@ import (
 	"log"
 	"time"
 
-	"go.mongodb.org/mongo-driver/v2/bson"
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
 )
 
-// getSchedulesForDate returns all schedule entries that apply to a given date.
-func (h *handlers) getSchedulesForDate(ctx context.Context, date time.Time) ([]Schedule, error) {
-	scheduleCollection := h.ScheduleHandle.Collection()
-
-	dayOfWeek := int(date.Weekday())
-	dateStr := date.Format("2006-01-02")
-
-	filter := bson.M{
-		"$or": []bson.M{
-			{
-				"always": true,
-			},
-			{
-				"recurring":   true,
-				"day_of_week": dayOfWeek,
-			},
-			{
-				"recurring": false,
-				"date":      dateStr,
-			},
-		},
-	}
-
-	cursor, err := scheduleCollection.Find(ctx, filter)
+// getSchedulesForDate returns all schedule entries that apply on the date
+// of at, including overnight shifts from the previous day that end on it.
+// Each entry is read in its own time zone, as in coversTime, so its date may
+// be a day either side of the configured zone's.
+func (h *handlers) getSchedulesForDate(ctx context.Context, at time.Time) ([]storage.Schedule, error) {
+	at = at.In(h.location())
+	candidates, err := h.findCandidateSchedules(ctx, at.AddDate(0, 0, -2), at.AddDate(0, 0, -1), at, at.AddDate(0, 0, 1))
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var schedules []Schedule
-	for cursor.Next(ctx) {
-		var s Schedule
-		if err := cursor.Decode(&s); err != nil {
-			log.Printf("Error decoding schedule: %v", err)
-			continue
+	var schedules []storage.Schedule
+	for _, s := range candidates {
+		if occursOn(s, at, h.location()) {
+			schedules = append(schedules, s)
 		}
-
-		// For recurring schedules, only include if the date is on or after the
-		// schedule's start date (recurring events shouldn't apply retroactively).
-		if s.Recurring && dateStr < s.Date {
-			continue
-		}
-
-		schedules = append(schedules, s)
 	}
 
-	return schedules, cursor.Err()
+	return schedules, nil
 }
 
 // phoneNumbersFromSchedules extracts unique phone numbers from a schedule list.
-func phoneNumbersFromSchedules(schedules []Schedule) map[string]bool {
+func phoneNumbersFromSchedules(schedules []storage.Schedule) map[string]bool {
 	phones := make(map[string]bool)
 	for _, s := range schedules {
 		phones[s.PhoneNumber] = true
@@ -67,8 +39,8 @@ func phoneNumbersFromSchedules(schedules []Schedule) map[string]bool {
 }
 
 // filterAlwaysSchedules returns only schedules with the always flag set.
-func filterAlwaysSchedules(schedules []Schedule) []Schedule {
-	var result []Schedule
+func filterAlwaysSchedules(schedules []storage.Schedule) []storage.Schedule {
+	var result []storage.Schedule
 	for _, s := range schedules {
 		if s.Always {
 			result = append(result, s)
@@ -77,12 +49,38 @@ func filterAlwaysSchedules(schedules []Schedule) []Schedule {
 	return result
 }
 
+// NextReminderTime returns the next time after now, on the hour given, in
+// loc. Days are stepped on the calendar so the reminder keeps its
+// wall-clock hour across DST changes; an hour skipped by a DST change runs at
+// the first valid time after it.
+func NextReminderTime(now time.Time, hour int, loc *time.Location) time.Time {
+	now = now.In(loc)
+
+	next := reminderTimeOn(now.Year(), now.Month(), now.Day(), hour, loc)
+	if !next.After(now) {
+		next = reminderTimeOn(now.Year(), now.Month(), now.Day()+1, hour, loc)
+	}
+
+	return next
+}
+
+// reminderTimeOn returns hour:00 on the given day in loc. time.Date may
+// resolve a time inside a DST gap to before the gap, so such times are moved
+// forward past it.
+func reminderTimeOn(year int, month time.Month, day int, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	if t.Hour() < hour {
+		t = t.Add(time.Duration(hour-t.Hour()) * time.Hour)
+	}
+	return t
+}
+
 // SendScheduleReminders checks for staff who have a schedule block today but
 // did not have one yesterday. These staff receive a reminder SMS so they know
 // their on-call period is starting. Consecutive on-call days will not trigger
 // repeated notifications.
 func (h *handlers) SendScheduleReminders(ctx context.Context, reminderTemplate string) {
-	now := time.Now()
+	now := h.now()
 	yesterday := now.AddDate(0, 0, -1)
 
 	todaySchedules, err := h.getSchedulesForDate(ctx, now)
@@ -127,9 +125,42 @@ func (h *handlers) SendScheduleReminders(ctx context.Context, reminderTemplate s
 		return
 	}
 
-	log.Printf("Schedule reminder: sending reminders to %d staff members", len(toNotify))
+	staff, err := h.getStaffByPhoneNumbers(ctx, toNotify)
+	if err != nil {
+		log.Printf("Schedule reminder: error fetching staff: %v", err)
+		return
+	}
+
+	log.Printf("Schedule reminder: sending reminders to %d staff members", len(staff))
+
+	h.notifyStaff(ctx, staff, Notification{
+		Kind: MessageKindScheduleReminder,
+		From: phoneConfig.Outbound,
+		Body: reminderTemplate,
+	})
+}
+
+// getStaffByPhoneNumbers returns the staff records for the given phone
+// numbers. Numbers without a staff record are returned as SMS-only staff so
+// that schedules entered before the staff member still get reminders.
+func (h *handlers) getStaffByPhoneNumbers(ctx context.Context, phoneNumbers []string) ([]storage.Staff, error) {
+	found, err := h.Store.Staff.FindByPhoneNumbers(ctx, phoneNumbers)
+	if err != nil {
+		return nil, err
+	}
+
+	byPhone := make(map[string]storage.Staff, len(found))
+	for _, member := range found {
+		byPhone[member.PhoneNumber] = member
+	}
 
-	for _, phone := range toNotify {
-		h.sendMessageToGroup(phoneConfig.Outbound, []string{phone}, reminderTemplate)
+	staff := make([]storage.Staff, 0, len(phoneNumbers))
+	for _, phone := range phoneNumbers {
+		member, ok := byPhone[phone]
+		if !ok {
+			member = storage.Staff{PhoneNumber: phone}
+		}
+		staff = append(staff, member)
 	}
+	return staff, nil
 }
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func TestSendScheduleReminders(t *testing.T) {
+	today := time.Now().UTC()
+	yesterday := today.AddDate(0, 0, -1)
+
+	shift := func(phoneNumber string, day time.Time) storage.Schedule {
+		return storage.Schedule{PhoneNumber: phoneNumber, StartTime: "09:00", EndTime: "17:00", Date: day.Format("2006-01-02")}
+	}
+
+	tests := []struct {
+		name      string
+		schedules []storage.Schedule
+		want      []string
+	}{
+		{
+			name:      "shift starting today is reminded",
+			schedules: []storage.Schedule{shift("+15105550101", today)},
+			want:      []string{"+15105550101"},
+		},
+		{
+			name:      "shift continuing from yesterday is not reminded",
+			schedules: []storage.Schedule{shift("+15105550101", yesterday), shift("+15105550101", today)},
+		},
+		{
+			name: "recurring shift on today's weekday is reminded",
+			schedules: []storage.Schedule{
+				{PhoneNumber: "+15105550101", StartTime: "09:00", EndTime: "17:00", DayOfWeek: int(today.Weekday()), Recurring: true},
+			},
+			want: []string{"+15105550101"},
+		},
+		{
+			name:      "always on-call staff are reminded every day",
+			schedules: []storage.Schedule{{PhoneNumber: "+15105550101", Always: true}},
+			want:      []string{"+15105550101"},
+		},
+		{
+			name:      "scheduled number without a staff record is reminded",
+			schedules: []storage.Schedule{shift("+15105550109", today)},
+			want:      []string{"+15105550109"},
+		},
+		{
+			name:      "shift yesterday only is not reminded",
+			schedules: []storage.Schedule{shift("+15105550101", yesterday)},
+		},
+		{
+			name: "no schedules sends nothing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, notifier := newTestService(t)
+			addStaff(t, store, "+15105550101", true)
+			for _, schedule := range tt.schedules {
+				if err := store.Schedules.Insert(context.Background(), schedule); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h.SendScheduleReminders(context.Background(), "You are on call today.")
+
+			if got := notifier.recipients(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("reminded %v, want %v", got, tt.want)
+			}
+			for _, sent := range notifier.sent {
+				if sent.Notification.Kind != MessageKindScheduleReminder || sent.Notification.Body != "You are on call today." {
+					t.Errorf("sent %+v, want a schedule reminder", sent.Notification)
+				}
+			}
+		})
+	}
+}
+
+func TestSendScheduleRemindersUsesScheduleTimezone(t *testing.T) {
+	// The configured zone is always a day or more behind the schedule's, so
+	// their calendar dates never agree.
+	server, err := time.LoadLocation("Pacific/Pago_Pago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduleZone, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	shift := func(day time.Time) storage.Schedule {
+		return storage.Schedule{PhoneNumber: "+15105550101", StartTime: "09:00", EndTime: "17:00", Date: day.Format("2006-01-02"), Timezone: scheduleZone.String()}
+	}
+
+	tests := []struct {
+		name     string
+		schedule storage.Schedule
+		want     []string
+	}{
+		{name: "today in the schedule's zone", schedule: shift(now.In(scheduleZone)), want: []string{"+15105550101"}},
+		{name: "today in the configured zone only", schedule: shift(now.In(server))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, notifier := newTestService(t)
+			h.Config.Location = server
+			addStaff(t, store, "+15105550101", true)
+			if err := store.Schedules.Insert(context.Background(), tt.schedule); err != nil {
+				t.Fatal(err)
+			}
+
+			h.SendScheduleReminders(context.Background(), "You are on call today.")
+
+			if got := notifier.recipients(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("reminded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
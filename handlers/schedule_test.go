@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule storage.Schedule
+		wantErr  bool
+	}{
+		{
+			name:     "recurring",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "17:00", DayOfWeek: 1, Recurring: true},
+		},
+		{
+			name:     "one-off",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "17:00", Date: "2025-06-01"},
+		},
+		{
+			name:     "always ignores times",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", Always: true},
+		},
+		{
+			name:     "single digit hour",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "9:00", EndTime: "17:00", Recurring: true},
+			wantErr:  true,
+		},
+		{
+			name:     "hour out of range",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "24:00", Recurring: true},
+			wantErr:  true,
+		},
+		{
+			name:     "overnight",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "22:00", EndTime: "06:00", Recurring: true},
+		},
+		{
+			name:     "end equals start",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "09:00", Recurring: true},
+			wantErr:  true,
+		},
+		{
+			name:     "day of week out of range",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "17:00", DayOfWeek: 7, Recurring: true},
+			wantErr:  true,
+		},
+		{
+			name:     "one-off without date",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "17:00"},
+			wantErr:  true,
+		},
+		{
+			name:     "malformed date",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", StartTime: "09:00", EndTime: "17:00", Date: "06/01/2025"},
+			wantErr:  true,
+		},
+		{
+			name:     "backup tier",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", Always: true, Tier: 2},
+		},
+		{
+			name:     "tier out of range",
+			schedule: storage.Schedule{PhoneNumber: "+15105550123", Always: true, Tier: 10},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid phone number",
+			schedule: storage.Schedule{PhoneNumber: "5105550123", Always: true},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSchedule(tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		t.Fatalf("parse %q: %v", value, err)
+	}
+	return parsed
+}
+
+func TestScheduleCoversTime(t *testing.T) {
+	// 2025-06-02 is a Monday.
+	mondayDay := storage.Schedule{StartTime: "09:00", EndTime: "17:00", DayOfWeek: 1, Recurring: true}
+	mondayNight := storage.Schedule{StartTime: "22:00", EndTime: "06:00", DayOfWeek: 1, Recurring: true}
+	oneOffNight := storage.Schedule{StartTime: "22:00", EndTime: "06:00", Date: "2025-06-02"}
+	futureNight := storage.Schedule{StartTime: "22:00", EndTime: "06:00", DayOfWeek: 1, Recurring: true, Date: "2025-06-09"}
+
+	tests := []struct {
+		name     string
+		schedule storage.Schedule
+		at       string
+		want     bool
+	}{
+		{name: "day shift start inclusive", schedule: mondayDay, at: "2025-06-02 09:00", want: true},
+		{name: "day shift end inclusive", schedule: mondayDay, at: "2025-06-02 17:00", want: true},
+		{name: "day shift after end", schedule: mondayDay, at: "2025-06-02 17:01", want: false},
+		{name: "day shift other day", schedule: mondayDay, at: "2025-06-03 10:00", want: false},
+		{name: "overnight before start", schedule: mondayNight, at: "2025-06-02 21:59", want: false},
+		{name: "overnight evening", schedule: mondayNight, at: "2025-06-02 23:30", want: true},
+		{name: "overnight next morning", schedule: mondayNight, at: "2025-06-03 03:00", want: true},
+		{name: "overnight end inclusive", schedule: mondayNight, at: "2025-06-03 06:00", want: true},
+		{name: "overnight after end", schedule: mondayNight, at: "2025-06-03 06:01", want: false},
+		{name: "overnight morning belongs to previous day", schedule: mondayNight, at: "2025-06-02 03:00", want: false},
+		{name: "overnight next evening", schedule: mondayNight, at: "2025-06-03 23:00", want: false},
+		{name: "one-off overnight morning", schedule: oneOffNight, at: "2025-06-03 05:00", want: true},
+		{name: "one-off overnight other week", schedule: oneOffNight, at: "2025-06-10 05:00", want: false},
+		{name: "recurring not yet started", schedule: futureNight, at: "2025-06-03 03:00", want: false},
+		{name: "recurring started", schedule: futureNight, at: "2025-06-10 03:00", want: true},
+		{name: "always", schedule: storage.Schedule{Always: true}, at: "2025-06-04 12:00", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coversTime(tt.schedule, mustTime(t, tt.at), time.UTC); got != tt.want {
+				t.Fatalf("coversTime(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleOccursOn(t *testing.T) {
+	mondayNight := storage.Schedule{StartTime: "22:00", EndTime: "06:00", DayOfWeek: 1, Recurring: true}
+	mondayDay := storage.Schedule{StartTime: "09:00", EndTime: "17:00", DayOfWeek: 1, Recurring: true}
+
+	tests := []struct {
+		name     string
+		schedule storage.Schedule
+		date     string
+		want     bool
+	}{
+		{name: "overnight start day", schedule: mondayNight, date: "2025-06-02 00:00", want: true},
+		{name: "overnight end day", schedule: mondayNight, date: "2025-06-03 00:00", want: true},
+		{name: "overnight unrelated day", schedule: mondayNight, date: "2025-06-04 00:00", want: false},
+		{name: "day shift next day", schedule: mondayDay, date: "2025-06-03 00:00", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := occursOn(tt.schedule, mustTime(t, tt.date), time.UTC); got != tt.want {
+				t.Fatalf("occursOn(%s) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleCoversTimeInTimezone(t *testing.T) {
+	pacific, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Monday 09:00-17:00 Pacific.
+	mondayDay := storage.Schedule{StartTime: "09:00", EndTime: "17:00", DayOfWeek: 1, Recurring: true}
+	eastern := storage.Schedule{StartTime: "09:00", EndTime: "17:00", DayOfWeek: 1, Recurring: true, Timezone: "America/New_York"}
+
+	tests := []struct {
+		name     string
+		schedule storage.Schedule
+		at       time.Time
+		want     bool
+	}{
+		// 2025-06-02 16:30 UTC is 09:30 PDT.
+		{name: "summer start in UTC", schedule: mondayDay, at: time.Date(2025, 6, 2, 16, 30, 0, 0, time.UTC), want: true},
+		// 2025-06-02 09:30 UTC is 02:30 PDT.
+		{name: "summer UTC wall clock ignored", schedule: mondayDay, at: time.Date(2025, 6, 2, 9, 30, 0, 0, time.UTC), want: false},
+		// 2025-12-01 17:30 UTC is 09:30 PST.
+		{name: "winter start in UTC", schedule: mondayDay, at: time.Date(2025, 12, 1, 17, 30, 0, 0, time.UTC), want: true},
+		// 2025-12-01 16:30 UTC is 08:30 PST.
+		{name: "winter offset applied", schedule: mondayDay, at: time.Date(2025, 12, 1, 16, 30, 0, 0, time.UTC), want: false},
+		// 2025-06-03 00:30 UTC is Monday 17:30 PDT, after the shift.
+		{name: "UTC date differs from local date", schedule: mondayDay, at: time.Date(2025, 6, 3, 0, 30, 0, 0, time.UTC), want: false},
+		// 2025-06-02 13:30 UTC is 09:30 EDT.
+		{name: "per-schedule timezone", schedule: eastern, at: time.Date(2025, 6, 2, 13, 30, 0, 0, time.UTC), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coversTime(tt.schedule, tt.at, pacific); got != tt.want {
+				t.Fatalf("coversTime(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextReminderTime(t *testing.T) {
+	pacific, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		hour int
+		want time.Time
+	}{
+		{
+			name: "later today",
+			now:  time.Date(2025, 6, 2, 6, 0, 0, 0, pacific),
+			hour: 8,
+			want: time.Date(2025, 6, 2, 8, 0, 0, 0, pacific),
+		},
+		{
+			name: "tomorrow",
+			now:  time.Date(2025, 6, 2, 9, 0, 0, 0, pacific),
+			hour: 8,
+			want: time.Date(2025, 6, 3, 8, 0, 0, 0, pacific),
+		},
+		{
+			name: "exactly on the hour moves to tomorrow",
+			now:  time.Date(2025, 6, 2, 8, 0, 0, 0, pacific),
+			hour: 8,
+			want: time.Date(2025, 6, 3, 8, 0, 0, 0, pacific),
+		},
+		{
+			name: "now given in UTC",
+			now:  time.Date(2025, 6, 2, 14, 0, 0, 0, time.UTC), // 07:00 PDT
+			hour: 8,
+			want: time.Date(2025, 6, 2, 8, 0, 0, 0, pacific),
+		},
+		{
+			// DST starts 2025-03-09; the day is only 23 hours long.
+			name: "across spring forward",
+			now:  time.Date(2025, 3, 8, 9, 0, 0, 0, pacific),
+			hour: 8,
+			want: time.Date(2025, 3, 9, 8, 0, 0, 0, pacific),
+		},
+		{
+			// DST ends 2025-11-02; the day is 25 hours long.
+			name: "across fall back",
+			now:  time.Date(2025, 11, 1, 9, 0, 0, 0, pacific),
+			hour: 8,
+			want: time.Date(2025, 11, 2, 8, 0, 0, 0, pacific),
+		},
+		{
+			// 02:00 does not exist on 2025-03-09.
+			name: "hour skipped by spring forward",
+			now:  time.Date(2025, 3, 8, 9, 0, 0, 0, pacific),
+			hour: 2,
+			want: time.Date(2025, 3, 9, 3, 0, 0, 0, pacific),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextReminderTime(tt.now, tt.hour, pacific)
+			if !got.Equal(tt.want) {
+				t.Fatalf("NextReminderTime = %s, want %s", got, tt.want)
+			}
+			if got.Location() != pacific {
+				t.Fatalf("NextReminderTime location = %s, want %s", got.Location(), pacific)
+			}
+		})
+	}
+}
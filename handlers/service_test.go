@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	testInboundNumber  = "+15105550100"
+	testOutboundNumber = "+15105550199"
+)
+
+// sentNotification is one Notify call seen by recordingNotifier.
+type sentNotification struct {
+	To           []string
+	Notification Notification
+}
+
+// recordingNotifier stands in for Twilio SMS and remembers every alert.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []sentNotification
+}
+
+func (n *recordingNotifier) Channel() string {
+	return ChannelSMS
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, recipients []storage.Staff, notification Notification) []storage.MessageDelivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	to := phoneNumbersOf(recipients)
+	n.sent = append(n.sent, sentNotification{To: to, Notification: notification})
+
+	deliveries := make([]storage.MessageDelivery, 0, len(to))
+	for _, phoneNumber := range to {
+		deliveries = append(deliveries, storage.MessageDelivery{Channel: ChannelSMS, To: phoneNumber, MessageSid: "SM" + phoneNumber})
+	}
+	return deliveries
+}
+
+// recipients returns every phone number alerted, sorted.
+func (n *recordingNotifier) recipients() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var to []string
+	for _, sent := range n.sent {
+		to = append(to, sent.To...)
+	}
+	sort.Strings(to)
+	return to
+}
+
+// recordingMessages keeps every message the handlers store, in order.
+type recordingMessages struct {
+	storage.MessageRepository
+	inserted []storage.Message
+}
+
+func (r *recordingMessages) Insert(ctx context.Context, message storage.Message) error {
+	r.inserted = append(r.inserted, message)
+	return r.MessageRepository.Insert(ctx, message)
+}
+
+// newTestService returns a service backed by an in-memory store and a fake
+// SMS provider, with staff alerts going to the returned notifier.
+func newTestService(t *testing.T) (*handlers, storage.Store, *recordingNotifier) {
+	t.Helper()
+
+	store := storage.NewMemoryStore()
+	ctx := context.Background()
+	if err := store.Config.Set(ctx, "inbound_number", testInboundNumber); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Config.Set(ctx, "outbound_number", testOutboundNumber); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewService(store, NewFakeSMSProvider(), Config{
+		Timeout:  5 * time.Second,
+		Location: time.UTC,
+		Voice: VoiceSettings{
+			Voice:       DefaultVoice,
+			Language:    DefaultLanguage,
+			DialTimeout: defaultDialTimeout,
+			CallerID:    CallerIDSystem,
+		},
+	}, MessageTemplates{
+		VoiceConnectingMessage:       "Connecting you to dispatch.",
+		VoiceMissedCallStaffMessage:  "Missed call from {{from}}",
+		VoiceMissedCallCallerMessage: "Nobody could take your call.",
+		SMSSenderResponse:            "Thanks, dispatch has your message.",
+		SMSStaffTemplate:             "#{{code}} {{from}}: {{body}}",
+		VoiceVoicemailPrompt:         "Please leave a message.",
+	})
+
+	notifier := &recordingNotifier{}
+	h.RegisterNotifier(notifier)
+	return h, store, notifier
+}
+
+func newSQLiteStore(t *testing.T, file string) storage.Store {
+	t.Helper()
+
+	store, db, err := storage.OpenSQLStore(context.Background(), "sqlite://"+file)
+	if err != nil {
+		t.Fatalf("OpenSQLStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return store
+}
+
+// forEachStore runs a test against the in-memory store and a SQLite store,
+// so both behave the same way the handlers expect.
+func forEachStore(t *testing.T, test func(t *testing.T, store storage.Store)) {
+	t.Run("memory", func(t *testing.T) { test(t, storage.NewMemoryStore()) })
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newSQLiteStore(t, filepath.Join(t.TempDir(), "relay.db")))
+	})
+}
+
+// addStaff stores a staff member and returns it.
+func addStaff(t *testing.T, store storage.Store, phoneNumber string, active bool) storage.Staff {
+	t.Helper()
+
+	staff := storage.Staff{ID: bson.NewObjectID(), PublicID: "staff" + phoneNumber[len(phoneNumber)-4:], PhoneNumber: phoneNumber, Active: active}
+	if err := store.Staff.Insert(context.Background(), staff); err != nil {
+		t.Fatal(err)
+	}
+	return staff
+}
+
+// addThread stores an open thread for a reporter and returns it.
+func addThread(t *testing.T, store storage.Store, phoneNumber string, code string) storage.Thread {
+	t.Helper()
+
+	now := time.Now()
+	thread := storage.Thread{
+		ID:             bson.NewObjectID(),
+		PhoneNumber:    phoneNumber,
+		Code:           code,
+		Status:         storage.ThreadStatusOpen,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		LastActivityAt: now,
+	}
+	if err := store.Threads.Insert(context.Background(), thread); err != nil {
+		t.Fatal(err)
+	}
+	return thread
+}
+
+// postForm sends a Twilio-style form POST to a handler.
+func postForm(handler gin.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/*path", handler)
+
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// serveJSON sends a JSON API request to a handler mounted at route, which
+// may have path parameters such as /api/staff/:id.
+func serveJSON(handler gin.HandlerFunc, method string, route string, target string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Handle(method, route, handler)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// assertBodyContains fails the test if the response body lacks any of want.
+func assertBodyContains(t *testing.T, rec *httptest.ResponseRecorder, want ...string) {
+	t.Helper()
+
+	for _, fragment := range want {
+		if !strings.Contains(rec.Body.String(), fragment) {
+			t.Errorf("body = %q, want it to contain %q", rec.Body.String(), fragment)
+		}
+	}
+}
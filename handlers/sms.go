@@ -2,29 +2,34 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
 	"github.com/berkeley-neighbors/dispatch-relay/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/twilio/twilio-go/twiml"
-	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func (h *handlers) SMS() gin.HandlerFunc {
 	return func(ginCtx *gin.Context) {
-		value, _ := ginCtx.GetQuery("token")
-
-		if value != h.Config.RequestAuthToken {
-			ginCtx.String(http.StatusUnauthorized, "Unauthorized")
+		inbound, err := h.SMSProvider.ParseInbound(ginCtx.Request)
+		if errors.Is(err, errWebhookIgnored) {
+			ginCtx.Status(http.StatusOK)
+			return
+		}
+		if err != nil {
+			fmt.Println("Error reading inbound message:", err)
+			ginCtx.String(http.StatusBadRequest, "Invalid message")
 			return
 		}
 
-		from := ginCtx.PostForm("From")
-		body := ginCtx.PostForm("Body")
+		from := inbound.From
+		to := inbound.To
+		body := inbound.Body
+		messageSid := inbound.MessageSid
 
 		if from == "" {
 			fmt.Println("From number is empty")
@@ -48,36 +53,26 @@ func (h *handlers) SMS() gin.HandlerFunc {
 			return
 		}
 
-		staffCollection := h.StaffHandle.Collection()
-		blockListCollection := h.BlockListHandle.Collection()
-
-		var staffMatch Staff
-		var blockMatch BlockedNumber
-		filter := bson.M{"phone_number": from}
-
 		// Is Staff?
-		err = staffCollection.FindOne(timedCtx, filter).Decode(&staffMatch)
-		isStaffMember := (err == nil)
+		staffMatch, err := h.Store.Staff.FindByPhoneNumber(timedCtx, from)
+		if err != nil {
+			fmt.Println("Error looking up staff member:", err)
+		}
+		isStaffMember := staffMatch != nil
 
 		if isStaffMember && !h.Config.SkipStaffIgnore {
-			fmt.Println("Number belongs to staff member. Ignoring.")
-			doc, _ := twiml.CreateDocument()
-			xml, err := twiml.ToXML(doc)
-
-			if err != nil {
-				fmt.Println("Error creating TwiML document:", err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
-			}
-
-			ginCtx.Header("Content-Type", "text/xml")
-			ginCtx.String(http.StatusOK, xml)
+			fmt.Println("Number belongs to staff member. Handling as staff reply.")
+			h.handleStaffMessage(timedCtx, ginCtx, phoneConfig, *staffMatch, inbound)
 			return
 		}
 
 		// Is Blocked?
-		err = blockListCollection.FindOne(timedCtx, filter).Decode(&blockMatch)
-		isBlocked := (err == nil)
+		isBlocked, err := h.isBlocked(timedCtx, from)
+		if err != nil {
+			fmt.Println("Error checking blocklist:", err)
+			ginCtx.String(http.StatusInternalServerError, "Server error")
+			return
+		}
 
 		if isBlocked {
 			fmt.Println("Number is blocked:", from)
@@ -85,89 +80,99 @@ func (h *handlers) SMS() gin.HandlerFunc {
 			return
 		}
 
-		threadCollection := h.ThreadHandle.Collection()
-
-		var openThread Thread
-		filter = bson.M{"phone_number": from, "status": "OPEN"}
-
-		err = threadCollection.FindOne(timedCtx, filter).Decode(&openThread)
-
-		threadExists := (err == nil)
-
-		if err != nil && err != mongo.ErrNoDocuments {
-			fmt.Println("Error finding threads:", err)
+		thread, created, err := h.openThread(timedCtx, from)
+		if err != nil {
+			fmt.Println("Error opening thread:", err)
 			ginCtx.String(http.StatusInternalServerError, "Server error")
 			return
 		}
 
-		if !threadExists {
-			fmt.Println("Starting new thread for phone number:", from)
-
-			_, err = threadCollection.InsertOne(timedCtx, bson.M{
-				"phone_number": from,
-				"status":       "OPEN",
-				"created_at":   time.Now(),
-			})
+		// Only the request that created the thread treats it as new, so a
+		// burst of texts alerts staff once.
+		threadExists := !created
 
-			if err != nil {
-				fmt.Println("Error creating thread:", err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
+		if !threadExists {
+			fmt.Println("Started new thread for phone number:", from)
+		} else {
+			if err := h.ensureThreadCode(timedCtx, thread); err != nil {
+				fmt.Println("Error assigning thread code:", err)
+			}
+			if err := h.touchThread(timedCtx, thread.ID); err != nil {
+				fmt.Println("Error recording thread activity:", err)
 			}
 		}
 
+		message := h.recordMessage(timedCtx, storage.Message{
+			ThreadID:   thread.ID,
+			Direction:  DirectionInbound,
+			Channel:    ChannelSMS,
+			Kind:       MessageKindReporterMessage,
+			From:       from,
+			To:         []string{to},
+			Body:       body,
+			MessageSid: messageSid,
+		})
+		h.emitEvent(timedCtx, EventMessageReceived, map[string]any{"thread": thread, "message": message})
+
 		if !threadExists || h.Config.NotificationStrategy == "ALWAYS" {
-			phoneNumbers, err := h.getOnCallStaffPhoneNumbers(timedCtx)
+			staff, err := h.threadAlertRecipients(timedCtx, thread, !threadExists)
 			if err != nil {
 				fmt.Println("Error retrieving on-call staff:", err)
 				ginCtx.String(http.StatusInternalServerError, "Server error")
 				return
 			}
 
-			fmt.Printf("Messaging %d on-call staff members\n", len(phoneNumbers))
+			fmt.Printf("Notifying %d on-call staff members\n", len(staff))
 
 			// Build staff message using template with variable replacement
-			staffMessage := utils.ReplaceTemplateVars(h.Templates.SMSStaffTemplate, map[string]string{
+			vars := map[string]string{
 				"from": from,
 				"body": body,
-				"time": time.Now().Format(time.RFC1123),
-			})
+				"code": thread.Code,
+				"time": h.now().Format(time.RFC1123),
+			}
+			staffMessage := utils.ReplaceTemplateVars(h.Templates.SMSStaffTemplate, vars)
+
+			notification := Notification{
+				Kind:     MessageKindStaffNotification,
+				From:     phoneConfig.Outbound,
+				Body:     staffMessage,
+				Vars:     vars,
+				ThreadID: thread.ID,
+			}
 
-			// Send message to all staff members
-			h.sendMessageToGroup(phoneConfig.Outbound, phoneNumbers, staffMessage)
+			// Notify staff members on their chosen channels
+			h.notifyStaff(timedCtx, staff, notification)
+
+			// Chat lists everyone on call, not just the routed responder
+			// or escalation tier.
+			if len(h.ChatWebhooks) > 0 {
+				onCall, err := h.getOnCallStaff(timedCtx)
+				if err != nil {
+					fmt.Println("Error retrieving on-call staff for chat:", err)
+				}
+				h.broadcastToChat(timedCtx, notification, onCall)
+			}
 		} else {
 			fmt.Println("Skipping staff notification")
 		}
 
-		var senderResponse string
-
 		if threadExists {
 			fmt.Println("Open thread found for phone number:", from)
-			doc, _ := twiml.CreateDocument()
-			xml, err := twiml.ToXML(doc)
-			if err != nil {
-				fmt.Println("Error creating TwiML document:", err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
-			}
-
-			senderResponse = xml
-		} else {
-			message := &twiml.MessagingMessage{
-				Body: h.Templates.SMSSenderResponse,
-			}
-
-			xml, err := twiml.Messages([]twiml.Element{message})
-
-			if err != nil {
-				ginCtx.String(http.StatusInternalServerError, err.Error())
-				return
-			}
-
-			senderResponse = xml
+			h.SMSProvider.Reply(timedCtx, ginCtx, inbound, "")
+			return
 		}
 
-		ginCtx.Header("Content-Type", "text/xml")
-		ginCtx.String(http.StatusOK, senderResponse)
+		h.recordMessage(timedCtx, storage.Message{
+			ThreadID:  thread.ID,
+			Direction: DirectionOutbound,
+			Channel:   ChannelSMS,
+			Kind:      MessageKindAutoReply,
+			From:      to,
+			To:        []string{from},
+			Body:      h.Templates.SMSSenderResponse,
+		})
+
+		h.SMSProvider.Reply(timedCtx, ginCtx, inbound, h.Templates.SMSSenderResponse)
 	}
 }
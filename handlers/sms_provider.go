@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go"
+	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+	"github.com/twilio/twilio-go/twiml"
+)
+
+// SMS provider names accepted by SMS_PROVIDER.
+const (
+	SMSProviderTwilio = "twilio"
+	SMSProviderTelnyx = "telnyx"
+	SMSProviderFake   = "fake"
+)
+
+// errWebhookIgnored is returned by ParseInbound for provider webhooks that
+// are not an inbound text message, such as delivery reports. They are
+// acknowledged and otherwise dropped.
+var errWebhookIgnored = errors.New("webhook is not an inbound message")
+
+// InboundSMS is a text message received on the /sms webhook.
+type InboundSMS struct {
+	From string
+	// To is the dispatch number the message was sent to.
+	To   string
+	Body string
+	// MessageSid is the provider's ID for the message.
+	MessageSid string
+}
+
+// SMSProvider sends text messages through a carrier and speaks the carrier's
+// inbound webhook format.
+type SMSProvider interface {
+	Name() string
+	// Send sends one SMS and returns the provider's ID for it.
+	Send(ctx context.Context, from string, to string, body string) (string, error)
+	// ParseInbound reads an inbound message from a webhook request.
+	ParseInbound(req *http.Request) (InboundSMS, error)
+	// Reply answers the webhook for inbound, texting reply back to the
+	// sender unless it is empty.
+	Reply(ctx context.Context, ginCtx *gin.Context, inbound InboundSMS, reply string)
+}
+
+// twilioWebhooks reads Twilio's form-encoded SMS webhooks and replies with
+// TwiML.
+type twilioWebhooks struct{}
+
+func (twilioWebhooks) ParseInbound(req *http.Request) (InboundSMS, error) {
+	if err := req.ParseForm(); err != nil {
+		return InboundSMS{}, err
+	}
+
+	return InboundSMS{
+		From:       req.PostForm.Get("From"),
+		To:         req.PostForm.Get("To"),
+		Body:       req.PostForm.Get("Body"),
+		MessageSid: req.PostForm.Get("MessageSid"),
+	}, nil
+}
+
+func (twilioWebhooks) Reply(ctx context.Context, ginCtx *gin.Context, inbound InboundSMS, reply string) {
+	var elements []twiml.Element
+	if reply != "" {
+		elements = append(elements, &twiml.MessagingMessage{Body: reply})
+	}
+
+	xml, err := twiml.Messages(elements)
+	if err != nil {
+		fmt.Println("Error creating TwiML document:", err)
+		ginCtx.String(http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	ginCtx.Header("Content-Type", "text/xml")
+	ginCtx.String(http.StatusOK, xml)
+}
+
+// TwilioSMSProvider sends SMS through the Twilio REST API, authenticating
+// with TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN.
+type TwilioSMSProvider struct {
+	twilioWebhooks
+	client *twilio.RestClient
+}
+
+func NewTwilioSMSProvider() *TwilioSMSProvider {
+	return &TwilioSMSProvider{client: twilio.NewRestClient()}
+}
+
+func (p *TwilioSMSProvider) Name() string {
+	return SMSProviderTwilio
+}
+
+func (p *TwilioSMSProvider) Send(ctx context.Context, from string, to string, body string) (string, error) {
+	params := &twilioApi.CreateMessageParams{}
+	params.SetBody(body)
+	params.SetFrom(from)
+	params.SetTo(to)
+
+	resp, err := p.client.Api.CreateMessage(params)
+	if err != nil {
+		return "", err
+	}
+	if resp.Sid == nil {
+		return "", nil
+	}
+	return *resp.Sid, nil
+}
+
+// SentSMS is a message kept by FakeSMSProvider.
+type SentSMS struct {
+	MessageSid string
+	From       string
+	To         string
+	Body       string
+}
+
+// FakeSMSProvider logs and keeps outbound messages instead of sending them.
+// It reads Twilio-style webhooks, so requests can be sent by hand as shown
+// in the README.
+type FakeSMSProvider struct {
+	twilioWebhooks
+
+	mu   sync.Mutex
+	sent []SentSMS
+}
+
+func NewFakeSMSProvider() *FakeSMSProvider {
+	return &FakeSMSProvider{}
+}
+
+func (p *FakeSMSProvider) Name() string {
+	return SMSProviderFake
+}
+
+func (p *FakeSMSProvider) Send(ctx context.Context, from string, to string, body string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sms := SentSMS{MessageSid: fmt.Sprintf("FAKE%d", len(p.sent)+1), From: from, To: to, Body: body}
+	p.sent = append(p.sent, sms)
+
+	log.Printf("Fake SMS %s from %s to %s: %s", sms.MessageSid, from, to, body)
+	return sms.MessageSid, nil
+}
+
+// Sent returns the messages sent so far, oldest first.
+func (p *FakeSMSProvider) Sent() []SentSMS {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]SentSMS(nil), p.sent...)
+}
+
+// sendSMS sends one SMS per phone number and reports the outcome of each.
+func sendSMS(ctx context.Context, provider SMSProvider, fromNumber string, phoneNumbers []string, message string) []storage.MessageDelivery {
+	deliveries := make([]storage.MessageDelivery, 0, len(phoneNumbers))
+
+	for _, phoneNumber := range phoneNumbers {
+		delivery := storage.MessageDelivery{Channel: ChannelSMS, To: phoneNumber}
+
+		sid, err := provider.Send(ctx, fromNumber, phoneNumber, message)
+		if err != nil {
+			log.Printf("Error sending message to %s via %s: %v", phoneNumber, provider.Name(), err)
+			delivery.Error = err.Error()
+		} else {
+			log.Printf("Sent message %s to %s", sid, phoneNumber)
+			delivery.MessageSid = sid
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const telnyxAPIBaseURL = "https://api.telnyx.com"
+
+var telnyxHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// TelnyxSMSProvider sends SMS through the Telnyx Messaging API. Telnyx posts
+// inbound messages as JSON events and does not read replies from the
+// webhook response, so replies are sent through the API.
+type TelnyxSMSProvider struct {
+	APIKey string
+	// MessagingProfileID is optional. Telnyx uses the profile of the sending
+	// number when it is empty.
+	MessagingProfileID string
+	// BaseURL overrides the Telnyx API host, for tests.
+	BaseURL string
+}
+
+func (p *TelnyxSMSProvider) Name() string {
+	return SMSProviderTelnyx
+}
+
+type telnyxMessageRequest struct {
+	From               string `json:"from"`
+	To                 string `json:"to"`
+	Text               string `json:"text"`
+	MessagingProfileID string `json:"messaging_profile_id,omitempty"`
+}
+
+type telnyxMessageResponse struct {
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+func (p *TelnyxSMSProvider) Send(ctx context.Context, from string, to string, body string) (string, error) {
+	payload, err := json.Marshal(telnyxMessageRequest{
+		From:               from,
+		To:                 to,
+		Text:               body,
+		MessagingProfileID: p.MessagingProfileID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = telnyxAPIBaseURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/v2/messages", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+
+	resp, err := telnyxHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result telnyxMessageResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return "", fmt.Errorf("error reading Telnyx response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		if len(result.Errors) > 0 {
+			return "", fmt.Errorf("telnyx returned %s: %s", resp.Status, strings.TrimSpace(result.Errors[0].Title+" "+result.Errors[0].Detail))
+		}
+		return "", fmt.Errorf("telnyx returned %s", resp.Status)
+	}
+
+	return result.Data.ID, nil
+}
+
+type telnyxPhoneNumber struct {
+	PhoneNumber string `json:"phone_number"`
+}
+
+type telnyxWebhook struct {
+	Data struct {
+		EventType string `json:"event_type"`
+		Payload   struct {
+			ID        string              `json:"id"`
+			Direction string              `json:"direction"`
+			From      telnyxPhoneNumber   `json:"from"`
+			To        []telnyxPhoneNumber `json:"to"`
+			Text      string              `json:"text"`
+		} `json:"payload"`
+	} `json:"data"`
+}
+
+// ParseInbound reads a message.received event. Delivery events for outbound
+// messages, which Telnyx posts to the same URL, return errWebhookIgnored.
+func (p *TelnyxSMSProvider) ParseInbound(req *http.Request) (InboundSMS, error) {
+	var event telnyxWebhook
+	if err := json.NewDecoder(io.LimitReader(req.Body, 1<<20)).Decode(&event); err != nil {
+		return InboundSMS{}, fmt.Errorf("invalid Telnyx webhook: %w", err)
+	}
+
+	if event.Data.EventType != "message.received" {
+		return InboundSMS{}, errWebhookIgnored
+	}
+
+	inbound := InboundSMS{
+		From:       event.Data.Payload.From.PhoneNumber,
+		Body:       event.Data.Payload.Text,
+		MessageSid: event.Data.Payload.ID,
+	}
+	if len(event.Data.Payload.To) > 0 {
+		inbound.To = event.Data.Payload.To[0].PhoneNumber
+	}
+	return inbound, nil
+}
+
+// Reply sends reply from the number the inbound message was sent to. The
+// webhook is acknowledged even if the reply fails, since Telnyx would
+// otherwise deliver the inbound message again.
+func (p *TelnyxSMSProvider) Reply(ctx context.Context, ginCtx *gin.Context, inbound InboundSMS, reply string) {
+	if reply != "" {
+		if _, err := p.Send(ctx, inbound.To, inbound.From, reply); err != nil {
+			log.Printf("Error replying to %s via Telnyx: %v", inbound.From, err)
+		}
+	}
+
+	ginCtx.Status(http.StatusOK)
+}
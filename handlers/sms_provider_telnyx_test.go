@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// telnyxAPI is a stand-in for the Telnyx messages endpoint.
+type telnyxAPI struct {
+	mu       sync.Mutex
+	requests []telnyxMessageRequest
+	status   int
+}
+
+func newTelnyxAPI(t *testing.T) (*telnyxAPI, *TelnyxSMSProvider) {
+	t.Helper()
+
+	api := &telnyxAPI{status: http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/messages" || r.Header.Get("Authorization") != "Bearer KEY123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req telnyxMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		api.mu.Lock()
+		api.requests = append(api.requests, req)
+		status := api.status
+		api.mu.Unlock()
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"errors":[{"title":"Invalid destination","detail":"The 'to' number is not SMS capable."}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"id":"40385f64-5717-4562-b3fc-2c963f66afa6"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return api, &TelnyxSMSProvider{APIKey: "KEY123", MessagingProfileID: "profile-1", BaseURL: server.URL}
+}
+
+func telnyxEvent(eventType string, from string, to string, text string) string {
+	return `{"data":{"event_type":"` + eventType + `","id":"evt-1","payload":{"id":"msg-1","direction":"inbound",` +
+		`"from":{"phone_number":"` + from + `"},"to":[{"phone_number":"` + to + `"}],"text":"` + text + `"}}}`
+}
+
+func TestTelnyxSend(t *testing.T) {
+	api, provider := newTelnyxAPI(t)
+
+	id, err := provider.Send(context.Background(), testOutboundNumber, "+15105550101", "Dispatch alert")
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if id != "40385f64-5717-4562-b3fc-2c963f66afa6" {
+		t.Errorf("id = %q, want the Telnyx message ID", id)
+	}
+
+	want := telnyxMessageRequest{From: testOutboundNumber, To: "+15105550101", Text: "Dispatch alert", MessagingProfileID: "profile-1"}
+	if len(api.requests) != 1 || api.requests[0] != want {
+		t.Fatalf("requests = %+v, want %+v", api.requests, want)
+	}
+
+	api.status = http.StatusUnprocessableEntity
+	_, err = provider.Send(context.Background(), testOutboundNumber, "+15105550101", "Dispatch alert")
+	if err == nil || !strings.Contains(err.Error(), "not SMS capable") {
+		t.Errorf("Send error = %v, want the Telnyx error detail", err)
+	}
+}
+
+func TestTelnyxParseInbound(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    InboundSMS
+		ignored bool
+		wantErr bool
+	}{
+		{
+			name: "received message",
+			body: telnyxEvent("message.received", "+14155550123", testInboundNumber, "Loud party"),
+			want: InboundSMS{From: "+14155550123", To: testInboundNumber, Body: "Loud party", MessageSid: "msg-1"},
+		},
+		{
+			name:    "delivery report is ignored",
+			body:    telnyxEvent("message.finalized", testOutboundNumber, "+15105550101", "Dispatch alert"),
+			ignored: true,
+		},
+		{
+			name:    "malformed body",
+			body:    `{"data":`,
+			wantErr: true,
+		},
+	}
+
+	provider := &TelnyxSMSProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/sms", strings.NewReader(tt.body))
+
+			got, err := provider.ParseInbound(req)
+			if errors.Is(err, errWebhookIgnored) != tt.ignored {
+				t.Fatalf("err = %v, want ignored: %v", err, tt.ignored)
+			}
+			if !tt.ignored && (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelnyxSMS(t *testing.T) {
+	h, store, notifier := newTestService(t)
+	api, provider := newTelnyxAPI(t)
+	h.SMSProvider = provider
+	addStaff(t, store, "+15105550101", true)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.POST("/sms", h.SMS())
+
+		req := httptest.NewRequest(http.MethodPost, "/sms", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(telnyxEvent("message.received", "+14155550123", testInboundNumber, "Loud party"))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("response = %d %q, want an empty 200", rec.Code, rec.Body.String())
+	}
+
+	// The auto reply goes out through the API from the number texted.
+	want := telnyxMessageRequest{From: testInboundNumber, To: "+14155550123", Text: "Thanks, dispatch has your message.", MessagingProfileID: "profile-1"}
+	if len(api.requests) != 1 || api.requests[0] != want {
+		t.Fatalf("requests = %+v, want %+v", api.requests, want)
+	}
+	if got := notifier.recipients(); len(got) != 1 || got[0] != "+15105550101" {
+		t.Errorf("alerted %v, want the active staff member", got)
+	}
+
+	rec = post(telnyxEvent("message.sent", testInboundNumber, "+14155550123", "Thanks, dispatch has your message."))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want delivery events acknowledged", rec.Code)
+	}
+	if len(api.requests) != 1 {
+		t.Errorf("delivery event sent %d more messages", len(api.requests)-1)
+	}
+}
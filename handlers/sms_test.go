@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSMS(t *testing.T) {
+	const reporter = "+14155550123"
+
+	tests := []struct {
+		name         string
+		strategy     string
+		setup        func(t *testing.T, store storage.Store)
+		form         url.Values
+		wantStatus   int
+		wantBody     []string
+		wantAlerted  []string
+		wantThread   bool
+		wantMessages []string
+		check        func(t *testing.T, store storage.Store)
+	}{
+		{
+			name:         "first text opens a thread and alerts active staff",
+			form:         url.Values{"From": {reporter}, "To": {testInboundNumber}, "Body": {"Loud party on Elm St"}},
+			wantStatus:   http.StatusOK,
+			wantBody:     []string{"<Message>Thanks, dispatch has your message.</Message>"},
+			wantAlerted:  []string{"+15105550101", "+15105550102"},
+			wantThread:   true,
+			wantMessages: []string{MessageKindReporterMessage, MessageKindAutoReply, MessageKindStaffNotification},
+		},
+		{
+			name: "follow-up text is recorded without alerting again",
+			setup: func(t *testing.T, store storage.Store) {
+				addThread(t, store, reporter, "ABCD")
+			},
+			form:         url.Values{"From": {reporter}, "Body": {"Still going"}},
+			wantStatus:   http.StatusOK,
+			wantBody:     []string{"<Response/>"},
+			wantThread:   true,
+			wantMessages: []string{MessageKindReporterMessage},
+		},
+		{
+			name:     "follow-up text alerts again with the ALWAYS strategy",
+			strategy: "ALWAYS",
+			setup: func(t *testing.T, store storage.Store) {
+				addThread(t, store, reporter, "ABCD")
+			},
+			form:         url.Values{"From": {reporter}, "Body": {"Still going"}},
+			wantStatus:   http.StatusOK,
+			wantAlerted:  []string{"+15105550101", "+15105550102"},
+			wantThread:   true,
+			wantMessages: []string{MessageKindReporterMessage, MessageKindStaffNotification},
+		},
+		{
+			name: "blocked number is refused",
+			setup: func(t *testing.T, store storage.Store) {
+				if _, err := store.BlockList.Upsert(context.Background(), storage.BlockedNumber{PhoneNumber: reporter, CreatedAt: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			form:       url.Values{"From": {reporter}, "Body": {"hello"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "expired block no longer applies",
+			setup: func(t *testing.T, store storage.Store) {
+				expired := time.Now().Add(-time.Hour)
+				if _, err := store.BlockList.Upsert(context.Background(), storage.BlockedNumber{PhoneNumber: reporter, CreatedAt: time.Now(), ExpiresAt: &expired}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			form:        url.Values{"From": {reporter}, "Body": {"hello"}},
+			wantStatus:  http.StatusOK,
+			wantAlerted: []string{"+15105550101", "+15105550102"},
+			wantThread:  true,
+		},
+		{
+			name:       "empty body is rejected",
+			form:       url.Values{"From": {reporter}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "staff command is answered in the response",
+			form:       url.Values{"From": {"+15105550101"}, "Body": {"OFF"}},
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"You are now off duty."},
+			check: func(t *testing.T, store storage.Store) {
+				staff, err := store.Staff.FindByPhoneNumber(context.Background(), "+15105550101")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if staff.Active {
+					t.Error("staff member is still active after OFF")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, notifier := newTestService(t)
+			h.Config.NotificationStrategy = tt.strategy
+			addStaff(t, store, "+15105550101", true)
+			addStaff(t, store, "+15105550102", true)
+			addStaff(t, store, "+15105550103", false)
+			if tt.setup != nil {
+				tt.setup(t, store)
+			}
+
+			rec := postForm(h.SMS(), "/sms", tt.form)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			assertBodyContains(t, rec, tt.wantBody...)
+
+			if got := notifier.recipients(); !reflect.DeepEqual(got, tt.wantAlerted) {
+				t.Errorf("alerted %v, want %v", got, tt.wantAlerted)
+			}
+
+			thread, err := store.Threads.FindActiveByPhoneNumber(context.Background(), reporter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (thread != nil) != tt.wantThread {
+				t.Fatalf("open thread = %v, want one: %v", thread, tt.wantThread)
+			}
+
+			for _, kind := range tt.wantMessages {
+				message, err := store.Messages.FindLast(context.Background(), thread.ID, kind)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if message == nil {
+					t.Errorf("no %s message recorded on the thread", kind)
+				}
+			}
+
+			if tt.check != nil {
+				tt.check(t, store)
+			}
+		})
+	}
+}
+
+func TestSMSAlertUsesThreadCode(t *testing.T) {
+	h, store, notifier := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+
+	rec := postForm(h.SMS(), "/sms", url.Values{"From": {"+14155550123"}, "Body": {"help"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	thread, err := store.Threads.FindActiveByPhoneNumber(context.Background(), "+14155550123")
+	if err != nil || thread == nil {
+		t.Fatalf("no thread created: %v", err)
+	}
+
+	if len(notifier.sent) != 1 {
+		t.Fatalf("sent %d alerts, want 1", len(notifier.sent))
+	}
+	want := "#" + thread.Code + " +14155550123: help"
+	if got := notifier.sent[0].Notification.Body; got != want {
+		t.Errorf("alert body = %q, want %q", got, want)
+	}
+	if got := notifier.sent[0].Notification.From; got != testOutboundNumber {
+		t.Errorf("alert sent from %q, want %q", got, testOutboundNumber)
+	}
+}
+
+func TestSMSStaffReplyIsRelayed(t *testing.T) {
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	thread := addThread(t, store, "+14155550123", "ABCD")
+
+	rec := postForm(h.SMS(), "/sms", url.Values{"From": {"+15105550101"}, "To": {testOutboundNumber}, "Body": {"#ABCD On our way"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	assertBodyContains(t, rec, "<Response/>")
+
+	sent := h.SMSProvider.(*FakeSMSProvider).Sent()
+	want := []SentSMS{{MessageSid: "FAKE1", From: testInboundNumber, To: "+14155550123", Body: "On our way"}}
+	if !reflect.DeepEqual(sent, want) {
+		t.Fatalf("sent %+v, want %+v", sent, want)
+	}
+
+	relayed, err := store.Messages.FindLast(context.Background(), thread.ID, MessageKindStaffReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayed == nil || relayed.Direction != DirectionOutbound || len(relayed.Deliveries) != 1 || relayed.Deliveries[0].MessageSid != "FAKE1" {
+		t.Errorf("relayed message = %+v, want an outbound record of FAKE1", relayed)
+	}
+}
+
+func TestConcurrentMessagesOpenOneThread(t *testing.T) {
+	const reporter = "+14155550123"
+
+	tests := []struct {
+		name  string
+		texts int
+		calls int
+	}{
+		{name: "burst of texts", texts: 10},
+		{name: "texts and a call", texts: 5, calls: 1},
+		{name: "a call", calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store storage.Store) {
+				h, _, notifier := newTestService(t)
+				h.Store = store
+				ctx := context.Background()
+				if err := store.Config.Set(ctx, "inbound_number", testInboundNumber); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Config.Set(ctx, "outbound_number", testOutboundNumber); err != nil {
+					t.Fatal(err)
+				}
+				addStaff(t, store, "+15105550101", true)
+
+				gin.SetMode(gin.TestMode)
+				router := gin.New()
+				router.POST("/sms", h.SMS())
+				router.POST("/voice", h.Voice())
+
+				var wg sync.WaitGroup
+				responses := make([]*httptest.ResponseRecorder, tt.texts+tt.calls)
+				for i := range responses {
+					target, form := "/sms", url.Values{"From": {reporter}, "To": {testInboundNumber}, "Body": {"Loud party"}}
+					if i >= tt.texts {
+						target, form = "/voice", url.Values{"From": {reporter}, "To": {testInboundNumber}, "CallSid": {"CA123"}}
+					}
+
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+						req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+						responses[i] = httptest.NewRecorder()
+						router.ServeHTTP(responses[i], req)
+					}()
+				}
+				wg.Wait()
+
+				autoReplies, dials := 0, 0
+				for _, rec := range responses {
+					if rec.Code != http.StatusOK {
+						t.Fatalf("status = %d, want every message accepted (body %q)", rec.Code, rec.Body.String())
+					}
+					if strings.Contains(rec.Body.String(), "<Message>") {
+						autoReplies++
+					}
+					if strings.Contains(rec.Body.String(), "<Dial") {
+						dials++
+					}
+				}
+
+				threads, err := store.Threads.ListActive(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(threads) != 1 {
+					t.Fatalf("%d active threads, want one", len(threads))
+				}
+
+				if dials != tt.calls {
+					t.Fatalf("%d calls rang staff, want all %d", dials, tt.calls)
+				}
+
+				// Only the text that opened the thread answers the reporter
+				// and texts staff. When a call opened it instead, ringing
+				// staff is the thread's only alert.
+				texted := len(notifier.recipients())
+				if autoReplies > 1 || texted != autoReplies {
+					t.Fatalf("texted staff %d times with %d auto replies, want both once for the text that opened the thread", texted, autoReplies)
+				}
+
+				openingAlerts := texted
+				if texted == 0 {
+					openingAlerts = dials
+				}
+				if openingAlerts != 1 {
+					t.Errorf("opened thread sent %d alerts, want exactly one text or call", openingAlerts)
+				}
+			})
+		})
+	}
+}
+
+func TestSMSMistypedStaffCommandIsNotRelayed(t *testing.T) {
+	tests := []struct {
+		body        string
+		wantRelayed bool
+	}{
+		{body: "ACKK"},
+		{body: "STAUTS"},
+		{body: "close#ABCD"},
+		{body: "BLOCK#ABCD spam"},
+		{body: "OK", wantRelayed: true},
+		{body: "Block party is on Sunday, we'll be there", wantRelayed: true},
+		{body: "Thanks, on our way", wantRelayed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			h, store, _ := newTestService(t)
+			addStaff(t, store, "+15105550101", true)
+			addThread(t, store, "+14155550123", "ABCD")
+
+			rec := postForm(h.SMS(), "/sms", url.Values{"From": {"+15105550101"}, "To": {testOutboundNumber}, "Body": {tt.body}})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+			}
+
+			sent := h.SMSProvider.(*FakeSMSProvider).Sent()
+			if relayed := len(sent) > 0; relayed != tt.wantRelayed {
+				t.Fatalf("relayed = %v (sent %+v), want %v", relayed, sent, tt.wantRelayed)
+			}
+			if !tt.wantRelayed {
+				assertBodyContains(t, rec, "Commands:")
+			}
+
+			blocked, err := store.BlockList.IsBlocked(context.Background(), "+14155550123", time.Now())
+			if err != nil || blocked {
+				t.Errorf("IsBlocked = %v, %v, want the reporter left unblocked", blocked, err)
+			}
+		})
+	}
+}
+
+func TestSMSChatListsEveryoneOnCall(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body = string(raw)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	h, store, notifier := newTestService(t)
+	h.Config.RoutingMode = RoutingModeRoundRobin
+	h.Config.RoutingAckTimeout = 5 * time.Minute
+	h.RegisterChatWebhook(ChatWebhook{Format: ChatFormatSlack, URL: server.URL})
+	addStaff(t, store, "+15105550101", true)
+	addStaff(t, store, "+15105550102", true)
+
+	rec := postForm(h.SMS(), "/sms", url.Values{"From": {"+14155550123"}, "Body": {"Loud party"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	if got := notifier.recipients(); len(got) != 1 {
+		t.Fatalf("alerted %v, want one routed responder", got)
+	}
+	for _, phoneNumber := range []string{"+15105550101", "+15105550102"} {
+		if !strings.Contains(body, phoneNumber) {
+			t.Errorf("chat post is missing on-call %s:\n%s", phoneNumber, body)
+		}
+	}
+}
+
+func TestCloseInactiveThreads(t *testing.T) {
+	h, store, _ := newTestService(t)
+	ctx := context.Background()
+	stale := addThread(t, store, "+14155550123", "ABCD")
+	fresh := addThread(t, store, "+14155550124", "EFGH")
+
+	// Disabled by default, so nothing closes.
+	h.CloseInactiveThreads(ctx)
+	if active, err := store.Threads.ListActive(ctx); err != nil || len(active) != 2 {
+		t.Fatalf("ListActive = %+v, %v, want both threads left open", active, err)
+	}
+
+	h.Config.ThreadInactivityTimeout = time.Hour
+	if err := store.Threads.Touch(ctx, fresh.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Threads.Touch(ctx, stale.ID, time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	h.CloseInactiveThreads(ctx)
+
+	closed, err := store.Threads.FindByID(ctx, stale.ID)
+	if err != nil || closed == nil || closed.Status != storage.ThreadStatusClosed || closed.ClosedBy != "system:inactivity" {
+		t.Errorf("stale thread = %+v, %v, want closed by system:inactivity", closed, err)
+	}
+	open, err := store.Threads.FindByID(ctx, fresh.ID)
+	if err != nil || open == nil || open.Status != storage.ThreadStatusOpen {
+		t.Errorf("fresh thread = %+v, %v, want it left open", open, err)
+	}
+}
+
+func TestSMSReopensThreadWithPreviousLink(t *testing.T) {
+	const reporter = "+14155550123"
+
+	h, store, _ := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	previous := addThread(t, store, reporter, "ABCD")
+	if _, err := store.Threads.Transition(context.Background(), previous.ID, storage.ActiveThreadStatuses, storage.ThreadStatusClosed, "staff0101", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := postForm(h.SMS(), "/sms", url.Values{"From": {reporter}, "Body": {"It started again"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	thread, err := store.Threads.FindActiveByPhoneNumber(context.Background(), reporter)
+	if err != nil || thread == nil {
+		t.Fatalf("no new thread opened: %v", err)
+	}
+	if thread.ID == previous.ID || thread.PreviousThreadID == nil || *thread.PreviousThreadID != previous.ID {
+		t.Errorf("new thread = %+v, want a new thread linking back to %s", thread, previous.ID.Hex())
+	}
+}
+
+func TestStaffAckAndCloseTransitions(t *testing.T) {
+	h, store, _ := newTestService(t)
+	staff := addStaff(t, store, "+15105550101", true)
+	thread := addThread(t, store, "+14155550123", "ABCD")
+
+	for _, command := range []string{"ACK", "CLOSE"} {
+		rec := postForm(h.SMS(), "/sms", url.Values{"From": {staff.PhoneNumber}, "To": {testOutboundNumber}, "Body": {command}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200 (body %q)", command, rec.Code, rec.Body.String())
+		}
+	}
+
+	got, err := store.Threads.FindByID(context.Background(), thread.ID)
+	if err != nil || got == nil {
+		t.Fatalf("FindByID = %v, %v", got, err)
+	}
+	if got.Status != storage.ThreadStatusClosed || got.AcknowledgedBy != staff.PublicID || got.ClosedBy != staff.PublicID {
+		t.Errorf("thread = %+v, want acknowledged and closed by %s", got, staff.PublicID)
+	}
+
+	var statuses []string
+	for _, transition := range got.Transitions {
+		statuses = append(statuses, transition.Status)
+		if transition.By != staff.PublicID {
+			t.Errorf("transition %+v not recorded as made by %s", transition, staff.PublicID)
+		}
+	}
+	if want := []string{storage.ThreadStatusAcknowledged, storage.ThreadStatusClosed}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("transitions = %v, want %v", statuses, want)
+	}
+}
+
+func TestSMSStaffReplyWithoutCode(t *testing.T) {
+	h, store, _ := newTestService(t)
+	messages := &recordingMessages{MessageRepository: store.Messages}
+	h.Store.Messages = messages
+	staff := addStaff(t, store, "+15105550101", true)
+	thread := addThread(t, store, "+14155550123", "ABCD")
+
+	rec := postForm(h.SMS(), "/sms", url.Values{"From": {staff.PhoneNumber}, "To": {testOutboundNumber}, "Body": {"On our way"}, "MessageSid": {"SMstaff"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	sent := h.SMSProvider.(*FakeSMSProvider).Sent()
+	want := []SentSMS{{MessageSid: "FAKE1", From: testInboundNumber, To: thread.PhoneNumber, Body: "On our way"}}
+	if !reflect.DeepEqual(sent, want) {
+		t.Fatalf("sent %+v, want %+v", sent, want)
+	}
+
+	if len(messages.inserted) != 2 {
+		t.Fatalf("stored %d messages, want the staff text and the relay: %+v", len(messages.inserted), messages.inserted)
+	}
+
+	received := messages.inserted[0]
+	if received.ThreadID != thread.ID || received.Direction != DirectionInbound || received.From != staff.PhoneNumber ||
+		!reflect.DeepEqual(received.To, []string{testOutboundNumber}) || received.MessageSid != "SMstaff" {
+		t.Errorf("staff text = %+v, want it stored on the thread as sent to the outbound number", received)
+	}
+
+	relayed := messages.inserted[1]
+	if relayed.ThreadID != thread.ID || relayed.Direction != DirectionOutbound || relayed.From != testInboundNumber ||
+		!reflect.DeepEqual(relayed.To, []string{thread.PhoneNumber}) || relayed.Body != "On our way" {
+		t.Errorf("relay = %+v, want it stored as sent from the inbound number to the reporter", relayed)
+	}
+}
+
+func TestSMSStaffReplyWithoutCodeNeedsOneOpenThread(t *testing.T) {
+	h, store, _ := newTestService(t)
+	staff := addStaff(t, store, "+15105550101", true)
+	addThread(t, store, "+14155550123", "ABCD")
+	addThread(t, store, "+14155550124", "EFGH")
+
+	rec := postForm(h.SMS(), "/sms", url.Values{"From": {staff.PhoneNumber}, "To": {testOutboundNumber}, "Body": {"On our way"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	assertBodyContains(t, rec, "Several threads are open", "#ABCD +14155550123", "#EFGH +14155550124", "Commands:")
+
+	if sent := h.SMSProvider.(*FakeSMSProvider).Sent(); len(sent) != 0 {
+		t.Errorf("sent %+v, want nothing relayed", sent)
+	}
+}
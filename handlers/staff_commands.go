@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const staffHelpMessage = `Commands:
+ACK [#code] - acknowledge a thread
+CLOSE [#code] - close a thread
+BLOCK [#code [reason]] - block the sender
+STATUS - list open threads
+ON / OFF - go on or off duty
+#code message - reply to a sender`
+
+// StaffCommand is a parsed command sent by a staff member over SMS.
+type StaffCommand struct {
+	Name   string
+	Code   string
+	Reason string
+}
+
+// parseStaffCommand recognises the staff command language. ok is false when
+// the body should be treated as a reply to a reporter instead.
+//
+// ON, OFF, STATUS and HELP must be sent on their own. ACK and CLOSE take an
+// optional #code. BLOCK takes an optional #code, and a free-form reason only
+// after a #code, so a reply that merely starts with "block" is relayed.
+func parseStaffCommand(body string) (cmd StaffCommand, ok bool) {
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		return StaffCommand{}, false
+	}
+
+	name := utils.UpperString(fields[0])
+	args := fields[1:]
+
+	code := ""
+	if len(args) > 0 && strings.HasPrefix(args[0], "#") && len(args[0]) > 1 {
+		code = utils.UpperString(args[0][1:])
+		args = args[1:]
+	}
+
+	switch name {
+	case "ON", "OFF", "STATUS", "HELP", "?":
+		if len(fields) != 1 {
+			return StaffCommand{}, false
+		}
+		if name == "?" {
+			name = "HELP"
+		}
+		return StaffCommand{Name: name}, true
+	case "ACK", "CLOSE":
+		if len(args) != 0 {
+			return StaffCommand{}, false
+		}
+		return StaffCommand{Name: name, Code: code}, true
+	case "BLOCK":
+		if code == "" && len(args) != 0 {
+			return StaffCommand{}, false
+		}
+		return StaffCommand{Name: name, Code: code, Reason: strings.Join(args, " ")}, true
+	}
+
+	return StaffCommand{}, false
+}
+
+// staffCommandNames are the words parseStaffCommand recognises.
+var staffCommandNames = []string{"ON", "OFF", "STATUS", "HELP", "ACK", "CLOSE", "BLOCK"}
+
+// looksLikeStaffCommand reports whether a message that parseStaffCommand
+// rejected was probably a mistyped command rather than a reply, so it is not
+// relayed to a reporter. That is a command glued to its #code, or a single
+// word one typo away from a command of three or more letters.
+func looksLikeStaffCommand(body string) bool {
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		return false
+	}
+
+	word := utils.UpperString(fields[0])
+	if name, _, found := strings.Cut(word, "#"); found && name != "" {
+		return isStaffCommandName(name) || isStaffCommandTypo(name)
+	}
+
+	return len(fields) == 1 && isStaffCommandTypo(word)
+}
+
+func isStaffCommandName(word string) bool {
+	for _, name := range staffCommandNames {
+		if word == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isStaffCommandTypo reports whether word is one added, dropped, changed or
+// swapped letter away from a command of three or more letters.
+func isStaffCommandTypo(word string) bool {
+	for _, name := range staffCommandNames {
+		if len(name) >= 3 && editDistance(word, name) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b, counting a swap of adjacent letters as one edit.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+// staffLabel identifies a staff member in records written on their behalf.
+func staffLabel(staff storage.Staff) string {
+	if staff.PublicID != "" {
+		return staff.PublicID
+	}
+	return staff.PhoneNumber
+}
+
+// resolveCommandThread finds the thread a command applies to. When no code
+// is given the only open thread is used. It returns a reply for the staff
+// member when no single thread can be chosen.
+func (h *handlers) resolveCommandThread(ctx context.Context, code string) (*storage.Thread, string, error) {
+	if code != "" {
+		thread, err := h.findOpenThreadByCode(ctx, code)
+		if err != nil {
+			return nil, "", err
+		}
+		if thread == nil {
+			return nil, fmt.Sprintf("No open thread #%s.", code), nil
+		}
+		return thread, "", nil
+	}
+
+	threads, err := h.listOpenThreads(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch len(threads) {
+	case 0:
+		return nil, "There are no open threads.", nil
+	case 1:
+		return &threads[0], "", nil
+	}
+
+	for i := range threads {
+		if err := h.ensureThreadCode(ctx, &threads[i]); err != nil {
+			fmt.Println("Error assigning thread code:", err)
+		}
+	}
+
+	return nil, fmt.Sprintf("Several threads are open. Add the thread code, e.g. #%s\n\n%s", threads[0].Code, describeThreads(threads)), nil
+}
+
+// runStaffCommand executes a staff command and replies with a confirmation.
+func (h *handlers) runStaffCommand(ctx context.Context, ginCtx *gin.Context, inbound InboundSMS, staff storage.Staff, cmd StaffCommand, replyFrom string) {
+	reply, err := h.executeStaffCommand(ctx, staff, cmd)
+	if err != nil {
+		fmt.Printf("Error running staff command %s: %v\n", cmd.Name, err)
+		ginCtx.String(http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	h.recordMessage(ctx, storage.Message{
+		Direction: DirectionOutbound,
+		Channel:   ChannelSMS,
+		Kind:      MessageKindCommandReply,
+		From:      replyFrom,
+		To:        []string{staff.PhoneNumber},
+		Body:      reply,
+	})
+
+	h.SMSProvider.Reply(ctx, ginCtx, inbound, reply)
+}
+
+func (h *handlers) executeStaffCommand(ctx context.Context, staff storage.Staff, cmd StaffCommand) (string, error) {
+	fmt.Printf("Staff %s sent command %s\n", staff.PhoneNumber, cmd.Name)
+
+	switch cmd.Name {
+	case "HELP":
+		return staffHelpMessage, nil
+
+	case "ON", "OFF":
+		active := cmd.Name == "ON"
+		if err := h.Store.Staff.SetActive(ctx, staff.ID, active); err != nil {
+			return "", fmt.Errorf("failed to update staff: %w", err)
+		}
+		if active {
+			return "You are now on duty.", nil
+		}
+		return "You are now off duty.", nil
+
+	case "STATUS":
+		threads, err := h.listOpenThreads(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		duty := "off duty"
+		if staff.Active {
+			duty = "on duty"
+		}
+
+		if len(threads) == 0 {
+			return fmt.Sprintf("No open threads. You are %s.", duty), nil
+		}
+
+		var lines []string
+		for i := range threads {
+			if err := h.ensureThreadCode(ctx, &threads[i]); err != nil {
+				fmt.Println("Error assigning thread code:", err)
+			}
+			thread := threads[i]
+			age := h.now().Sub(thread.CreatedAt).Round(time.Minute)
+			lines = append(lines, fmt.Sprintf("#%s %s %s (%s)", thread.Code, thread.PhoneNumber, thread.Status, age))
+		}
+
+		return fmt.Sprintf("%d open thread(s). You are %s.\n\n%s", len(threads), duty, strings.Join(lines, "\n")), nil
+
+	case "ACK":
+		thread, reply, err := h.resolveCommandThread(ctx, cmd.Code)
+		if err != nil || thread == nil {
+			return reply, err
+		}
+
+		updated, err := h.transitionThread(ctx, thread.ID, []string{storage.ThreadStatusOpen}, storage.ThreadStatusAcknowledged, staffLabel(staff))
+		if err != nil {
+			return "", err
+		}
+		if !updated {
+			return fmt.Sprintf("Thread #%s is already acknowledged.", thread.Code), nil
+		}
+		return fmt.Sprintf("Acknowledged thread #%s from %s.", thread.Code, thread.PhoneNumber), nil
+
+	case "CLOSE":
+		thread, reply, err := h.resolveCommandThread(ctx, cmd.Code)
+		if err != nil || thread == nil {
+			return reply, err
+		}
+
+		updated, err := h.transitionThread(ctx, thread.ID, storage.ActiveThreadStatuses, storage.ThreadStatusClosed, staffLabel(staff))
+		if err != nil {
+			return "", err
+		}
+		if !updated {
+			return fmt.Sprintf("Thread #%s is already closed.", thread.Code), nil
+		}
+		return fmt.Sprintf("Closed thread #%s from %s.", thread.Code, thread.PhoneNumber), nil
+
+	case "BLOCK":
+		thread, reply, err := h.resolveCommandThread(ctx, cmd.Code)
+		if err != nil || thread == nil {
+			return reply, err
+		}
+
+		if _, err := h.blockNumber(ctx, thread.PhoneNumber, cmd.Reason, staffLabel(staff), nil); err != nil {
+			return "", err
+		}
+
+		if _, err := h.transitionThread(ctx, thread.ID, storage.ActiveThreadStatuses, storage.ThreadStatusClosed, staffLabel(staff)); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Blocked %s and closed thread #%s.", thread.PhoneNumber, thread.Code), nil
+	}
+
+	return staffHelpMessage, nil
+}
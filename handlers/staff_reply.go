@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// splitThreadCode splits a "#CODE message" reply into its code and message.
+// ok is false when the body does not start with a thread code.
+func splitThreadCode(body string) (code string, message string, ok bool) {
+	body = utils.TrimSpace(body)
+	if !strings.HasPrefix(body, "#") {
+		return "", body, false
+	}
+
+	fields := strings.SplitN(body[1:], " ", 2)
+	code = utils.UpperString(utils.TrimSpace(fields[0]))
+	if code == "" {
+		return "", body, false
+	}
+
+	if len(fields) > 1 {
+		message = utils.TrimSpace(fields[1])
+	}
+
+	return code, message, true
+}
+
+// describeThreads renders a short list of threads for an SMS reply.
+func describeThreads(threads []storage.Thread) string {
+	var lines []string
+	for _, thread := range threads {
+		lines = append(lines, fmt.Sprintf("#%s %s", thread.Code, thread.PhoneNumber))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleStaffMessage handles an SMS from a staff member. Commands are run
+// directly, and messages that look like mistyped commands get the help
+// text; anything else is relayed to the reporter of an open thread. The
+// reply is sent from the inbound dispatch number so the staff member's own
+// number is never shown to the reporter. Staff pick a thread by starting
+// their reply with its code; the code may be left out when only one thread
+// is open.
+func (h *handlers) handleStaffMessage(ctx context.Context, ginCtx *gin.Context, phoneConfig *PhoneNumberConfig, staff storage.Staff, inbound InboundSMS) {
+	body := inbound.Body
+	messageSid := inbound.MessageSid
+
+	cmd, ok := parseStaffCommand(body)
+	if !ok && looksLikeStaffCommand(body) {
+		// A mistyped command is answered with help rather than texted to
+		// a member of the public.
+		cmd, ok = StaffCommand{Name: "HELP"}, true
+	}
+
+	if ok {
+		h.recordMessage(ctx, storage.Message{
+			Direction:  DirectionInbound,
+			Channel:    ChannelSMS,
+			Kind:       MessageKindStaffCommand,
+			From:       staff.PhoneNumber,
+			To:         []string{phoneConfig.Outbound},
+			Body:       body,
+			MessageSid: messageSid,
+		})
+
+		h.runStaffCommand(ctx, ginCtx, inbound, staff, cmd, phoneConfig.Outbound)
+		return
+	}
+
+	code, message, hasCode := splitThreadCode(body)
+
+	thread, reply, err := h.resolveCommandThread(ctx, code)
+	if err != nil {
+		fmt.Println("Error finding thread for staff reply:", err)
+		ginCtx.String(http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	if thread == nil {
+		// Without a code and without a single open thread the message is
+		// neither a reply nor a known command.
+		if !hasCode {
+			reply += "\n\n" + staffHelpMessage
+		}
+		h.SMSProvider.Reply(ctx, ginCtx, inbound, reply)
+		return
+	}
+
+	if message == "" {
+		h.SMSProvider.Reply(ctx, ginCtx, inbound, fmt.Sprintf("Your reply to #%s is empty. Please resend.", thread.Code))
+		return
+	}
+
+	h.recordMessage(ctx, storage.Message{
+		ThreadID:   thread.ID,
+		Direction:  DirectionInbound,
+		Channel:    ChannelSMS,
+		Kind:       MessageKindStaffReply,
+		From:       staff.PhoneNumber,
+		To:         []string{phoneConfig.Outbound},
+		Body:       body,
+		MessageSid: messageSid,
+	})
+
+	fmt.Printf("Relaying reply from staff %s to thread #%s\n", staff.PhoneNumber, thread.Code)
+	h.sendAndRecord(ctx, thread.ID, MessageKindStaffReply, phoneConfig.Inbound, []string{thread.PhoneNumber}, message)
+
+	if err := h.touchThread(ctx, thread.ID); err != nil {
+		fmt.Println("Error recording thread activity:", err)
+	}
+
+	h.SMSProvider.Reply(ctx, ginCtx, inbound, "")
+}
@@ -6,36 +6,54 @@ import (
 	"log"
 	"time"
 
-	"github.com/twilio/twilio-go"
-	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
-	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
 )
 
-type BoundHandle struct {
-	Client  *mongo.Client
-	DbName  string
-	ColName string
-}
-
-func (b *BoundHandle) Collection() *mongo.Collection {
-	return b.Client.Database(b.DbName).Collection(b.ColName)
-}
-
 type MessageTemplates struct {
 	VoiceConnectingMessage       string
 	VoiceMissedCallStaffMessage  string
 	VoiceMissedCallCallerMessage string
 	SMSSenderResponse            string
 	SMSStaffTemplate             string
+	VoiceVoicemailPrompt         string
 }
 
 type Config struct {
-	DatabaseName         string
-	RequestAuthToken     string
+	DatabaseName     string
+	RequestAuthToken string
+	// ValidateSignature is set when webhook routes check X-Twilio-Signature,
+	// so callback URLs no longer need to carry RequestAuthToken.
+	ValidateSignature    bool
 	NotificationStrategy string
 	SkipStaffIgnore      bool
 	Timeout              time.Duration
+	// ThreadInactivityTimeout closes active threads with no activity for
+	// this long. Zero disables auto-closing.
+	ThreadInactivityTimeout time.Duration
+	// RoutingMode is ALL, ROUND_ROBIN or LEAST_RECENT.
+	RoutingMode string
+	// RoutingAckTimeout is how long a routed thread waits for its responder
+	// to acknowledge before the whole group is alerted.
+	RoutingAckTimeout time.Duration
+	// Voice controls how calls sound and ring.
+	Voice VoiceSettings
+	// VoicemailMaxLength is the longest voicemail, in seconds, callers can
+	// leave when nobody answers. Zero disables voicemail.
+	VoicemailMaxLength int
+	// Location is the time zone for schedules, reminders and the {{time}}
+	// template variable. Nil uses the container's local time zone.
+	Location *time.Location
+	// Test is set for the ?test service, so its callbacks come back to it.
+	Test bool
+}
+
+// TestConfig returns the config for the ?test service: the same settings
+// against a separate database, with staff allowed to text the relay.
+func (c Config) TestConfig() Config {
+	c.DatabaseName += "_test"
+	c.SkipStaffIgnore = true
+	c.Test = true
+	return c
 }
 
 type PhoneNumberConfig struct {
@@ -44,81 +62,57 @@ type PhoneNumberConfig struct {
 }
 
 type handlers struct {
-	StaffHandle     *BoundHandle
-	ThreadHandle    *BoundHandle
-	ConfigHandle    *BoundHandle
-	BlockListHandle *BoundHandle
-	ScheduleHandle  *BoundHandle
-	Templates       MessageTemplates
-	Config          Config
+	Store storage.Store
+	// SMSProvider sends texts and reads the /sms webhook. Calls always go
+	// through Twilio.
+	SMSProvider   SMSProvider
+	Notifiers     map[string]Notifier
+	ChatWebhooks  []ChatWebhook
+	EventWebhooks []EventWebhook
+	Templates     MessageTemplates
+	Config        Config
 }
 
-func NewService(client *mongo.Client, databaseName string, config Config, templates MessageTemplates) *handlers {
+func NewService(store storage.Store, sms SMSProvider, config Config, templates MessageTemplates) *handlers {
 	return &handlers{
-		StaffHandle: &BoundHandle{
-			Client:  client,
-			DbName:  databaseName,
-			ColName: "staff",
-		},
-		ThreadHandle: &BoundHandle{
-			Client:  client,
-			DbName:  databaseName,
-			ColName: "threads",
-		},
-		ConfigHandle: &BoundHandle{
-			Client:  client,
-			DbName:  databaseName,
-			ColName: "config",
-		},
-		BlockListHandle: &BoundHandle{
-			Client:  client,
-			DbName:  databaseName,
-			ColName: "blocklist",
-		},
-		ScheduleHandle: &BoundHandle{
-			Client:  client,
-			DbName:  databaseName,
-			ColName: "schedules",
+		Store:       store,
+		SMSProvider: sms,
+		Notifiers: map[string]Notifier{
+			ChannelSMS: &SMSNotifier{Provider: sms},
 		},
 		Templates: templates,
 		Config:    config,
 	}
 }
 
-func (h *handlers) getSystemPhoneNumbers(ctx context.Context) (*PhoneNumberConfig, error) {
-	configCollection := h.ConfigHandle.Collection()
+// RegisterNotifier adds a notification channel staff can opt into, replacing
+// any notifier already registered for the same channel.
+func (h *handlers) RegisterNotifier(notifier Notifier) {
+	h.Notifiers[notifier.Channel()] = notifier
+}
 
-	// Fetch both numbers together
-	cursor, err := configCollection.Find(ctx, bson.M{
-		"key": bson.M{"$in": []string{"inbound_number", "outbound_number"}},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch phone number configs: %w", err)
+// location returns the configured time zone.
+func (h *handlers) location() *time.Location {
+	if h.Config.Location == nil {
+		return time.Local
 	}
-	defer cursor.Close(ctx)
-
-	var inbound, outbound string
-
-	for cursor.Next(ctx) {
-		var config struct {
-			Key   string `bson:"key"`
-			Value string `bson:"value"`
-		}
+	return h.Config.Location
+}
 
-		if err := cursor.Decode(&config); err != nil {
-			return nil, fmt.Errorf("failed to decode config: %w", err)
-		}
+// now returns the current time in the configured time zone.
+func (h *handlers) now() time.Time {
+	return time.Now().In(h.location())
+}
 
-		switch config.Key {
-		case "inbound_number":
-			inbound = config.Value
-		case "outbound_number":
-			outbound = config.Value
-		}
+func (h *handlers) getSystemPhoneNumbers(ctx context.Context) (*PhoneNumberConfig, error) {
+	inbound, err := h.Store.Config.Get(ctx, "inbound_number")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch inbound number config: %w", err)
 	}
 
-	if err := cursor.Err(); err != nil {
-		return nil, fmt.Errorf("cursor error: %w", err)
+	outbound, err := h.Store.Config.Get(ctx, "outbound_number")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch outbound number config: %w", err)
 	}
 
 	return &PhoneNumberConfig{
@@ -127,168 +121,98 @@ func (h *handlers) getSystemPhoneNumbers(ctx context.Context) (*PhoneNumberConfi
 	}, nil
 }
 
-func (h *handlers) sendMessageToGroup(fromNumber string, phoneNumbers []string, message string) {
-	twilioClient := twilio.NewRestClient()
-
-	for _, phoneNumber := range phoneNumbers {
-		params := &twilioApi.CreateMessageParams{}
-		params.SetBody(message)
-		params.SetFrom(fromNumber)
-		params.SetTo(phoneNumber)
-
-		resp, err := twilioClient.Api.CreateMessage(params)
-		if err != nil {
-			log.Printf("Error sending message to %s: %v", phoneNumber, err)
-		} else {
-			log.Printf("Sent message to %s", phoneNumber)
-			if resp.Body != nil {
-				log.Printf("Response: %s", *resp.Body)
-			}
-		}
-	}
+func (h *handlers) sendMessageToGroup(ctx context.Context, fromNumber string, phoneNumbers []string, message string) []storage.MessageDelivery {
+	return sendSMS(ctx, h.SMSProvider, fromNumber, phoneNumbers, message)
 }
 
-func (h *handlers) getActiveStaffPhoneNumbers(ctx context.Context) ([]string, error) {
-	staffCollection := h.StaffHandle.Collection()
-
-	cursor, err := staffCollection.Find(ctx, bson.M{"active": true})
+func (h *handlers) getActiveStaff(ctx context.Context) ([]storage.Staff, error) {
+	staff, err := h.Store.Staff.ListActive(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving active staff: %w", err)
 	}
-	defer cursor.Close(ctx)
-
-	var phoneNumbers []string
-	for cursor.Next(ctx) {
-		var staff Staff
-		if err := cursor.Decode(&staff); err != nil {
-			log.Printf("Error decoding staff member: %v", err)
-			continue
-		}
-		phoneNumbers = append(phoneNumbers, staff.PhoneNumber)
-	}
 
-	if err := cursor.Err(); err != nil {
-		return nil, fmt.Errorf("cursor error: %w", err)
-	}
-
-	return phoneNumbers, nil
+	return staff, nil
 }
 
-type Staff struct {
-	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id"`
-	PublicID    string        `bson:"id" json:"id"`
-	PhoneNumber string        `bson:"phone_number" json:"phone_number"`
-	Active      bool          `bson:"active" json:"active"`
-}
-
-type Thread struct {
-	ID          bson.ObjectID `bson:"_id"`
-	PhoneNumber string        `bson:"phone_number"`
-	Status      string        `bson:"status"`
-	CreatedAt   time.Time     `bson:"created_at"`
+// phoneNumbersOf returns the phone numbers of the given staff members.
+func phoneNumbersOf(staff []storage.Staff) []string {
+	var phoneNumbers []string
+	for _, member := range staff {
+		phoneNumbers = append(phoneNumbers, member.PhoneNumber)
+	}
+	return phoneNumbers
 }
 
-type BlockedNumber struct {
-	ID          bson.ObjectID `bson:"_id,omitempty"`
-	PhoneNumber string        `bson:"phone_number"`
-	CreatedAt   time.Time     `bson:"created_at"`
-	Reason      string        `bson:"reason"`
-	BlockedBy   string        `bson:"blocked_by"`
+// getOnCallStaff returns the staff members who are currently on-call based
+// on their schedule entries.
+// Falls back to all active staff if no schedules are configured.
+func (h *handlers) getOnCallStaff(ctx context.Context) ([]storage.Staff, error) {
+	staff, _, err := h.getOnCallStaffAt(ctx, h.now())
+	return staff, err
 }
 
-type Schedule struct {
-	ID          bson.ObjectID `bson:"_id,omitempty"`
-	UID         int           `bson:"uid"`
-	PhoneNumber string        `bson:"phone_number"`
-	StartTime   string        `bson:"start_time"`
-	EndTime     string        `bson:"end_time"`
-	DayOfWeek   int           `bson:"day_of_week"`
-	Recurring   bool          `bson:"recurring"`
-	Always      bool          `bson:"always"`
-	Date        string        `bson:"date"`
+// getOnCallStaffAt returns the staff members on-call at the given time.
+// fallback reports whether the result is all active staff because no
+// schedule matched.
+func (h *handlers) getOnCallStaffAt(ctx context.Context, now time.Time) (staff []storage.Staff, fallback bool, err error) {
+	return h.getOnCallStaffInTier(ctx, now, 0)
 }
 
-// getOnCallStaffPhoneNumbers returns the phone numbers of staff members
-// who are currently on-call based on their schedule entries.
-// Falls back to all active staff if no schedules are configured.
-func (h *handlers) getOnCallStaffPhoneNumbers(ctx context.Context) ([]string, error) {
-	activePhones, err := h.getActiveStaffPhoneNumbers(ctx)
+// getOnCallStaffInTier returns the staff members on-call at the given time
+// on shifts of the given schedule tier. Tier 0 matches every tier.
+func (h *handlers) getOnCallStaffInTier(ctx context.Context, now time.Time, tier int) (staff []storage.Staff, fallback bool, err error) {
+	activeStaff, err := h.getActiveStaff(ctx)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	scheduleCollection := h.ScheduleHandle.Collection()
-
-	count, err := scheduleCollection.CountDocuments(ctx, bson.M{})
+	count, err := h.Store.Schedules.Count(ctx)
 	if err != nil {
-		log.Printf("Error checking schedule collection, falling back to all active staff: %v", err)
-		return activePhones, nil
+		log.Printf("Error counting schedules, falling back to all active staff: %v", err)
+		return activeStaff, true, nil
 	}
 
 	if count == 0 {
 		log.Println("No schedules configured, using all active staff")
-		return activePhones, nil
+		return activeStaff, true, nil
 	}
 
-	now := time.Now()
-	currentTime := now.Format("15:04")
-	currentDayOfWeek := int(now.Weekday())
-	currentDate := now.Format("2006-01-02")
-
-	filter := bson.M{
-		"$or": []bson.M{
-			{
-				"always": true,
-			},
-			{
-				"recurring":   true,
-				"day_of_week": currentDayOfWeek,
-				"start_time":  bson.M{"$lte": currentTime},
-				"end_time":    bson.M{"$gte": currentTime},
-			},
-			{
-				"recurring":  false,
-				"date":       currentDate,
-				"start_time": bson.M{"$lte": currentTime},
-				"end_time":   bson.M{"$gte": currentTime},
-			},
-		},
-	}
-
-	cursor, err := scheduleCollection.Find(ctx, filter)
+	// Yesterday's overnight shifts may still be running, and schedules in
+	// other time zones may already be on tomorrow.
+	now = now.In(h.location())
+	schedules, err := h.findCandidateSchedules(ctx, now.AddDate(0, 0, -1), now, now.AddDate(0, 0, 1))
 	if err != nil {
 		log.Printf("Error querying schedules, falling back to all active staff: %v", err)
-		return activePhones, nil
+		return activeStaff, true, nil
 	}
-	defer cursor.Close(ctx)
 
 	onCallPhones := make(map[string]bool)
-	for cursor.Next(ctx) {
-		var schedule Schedule
-		if err := cursor.Decode(&schedule); err != nil {
-			log.Printf("Error decoding schedule: %v", err)
+	for _, schedule := range schedules {
+		if tier > 0 && scheduleTier(schedule) != tier {
 			continue
 		}
-		onCallPhones[schedule.PhoneNumber] = true
+		if coversTime(schedule, now, h.location()) {
+			onCallPhones[schedule.PhoneNumber] = true
+		}
 	}
 
 	if len(onCallPhones) == 0 {
 		log.Println("No staff currently on-call, falling back to all active staff")
-		return activePhones, nil
+		return activeStaff, true, nil
 	}
 
-	var filteredPhones []string
-	for _, phone := range activePhones {
-		if onCallPhones[phone] {
-			filteredPhones = append(filteredPhones, phone)
+	var filteredStaff []storage.Staff
+	for _, member := range activeStaff {
+		if onCallPhones[member.PhoneNumber] {
+			filteredStaff = append(filteredStaff, member)
 		}
 	}
 
-	if len(filteredPhones) == 0 {
+	if len(filteredStaff) == 0 {
 		log.Println("On-call staff found in schedules but none are active in staff list, falling back to all active staff")
-		return activePhones, nil
+		return activeStaff, true, nil
 	}
 
-	log.Printf("Filtered to %d on-call staff members out of %d active", len(filteredPhones), len(activePhones))
-	return filteredPhones, nil
+	log.Printf("Filtered to %d on-call staff members out of %d active", len(filteredStaff), len(activeStaff))
+	return filteredStaff, false, nil
 }
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// threadCodeAlphabet leaves out characters that are easy to mistype on a
+// phone keyboard (0/O, 1/I/L).
+const threadCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const threadCodeLength = 4
+
+// newThreadCode returns a short random code staff can use to address a thread.
+func newThreadCode() (string, error) {
+	code := make([]byte, threadCodeLength)
+	max := big.NewInt(int64(len(threadCodeAlphabet)))
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = threadCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// generateThreadCode returns a code that is not used by any other active thread.
+func (h *handlers) generateThreadCode(ctx context.Context) (string, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		code, err := newThreadCode()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate thread code: %w", err)
+		}
+
+		existing, err := h.Store.Threads.FindActiveByCode(ctx, code)
+		if err != nil {
+			return "", fmt.Errorf("failed to check thread code: %w", err)
+		}
+		if existing == nil {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to find an unused thread code")
+}
+
+// findOpenThread returns the active thread for a phone number, or nil if
+// there is none.
+func (h *handlers) findOpenThread(ctx context.Context, phoneNumber string) (*storage.Thread, error) {
+	return h.Store.Threads.FindActiveByPhoneNumber(ctx, phoneNumber)
+}
+
+// findOpenThreadByCode returns the active thread with the given code, or nil
+// if there is none.
+func (h *handlers) findOpenThreadByCode(ctx context.Context, code string) (*storage.Thread, error) {
+	return h.Store.Threads.FindActiveByCode(ctx, code)
+}
+
+// listOpenThreads returns all active threads, oldest first.
+func (h *handlers) listOpenThreads(ctx context.Context) ([]storage.Thread, error) {
+	threads, err := h.Store.Threads.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving open threads: %w", err)
+	}
+
+	return threads, nil
+}
+
+// openThread returns the active thread for a phone number, creating one if
+// there is none. created reports whether this call made the thread. Only one
+// active thread can be stored per number, so when a reporter's texts and
+// calls arrive at once exactly one request creates it and alerts staff; the
+// others get the thread it created.
+func (h *handlers) openThread(ctx context.Context, phoneNumber string) (thread *storage.Thread, created bool, err error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		thread, err = h.findOpenThread(ctx, phoneNumber)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to find thread: %w", err)
+		}
+		if thread != nil {
+			return thread, false, nil
+		}
+
+		thread, err = h.createThread(ctx, phoneNumber)
+		if errors.Is(err, storage.ErrDuplicate) {
+			// Another request opened a thread first. It may have been
+			// closed again already, so look it up once more.
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return thread, true, nil
+	}
+
+	return nil, false, fmt.Errorf("failed to open a thread for %s", phoneNumber)
+}
+
+// createThread opens a new thread for a phone number. If the number had a
+// thread before, the new thread links back to the most recently closed one.
+func (h *handlers) createThread(ctx context.Context, phoneNumber string) (*storage.Thread, error) {
+	code, err := h.generateThreadCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := h.Store.Threads.FindLastClosed(ctx, phoneNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find previous thread: %w", err)
+	}
+
+	now := time.Now()
+	thread := storage.Thread{
+		ID:             bson.NewObjectID(),
+		PhoneNumber:    phoneNumber,
+		Code:           code,
+		Status:         storage.ThreadStatusOpen,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		LastActivityAt: now,
+		Transitions: []storage.ThreadTransition{
+			{Status: storage.ThreadStatusOpen, At: now, By: phoneNumber},
+		},
+	}
+
+	if previous != nil {
+		thread.PreviousThreadID = &previous.ID
+	}
+
+	if err := h.Store.Threads.Insert(ctx, thread); err != nil {
+		return nil, fmt.Errorf("failed to create thread: %w", err)
+	}
+
+	h.emitEvent(ctx, EventThreadCreated, map[string]any{"thread": thread})
+
+	return &thread, nil
+}
+
+// ensureThreadCode assigns a code to threads created before codes existed.
+func (h *handlers) ensureThreadCode(ctx context.Context, thread *storage.Thread) error {
+	if thread.Code != "" {
+		return nil
+	}
+
+	code, err := h.generateThreadCode(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Store.Threads.SetCode(ctx, thread.ID, code); err != nil {
+		return fmt.Errorf("failed to assign thread code: %w", err)
+	}
+
+	thread.Code = code
+	return nil
+}
+
+// transitionThread moves a thread to a new status if it is currently in one
+// of the given statuses, recording when and by whom. It reports whether the
+// thread was updated.
+func (h *handlers) transitionThread(ctx context.Context, threadID bson.ObjectID, from []string, to string, by string) (bool, error) {
+	thread, err := h.Store.Threads.Transition(ctx, threadID, from, to, by, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to update thread status: %w", err)
+	}
+	if thread == nil {
+		return false, nil
+	}
+
+	if to == storage.ThreadStatusClosed {
+		h.emitEvent(ctx, EventThreadClosed, map[string]any{"thread": thread})
+	}
+
+	return true, nil
+}
+
+// touchThread records activity on a thread, pushing back its inactivity
+// timeout.
+func (h *handlers) touchThread(ctx context.Context, threadID bson.ObjectID) error {
+	if err := h.Store.Threads.Touch(ctx, threadID, time.Now()); err != nil {
+		return fmt.Errorf("failed to record thread activity: %w", err)
+	}
+
+	return nil
+}
+
+// CloseInactiveThreads closes every active thread that has seen no activity
+// for longer than the configured inactivity timeout. Threads created before
+// activity was tracked fall back to their creation time.
+func (h *handlers) CloseInactiveThreads(ctx context.Context) {
+	if h.Config.ThreadInactivityTimeout <= 0 {
+		return
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-h.Config.ThreadInactivityTimeout)
+
+	// Threads are closed one at a time so each close is reported as an
+	// event. A thread that saw activity in the meantime stays open.
+	closed := 0
+	for {
+		thread, err := h.Store.Threads.CloseInactive(ctx, cutoff, "system:inactivity", now)
+		if err != nil {
+			log.Printf("Thread expiry: error closing inactive threads: %v", err)
+			break
+		}
+		if thread == nil {
+			break
+		}
+		h.emitEvent(ctx, EventThreadClosed, map[string]any{"thread": thread})
+		closed++
+	}
+
+	if closed > 0 {
+		log.Printf("Thread expiry: closed %d inactive threads", closed)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go/twiml"
+)
+
+// Caller ID modes decide which number staff phones show when a call is
+// forwarded to them.
+const (
+	// CallerIDSystem shows the relay's inbound number.
+	CallerIDSystem = "SYSTEM"
+	// CallerIDCaller shows the reporter's number.
+	CallerIDCaller = "CALLER"
+)
+
+const (
+	DefaultVoice    = "Google.en-US-Chirp3-HD-Kore"
+	DefaultLanguage = "en-US"
+	// defaultDialTimeout is how long staff phones ring without an
+	// escalation policy when no dial timeout is configured.
+	defaultDialTimeout = 20
+)
+
+// VoiceSettings controls how calls sound and ring.
+type VoiceSettings struct {
+	// Voice and Language are used for every <Say>. Empty uses Twilio's
+	// default.
+	Voice    string
+	Language string
+	// DialTimeout is how long staff phones ring, in seconds, without an
+	// escalation policy.
+	DialTimeout int
+	// RingTone is the ringback tone callers hear while staff phones ring,
+	// as a country code such as "us" or "uk". Empty uses Twilio's default.
+	RingTone string
+	// CallerID is SYSTEM or CALLER.
+	CallerID string
+}
+
+// dialTimeout returns how long staff phones ring without an escalation
+// policy.
+func (h *handlers) dialTimeout() int {
+	if h.Config.Voice.DialTimeout > 0 {
+		return h.Config.Voice.DialTimeout
+	}
+	return defaultDialTimeout
+}
+
+// voiceResponse builds the TwiML for a call, so every response uses the
+// configured voice and ring settings.
+type voiceResponse struct {
+	settings VoiceSettings
+	elements []twiml.Element
+}
+
+func (h *handlers) newVoiceResponse() *voiceResponse {
+	return &voiceResponse{settings: h.Config.Voice}
+}
+
+func (r *voiceResponse) sayElement(message string) *twiml.VoiceSay {
+	return &twiml.VoiceSay{
+		Message:  message,
+		Voice:    r.settings.Voice,
+		Language: r.settings.Language,
+	}
+}
+
+// say speaks a message.
+func (r *voiceResponse) say(message string) *voiceResponse {
+	r.elements = append(r.elements, r.sayElement(message))
+	return r
+}
+
+// dial rings every phone number at once for timeout seconds, then requests
+// action.
+func (r *voiceResponse) dial(callerID string, action string, timeout int, phoneNumbers []string) *voiceResponse {
+	numbers := make([]twiml.Element, 0, len(phoneNumbers))
+	for _, phoneNumber := range phoneNumbers {
+		numbers = append(numbers, &twiml.VoiceNumber{PhoneNumber: phoneNumber})
+	}
+
+	r.elements = append(r.elements, &twiml.VoiceDial{
+		Action:        action,
+		Method:        http.MethodPost,
+		Timeout:       strconv.Itoa(timeout),
+		CallerId:      callerID,
+		RingTone:      r.settings.RingTone,
+		InnerElements: numbers,
+	})
+	return r
+}
+
+// gather speaks the prompts while waiting timeout seconds for one key
+// press, which is sent to action.
+func (r *voiceResponse) gather(action string, timeout int, prompts ...string) *voiceResponse {
+	says := make([]twiml.Element, 0, len(prompts))
+	for _, prompt := range prompts {
+		says = append(says, r.sayElement(prompt))
+	}
+
+	r.elements = append(r.elements, &twiml.VoiceGather{
+		Input:         "dtmf",
+		NumDigits:     "1",
+		Timeout:       strconv.Itoa(timeout),
+		Action:        action,
+		Method:        http.MethodPost,
+		InnerElements: says,
+	})
+	return r
+}
+
+// record records the caller.
+func (r *voiceResponse) record(record *twiml.VoiceRecord) *voiceResponse {
+	r.elements = append(r.elements, record)
+	return r
+}
+
+// redirect continues the call with the TwiML at url.
+func (r *voiceResponse) redirect(url string) *voiceResponse {
+	r.elements = append(r.elements, &twiml.VoiceRedirect{Url: url, Method: http.MethodPost})
+	return r
+}
+
+// hangup ends the call.
+func (r *voiceResponse) hangup() *voiceResponse {
+	r.elements = append(r.elements, &twiml.VoiceHangup{})
+	return r
+}
+
+func (r *voiceResponse) toXML() (string, error) {
+	return twiml.Voice(r.elements)
+}
+
+// respondTwiML writes a TwiML document, or a server error if it could not
+// be created.
+func respondTwiML(ginCtx *gin.Context, twimlResult string, err error) {
+	if err != nil {
+		log.Printf("Error creating TwiML document: %v", err)
+		ginCtx.String(http.StatusInternalServerError, "Server error")
+		return
+	}
+
+	writeTwiML(ginCtx, twimlResult)
+}
+
+func writeTwiML(ginCtx *gin.Context, twimlResult string) {
+	ginCtx.Header("Content-Type", "text/xml")
+	ginCtx.String(http.StatusOK, twimlResult)
+}
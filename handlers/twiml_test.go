@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestVoiceResponsesGolden renders every voice response with values that
+// would break hand-built XML: markup in templates, a From number that is
+// not a phone number and a request token that needs URL escaping.
+func TestVoiceResponsesGolden(t *testing.T) {
+	const (
+		from    = `+1 (415) 867-5309"/><Hangup/>`
+		inbound = "+15105550100"
+	)
+	numbers := []string{"+15105550101", "+15105550102"}
+	threadID, _ := bson.ObjectIDFromHex("65f1c0de0000000000000001")
+
+	h := &handlers{
+		Config: Config{
+			RequestAuthToken:   "s3cret&x=<y>",
+			VoicemailMaxLength: 120,
+			Voice: VoiceSettings{
+				Voice:       DefaultVoice,
+				Language:    DefaultLanguage,
+				DialTimeout: defaultDialTimeout,
+				CallerID:    CallerIDSystem,
+			},
+		},
+		Templates: MessageTemplates{
+			VoiceConnectingMessage:       `Connecting you to <Dispatch> & "staff". Please hold.`,
+			VoiceMissedCallCallerMessage: "Nobody is available </Say><Dial>+15550000000</Dial>",
+			VoiceVoicemailPrompt:         "Leave a message & we'll call back.",
+		},
+	}
+
+	callerID := *h
+	callerID.Config.Voice.CallerID = CallerIDCaller
+	callerID.Config.Voice.RingTone = "uk"
+
+	menu := testVoiceMenu()
+
+	tests := []struct {
+		name   string
+		render func() (string, error)
+	}{
+		{"ignored_call", func() (string, error) { return h.newVoiceResponse().toXML() }},
+		{"no_staff", func() (string, error) { return h.dialStaffTwiML(nil, from, inbound, -1, h.dialTimeout()) }},
+		{"dial", func() (string, error) {
+			return h.dialTwiML(h.Templates.VoiceConnectingMessage, inbound, from, -1, h.dialTimeout(), numbers)
+		}},
+		{"dial_escalation_tier", func() (string, error) {
+			return h.dialTwiML(escalatingCallMessage, inbound, from, 1, 45, numbers)
+		}},
+		{"dial_caller_id", func() (string, error) {
+			return callerID.dialTwiML(h.Templates.VoiceConnectingMessage, inbound, from, -1, h.dialTimeout(), numbers)
+		}},
+		{"call_answered", h.callAnsweredTwiML},
+		{"missed_call", h.missedCallTwiML},
+		{"voicemail", func() (string, error) { return h.voicemailTwiML(from, threadID, "") }},
+		{"voicemail_left", func() (string, error) { return h.sayAndHangUpTwiML(h.Templates.VoiceMissedCallCallerMessage) }},
+		{"voice_menu", func() (string, error) { return h.voiceMenuTwiML(menu, from, "", "") }},
+		{"voice_menu_invalid_choice", func() (string, error) {
+			return h.voiceMenuTwiML(menu.Options[2].Menu, from, "3", invalidMenuChoiceMessage)
+		}},
+		{"voice_menu_say", func() (string, error) {
+			return h.sayAndHangUpTwiML(menu.Options[2].Menu.Options[0].Message)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.render()
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			got = canonicalTwiML(t, got)
+
+			path := filepath.Join("testdata", "twiml", tt.name+".xml")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading golden file (run with -update to create it): %v", err)
+			}
+			if got != strings.TrimSuffix(string(want), "\n") {
+				t.Errorf("%s =\n%s\nwant\n%s", tt.name, got, want)
+			}
+		})
+	}
+}
+
+func TestVoiceResponseUsesSettings(t *testing.T) {
+	h := &handlers{Config: Config{
+		ValidateSignature: true,
+		Voice: VoiceSettings{
+			Voice:    "Polly.Joanna",
+			Language: "en-GB",
+			RingTone: "uk",
+			CallerID: CallerIDCaller,
+		},
+	}}
+
+	got, err := h.dialTwiML("Please hold.", "+15105550100", "+14158675309", -1, h.dialTimeout(), []string{"+15105550101"})
+	if err != nil {
+		t.Fatalf("dialTwiML: %v", err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?><Response>` +
+		`<Say language="en-GB" voice="Polly.Joanna">Please hold.</Say>` +
+		`<Dial action="/voice-status?from=%2B14158675309" callerId="+14158675309" method="POST" ringTone="uk" timeout="20">` +
+		`<Number>+15105550101</Number>` +
+		`</Dial></Response>`
+	if canonicalTwiML(t, got) != canonicalTwiML(t, want) {
+		t.Errorf("dialTwiML =\n%s\nwant\n%s", got, want)
+	}
+
+	// Prompts inside a menu use the same voice.
+	menu, err := h.voiceMenuTwiML(testVoiceMenu(), "+14158675309", "", invalidMenuChoiceMessage)
+	if err != nil {
+		t.Fatalf("voiceMenuTwiML: %v", err)
+	}
+	if n := strings.Count(menu, `voice="Polly.Joanna"`); n != 2 {
+		t.Errorf("menu has %d Says with the configured voice, want 2:\n%s", n, menu)
+	}
+}
+
+func TestVoiceResponseCallerIDSystem(t *testing.T) {
+	h := &handlers{Config: Config{Voice: VoiceSettings{CallerID: CallerIDSystem, DialTimeout: 35}}}
+
+	got, err := h.dialTwiML("Please hold.", "+15105550100", "+14158675309", -1, h.dialTimeout(), []string{"+15105550101"})
+	if err != nil {
+		t.Fatalf("dialTwiML: %v", err)
+	}
+	for _, want := range []string{`callerId="+15105550100"`, `timeout="35"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("TwiML is missing %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestVoiceResponseEscapesText(t *testing.T) {
+	h := &handlers{}
+
+	got, err := h.newVoiceResponse().say("The office is open 9 to 5 <weekdays> & Saturdays.").hangup().toXML()
+	if err != nil {
+		t.Fatalf("toXML: %v", err)
+	}
+	if !strings.Contains(got, "<Say>The office is open 9 to 5 &lt;weekdays&gt; &amp; Saturdays.</Say><Hangup/>") {
+		t.Errorf("TwiML = %s", got)
+	}
+}
+
+// canonicalTwiML rewrites a TwiML document with sorted attributes, since the
+// twiml package writes them in map order.
+func canonicalTwiML(t *testing.T, doc string) string {
+	t.Helper()
+
+	var out strings.Builder
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return out.String()
+		}
+		if err != nil {
+			t.Fatalf("invalid TwiML %q: %v", doc, err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			sort.Slice(token.Attr, func(i, j int) bool { return token.Attr[i].Name.Local < token.Attr[j].Name.Local })
+			out.WriteString("<" + token.Name.Local)
+			for _, attr := range token.Attr {
+				out.WriteString(" " + attr.Name.Local + `="`)
+				xml.EscapeText(&out, []byte(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			out.WriteString("</" + token.Name.Local + ">")
+		case xml.CharData:
+			xml.EscapeText(&out, token)
+		}
+	}
+}
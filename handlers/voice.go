@@ -5,14 +5,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
-	"github.com/berkeley-neighbors/dispatch-relay/utils"
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
 
 	"github.com/gin-gonic/gin"
-	"github.com/twilio/twilio-go/twiml"
 	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type VoiceHandlerOptions struct {
@@ -28,14 +27,8 @@ type VoiceStatusHandlerOptions struct {
 
 func (h *handlers) Voice() gin.HandlerFunc {
 	return func(ginCtx *gin.Context) {
-		value, _ := ginCtx.GetQuery("token")
-
-		if value != h.Config.RequestAuthToken {
-			ginCtx.String(http.StatusUnauthorized, "Unauthorized")
-			return
-		}
-
 		from := ginCtx.PostForm("From")
+		to := ginCtx.PostForm("To")
 		callSid := ginCtx.PostForm("CallSid")
 
 		if from == "" {
@@ -49,7 +42,7 @@ func (h *handlers) Voice() gin.HandlerFunc {
 		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
 		defer cancel()
 
-		// Fetch phone number configuration from MongoDB
+		// Fetch phone number configuration
 		phoneConfig, err := h.getSystemPhoneNumbers(timedCtx)
 		if err != nil {
 			fmt.Println("Error fetching phone number config:", err)
@@ -57,37 +50,28 @@ func (h *handlers) Voice() gin.HandlerFunc {
 			return
 		}
 
-		staffCollection := h.StaffHandle.Collection()
-		blockListCollection := h.BlockListHandle.Collection()
-
-		var staffMatch Staff
-		var blockMatch BlockedNumber
-		filter := bson.M{"phone_number": from}
-
 		// Is Staff?
-		err = staffCollection.FindOne(timedCtx, filter).Decode(&staffMatch)
-		isStaffMember := (err == nil)
+		staffMatch, err := h.Store.Staff.FindByPhoneNumber(timedCtx, from)
+		if err != nil {
+			log.Printf("Error looking up staff member %s: %v", from, err)
+		}
+		isStaffMember := staffMatch != nil
 
 		if isStaffMember && !h.Config.SkipStaffIgnore {
 			fmt.Println("Call from staff member. Ignoring.")
 			// Return empty TwiML to hang up
-			doc, _ := twiml.CreateDocument()
-			xml, err := twiml.ToXML(doc)
-
-			if err != nil {
-				fmt.Println("Error creating TwiML document:", err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
-			}
-
-			ginCtx.Header("Content-Type", "text/xml")
-			ginCtx.String(http.StatusOK, xml)
+			twimlResult, err := h.newVoiceResponse().toXML()
+			respondTwiML(ginCtx, twimlResult, err)
 			return
 		}
 
 		// Is Blocked?
-		err = blockListCollection.FindOne(timedCtx, filter).Decode(&blockMatch)
-		isBlocked := (err == nil)
+		isBlocked, err := h.isBlocked(timedCtx, from)
+		if err != nil {
+			fmt.Printf("Error checking blocklist for %s: %v", from, err)
+			ginCtx.String(http.StatusInternalServerError, "Server error")
+			return
+		}
 
 		if isBlocked {
 			fmt.Println("Number is blocked:", from)
@@ -95,181 +79,263 @@ func (h *handlers) Voice() gin.HandlerFunc {
 			return
 		}
 
-		if err != nil && err != mongo.ErrNoDocuments {
-			fmt.Printf("Error finding staff number %s: %v", from, err)
+		openThread, created, err := h.openThread(timedCtx, from)
+		if err != nil {
+			fmt.Printf("Error opening thread for %s: %v", from, err)
 			ginCtx.String(http.StatusInternalServerError, "Server error")
 			return
 		}
 
-		threadCollection := h.ThreadHandle.Collection()
-
-		var openThread Thread
-		filter = bson.M{"phone_number": from, "status": "OPEN"}
-
-		err = threadCollection.FindOne(timedCtx, filter).Decode(&openThread)
-
-		if err != mongo.ErrNoDocuments && err != nil {
-			fmt.Printf("Error finding threads for %s: %v", from, err)
-			ginCtx.String(http.StatusInternalServerError, "Server error")
-			return
+		if created {
+			fmt.Printf("Created new thread for voice call from %s", from)
+		} else if err := h.touchThread(timedCtx, openThread.ID); err != nil {
+			fmt.Printf("Error recording thread activity for %s: %v", from, err)
 		}
 
-		// Create thread if it doesn't exist
-		if err == mongo.ErrNoDocuments {
-			fmt.Printf("Creating new thread for voice call from %s", from)
-			_, err = threadCollection.InsertOne(timedCtx, bson.M{
-				"phone_number": from,
-				"status":       "OPEN",
-				"created_at":   time.Now(),
-			})
-
-			if err != nil {
-				fmt.Printf("Error creating thread for %s: %v", from, err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
-			}
+		h.recordMessage(timedCtx, storage.Message{
+			ThreadID:  openThread.ID,
+			Direction: DirectionInbound,
+			Channel:   ChannelVoice,
+			Kind:      MessageKindCall,
+			From:      from,
+			To:        []string{to},
+			CallSid:   callSid,
+		})
+
+		menu, err := h.getVoiceMenu(timedCtx)
+		if err != nil {
+			log.Printf("Error loading voice menu, dialing staff: %v", err)
 		}
 
-		phoneNumbers, err := h.getOnCallStaffPhoneNumbers(timedCtx)
+		var twimlResult string
+		if menu != nil {
+			twimlResult, err = h.voiceMenuTwiML(menu, from, "", "")
+		} else {
+			twimlResult, err = h.connectCallTwiML(timedCtx, from, phoneConfig.Inbound)
+		}
 		if err != nil {
-			fmt.Printf("Error retrieving on-call staff: %v", err)
+			fmt.Printf("Error building call response: %v", err)
 			ginCtx.String(http.StatusInternalServerError, "Server error")
 			return
 		}
 
-		// If caller is a staff member in test mode, remove their number from the list
-		if isStaffMember && h.Config.SkipStaffIgnore {
-			filteredNumbers := make([]string, 0, len(phoneNumbers))
-			for _, phoneNumber := range phoneNumbers {
-				if phoneNumber != from {
-					filteredNumbers = append(filteredNumbers, phoneNumber)
-				} else {
-					fmt.Printf("Skipping caller's own number from dial list: %s\n", from)
-				}
-			}
-			phoneNumbers = filteredNumbers
-		}
+		writeTwiML(ginCtx, twimlResult)
+	}
+}
 
-		if len(phoneNumbers) == 0 {
-			fmt.Printf("No active staff members found in database")
-			say := &twiml.VoiceSay{
-				Message: "Sorry, no dispatch staff are currently available. Please try again later or send a text message.",
-			}
+// noStaffAvailableMessage is said when there is nobody to ring.
+const noStaffAvailableMessage = "Sorry, no dispatch staff are currently available. Please try again later or send a text message."
 
-			twimlResult, err := twiml.Voice([]twiml.Element{say})
-			if err != nil {
-				ginCtx.String(http.StatusInternalServerError, err.Error())
-			} else {
-				ginCtx.Header("Content-Type", "text/xml")
-				ginCtx.String(http.StatusOK, twimlResult)
-			}
-			return
-		}
+// connectCallTwiML returns TwiML that rings the on-call staff, or the first
+// escalation tier.
+func (h *handlers) connectCallTwiML(ctx context.Context, from string, callerID string) (string, error) {
+	dialStaff, tier, timeout, err := h.callRecipients(ctx, -1)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving on-call staff: %w", err)
+	}
 
-		fmt.Printf("Attempting to connect caller %s to %d on-call staff members", from, len(phoneNumbers))
+	return h.dialStaffTwiML(dialStaff, from, callerID, tier, timeout)
+}
 
-		// Create TwiML to forward the call to staff members using raw XML
-		var twimlResult string
-		if len(phoneNumbers) > 0 {
-			twimlXml := `<?xml version="1.0" encoding="UTF-8"?>
-<Response>
-    <Say language="en-US" voice="Google.en-US-Chirp3-HD-Kore">` + h.Templates.VoiceConnectingMessage + `</Say>
-    <Dial timeout="20" callerId="` + phoneConfig.Inbound + `" action="/voice-status?token=` + h.Config.RequestAuthToken + `&amp;from=` + from + `">`
-
-			for _, phoneNumber := range phoneNumbers {
-				twimlXml += `<Number>` + phoneNumber + `</Number>`
-			}
+// dialStaffTwiML returns TwiML that rings the given staff, or apologises if
+// there is nobody to ring.
+func (h *handlers) dialStaffTwiML(dialStaff []storage.Staff, from string, callerID string, tier int, timeout int) (string, error) {
+	phoneNumbers := dialNumbers(dialStaff, from)
 
-			twimlXml += `
-    </Dial>
-</Response>`
+	if len(phoneNumbers) == 0 {
+		fmt.Printf("No active staff members found in database")
+		return h.newVoiceResponse().say(noStaffAvailableMessage).toXML()
+	}
 
-			twimlResult = twimlXml
-			err = nil
-		} else {
-			// Fallback if no valid numbers
-			fallbackSay := &twiml.VoiceSay{
-				Message: "Sorry, no dispatch staff are currently available. Please try again later.",
-			}
-			twimlResult, err = twiml.Voice([]twiml.Element{fallbackSay})
-		}
+	fmt.Printf("Attempting to connect caller %s to %d on-call staff members", from, len(phoneNumbers))
+	return h.dialTwiML(h.Templates.VoiceConnectingMessage, callerID, from, tier, timeout, phoneNumbers)
+}
+
+// callRecipients returns the staff to ring after the given escalation tier,
+// the tier they belong to and how long to ring them. Pass -1 for the first
+// dial. Without an escalation policy every on-call member is rung at once,
+// with tier -1, and nobody is left after that.
+func (h *handlers) callRecipients(ctx context.Context, afterTier int) (staff []storage.Staff, tier int, timeout int, err error) {
+	policy, err := h.getEscalationPolicy(ctx)
+	if err != nil {
+		log.Printf("Error loading escalation policy, ringing all on-call staff: %v", err)
+	}
 
+	if policy != nil {
+		tier, staff, err := h.nextEscalationTier(ctx, policy, afterTier+1, h.now())
 		if err != nil {
-			fmt.Printf("Error creating TwiML: %v", err)
-			ginCtx.String(http.StatusInternalServerError, err.Error())
-		} else {
-			ginCtx.Header("Content-Type", "text/xml")
-			ginCtx.String(http.StatusOK, twimlResult)
+			return nil, -1, 0, err
+		}
+		if tier >= 0 {
+			return staff, tier, policy.Tiers[tier].TimeoutSeconds, nil
+		}
+		if afterTier >= 0 {
+			return nil, -1, 0, nil
 		}
+		log.Println("No escalation tier has anyone to ring, falling back to on-call staff")
+	} else if afterTier >= 0 {
+		return nil, -1, 0, nil
 	}
-}
 
-func (h *handlers) VoiceStatus() gin.HandlerFunc {
-	return func(ginCtx *gin.Context) {
-		value, _ := ginCtx.GetQuery("token")
+	staff, err = h.getOnCallStaff(ctx)
+	return staff, -1, h.dialTimeout(), err
+}
 
-		if value != h.Config.RequestAuthToken {
-			ginCtx.String(http.StatusUnauthorized, "Unauthorized")
-			return
+// dialNumbers returns the phone numbers to ring, leaving out the caller's
+// own number for staff calling in test mode.
+func dialNumbers(staff []storage.Staff, from string) []string {
+	phoneNumbers := make([]string, 0, len(staff))
+	for _, member := range staff {
+		if member.PhoneNumber == from {
+			fmt.Printf("Skipping caller's own number from dial list: %s\n", from)
+			continue
 		}
+		phoneNumbers = append(phoneNumbers, member.PhoneNumber)
+	}
+	return phoneNumbers
+}
 
+// dialTwiML says message and rings every phone number at once for timeout
+// seconds. The status callback carries the escalation tier so the next tier
+// can be dialed. Staff phones show callerID, or the caller's own number in
+// CALLER mode.
+func (h *handlers) dialTwiML(message string, callerID string, from string, tier int, timeout int, phoneNumbers []string) (string, error) {
+	params := url.Values{"from": {from}}
+	if tier >= 0 {
+		params.Set("tier", strconv.Itoa(tier))
+	}
+
+	if h.Config.Voice.CallerID == CallerIDCaller {
+		callerID = from
+	}
+
+	return h.newVoiceResponse().
+		say(message).
+		dial(callerID, h.callbackURL("/voice-status", params), timeout, phoneNumbers).
+		toXML()
+}
+
+func (h *handlers) VoiceStatus() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
 		from, _ := ginCtx.GetQuery("from")
 		dialCallStatus := ginCtx.PostForm("DialCallStatus")
 		callSid := ginCtx.PostForm("CallSid")
 
 		log.Printf("Call status update - From: %s, Status: %s, CallSid: %s", from, dialCallStatus, callSid)
 
-		if dialCallStatus == "completed" {
-			say := &twiml.VoiceSay{
-				Message: "Thank you for contacting dispatch.",
-			}
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
 
-			twimlResult, err := twiml.Voice([]twiml.Element{say})
-			if err != nil {
-				ginCtx.String(http.StatusInternalServerError, err.Error())
-			} else {
-				ginCtx.Header("Content-Type", "text/xml")
-				ginCtx.String(http.StatusOK, twimlResult)
-			}
-		} else {
-			timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
-			defer cancel()
-
-			// Fetch phone number configuration from MongoDB
-			phoneConfig, err := h.getSystemPhoneNumbers(timedCtx)
-			if err != nil {
-				log.Printf("Error fetching phone number config: %v", err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
-			}
+		var threadID bson.ObjectID
+		thread, err := h.findOpenThread(timedCtx, from)
+		if err != nil {
+			log.Printf("Error finding thread for %s: %v", from, err)
+		} else if thread != nil {
+			threadID = thread.ID
+		}
 
-			phoneNumbers, err := h.getActiveStaffPhoneNumbers(timedCtx)
-			if err != nil {
-				log.Printf("Error retrieving active staff: %v", err)
-				ginCtx.String(http.StatusInternalServerError, "Server error")
-				return
+		h.recordMessage(timedCtx, storage.Message{
+			ThreadID:  threadID,
+			Direction: DirectionInbound,
+			Channel:   ChannelVoice,
+			Kind:      MessageKindCallStatus,
+			From:      from,
+			To:        []string{ginCtx.PostForm("To")},
+			CallSid:   callSid,
+			Status:    dialCallStatus,
+		})
+
+		// Ring the next escalation tier before giving up on the call
+		if tierParam, ok := ginCtx.GetQuery("tier"); ok && dialCallStatus != "completed" {
+			if tier, err := strconv.Atoi(tierParam); err == nil {
+				if twimlResult, ok := h.escalateCall(timedCtx, from, tier); ok {
+					writeTwiML(ginCtx, twimlResult)
+					return
+				}
 			}
+		}
 
-			// Send SMS notifications since call wasn't answered
-			staffMessage := utils.ReplaceTemplateVars(h.Templates.VoiceMissedCallStaffMessage, map[string]string{
-				"from": from,
-				"time": time.Now().Format(time.RFC1123),
-			})
+		callEvent := EventCallMissed
+		if dialCallStatus == "completed" {
+			callEvent = EventCallAnswered
+		}
+		h.emitEvent(timedCtx, callEvent, map[string]any{
+			"thread":           thread,
+			"from":             from,
+			"call_sid":         callSid,
+			"dial_call_status": dialCallStatus,
+		})
 
-			// Send message to all active staff members
-			h.sendMessageToGroup(phoneConfig.Outbound, phoneNumbers, staffMessage)
+		if dialCallStatus == "completed" {
+			twimlResult, err := h.callAnsweredTwiML()
+			respondTwiML(ginCtx, twimlResult, err)
+			return
+		}
 
-			say := &twiml.VoiceSay{
-				Message: h.Templates.VoiceMissedCallCallerMessage,
-			}
+		// Send notifications since call wasn't answered. This happens before
+		// voicemail is offered, since a caller who hangs up during the prompt
+		// never reaches the voicemail callbacks.
+		if err := h.alertMissedCall(timedCtx, from, thread); err != nil {
+			log.Printf("Error alerting staff about missed call from %s: %v", from, err)
+			ginCtx.String(http.StatusInternalServerError, "Server error")
+			return
+		}
 
-			twimlResult, err := twiml.Voice([]twiml.Element{say})
-			if err != nil {
-				ginCtx.String(http.StatusInternalServerError, err.Error())
-			} else {
-				ginCtx.Header("Content-Type", "text/xml")
-				ginCtx.String(http.StatusOK, twimlResult)
-			}
+		// Offer voicemail; the recording is sent to staff once it is ready
+		if h.Config.VoicemailMaxLength > 0 {
+			twimlResult, err := h.voicemailTwiML(from, threadID, "")
+			respondTwiML(ginCtx, twimlResult, err)
+			return
 		}
+
+		twimlResult, err := h.missedCallTwiML()
+		respondTwiML(ginCtx, twimlResult, err)
+	}
+}
+
+// callAnsweredTwiML thanks the caller once staff hang up.
+func (h *handlers) callAnsweredTwiML() (string, error) {
+	return h.newVoiceResponse().say("Thank you for contacting dispatch.").toXML()
+}
+
+// missedCallTwiML tells the caller nobody answered.
+func (h *handlers) missedCallTwiML() (string, error) {
+	return h.newVoiceResponse().say(h.Templates.VoiceMissedCallCallerMessage).toXML()
+}
+
+// sayAndHangUpTwiML speaks a message and ends the call.
+func (h *handlers) sayAndHangUpTwiML(message string) (string, error) {
+	return h.newVoiceResponse().say(message).hangup().toXML()
+}
+
+// escalatingCallMessage is said to the caller while the next tier is dialed.
+const escalatingCallMessage = "Still trying to reach dispatch staff. Please continue to hold."
+
+// escalateCall returns TwiML that rings the tier after the given one, or
+// false when no tier is left.
+func (h *handlers) escalateCall(ctx context.Context, from string, afterTier int) (string, bool) {
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		log.Printf("Error fetching phone number config: %v", err)
+		return "", false
+	}
+
+	staff, tier, timeout, err := h.callRecipients(ctx, afterTier)
+	if err != nil {
+		log.Printf("Error resolving escalation tier after %d: %v", afterTier+1, err)
+		return "", false
+	}
+
+	phoneNumbers := dialNumbers(staff, from)
+	if tier < 0 || len(phoneNumbers) == 0 {
+		return "", false
+	}
+
+	log.Printf("Call from %s not answered, escalating to tier %d (%d staff)", from, tier+1, len(phoneNumbers))
+	twimlResult, err := h.dialTwiML(escalatingCallMessage, phoneConfig.Inbound, from, tier, timeout, phoneNumbers)
+	if err != nil {
+		log.Printf("Error creating TwiML document: %v", err)
+		return "", false
 	}
+	return twimlResult, true
 }
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Voice menu actions.
+const (
+	// VoiceMenuActionDial rings a group of staff.
+	VoiceMenuActionDial = "DIAL"
+	// VoiceMenuActionVoicemail records a voicemail.
+	VoiceMenuActionVoicemail = "VOICEMAIL"
+	// VoiceMenuActionSay speaks a message and hangs up.
+	VoiceMenuActionSay = "SAY"
+	// VoiceMenuActionMenu opens a submenu.
+	VoiceMenuActionMenu = "MENU"
+)
+
+const (
+	// maxVoiceMenuDepth limits how deep submenus can nest.
+	maxVoiceMenuDepth        = 3
+	defaultVoiceMenuTimeout  = 5
+	maxVoiceMenuTimeout      = 30
+	invalidMenuChoiceMessage = "Sorry, that is not an option."
+)
+
+// menuTimeout returns how long a menu waits for a key press, in seconds.
+func menuTimeout(m *storage.VoiceMenu) int {
+	if m.TimeoutSeconds == 0 {
+		return defaultVoiceMenuTimeout
+	}
+	return m.TimeoutSeconds
+}
+
+// menuOption returns the option of a menu for a key press, or nil.
+func menuOption(m *storage.VoiceMenu, digit string) *storage.VoiceMenuOption {
+	for i := range m.Options {
+		if m.Options[i].Digit == digit {
+			return &m.Options[i]
+		}
+	}
+	return nil
+}
+
+// submenu follows a path of key presses from the top of a menu. It
+// returns nil if the path does not lead to a submenu.
+func submenu(m *storage.VoiceMenu, path string) *storage.VoiceMenu {
+	menu := m
+	for _, digit := range path {
+		option := menuOption(menu, string(digit))
+		if option == nil || option.Action != VoiceMenuActionMenu || option.Menu == nil {
+			return nil
+		}
+		menu = option.Menu
+	}
+	return menu
+}
+
+// validateVoiceMenu checks a menu and its submenus. It does not check that
+// staff IDs exist.
+func validateVoiceMenu(menu *storage.VoiceMenu) error {
+	return validateVoiceSubmenu(menu, "", 1)
+}
+
+func validateVoiceSubmenu(menu *storage.VoiceMenu, field string, depth int) error {
+	if depth > maxVoiceMenuDepth {
+		return fmt.Errorf("%smenus can be nested at most %d deep", field, maxVoiceMenuDepth)
+	}
+	if menu.Prompt == "" {
+		return fmt.Errorf("%sprompt must not be empty", field)
+	}
+	if menu.TimeoutSeconds < 0 || menu.TimeoutSeconds > maxVoiceMenuTimeout {
+		return fmt.Errorf("%stimeout_seconds must be between 1 and %d", field, maxVoiceMenuTimeout)
+	}
+	if len(menu.Options) == 0 {
+		return fmt.Errorf("%soptions must not be empty", field)
+	}
+
+	seen := make(map[string]bool)
+	for i, option := range menu.Options {
+		prefix := fmt.Sprintf("%soptions[%d].", field, i)
+
+		if len(option.Digit) != 1 || !isKeypadDigit(option.Digit[0]) {
+			return fmt.Errorf("%sdigit must be one of 0-9, * or #", prefix)
+		}
+		if seen[option.Digit] {
+			return fmt.Errorf("%sdigit %s is used twice", prefix, option.Digit)
+		}
+		seen[option.Digit] = true
+
+		switch option.Action {
+		case VoiceMenuActionDial:
+			switch option.Target {
+			case "", EscalationTargetAllActive:
+			case EscalationTargetOnCall:
+				if option.ScheduleTier < 0 || option.ScheduleTier > maxScheduleTier {
+					return fmt.Errorf("%sschedule_tier must be between 0 and %d", prefix, maxScheduleTier)
+				}
+			case EscalationTargetStaff:
+				if len(option.StaffIDs) == 0 {
+					return fmt.Errorf("%sstaff_ids must not be empty for the STAFF target", prefix)
+				}
+			default:
+				return fmt.Errorf("%starget must be ON_CALL, ALL_ACTIVE or STAFF", prefix)
+			}
+		case VoiceMenuActionVoicemail:
+		case VoiceMenuActionSay:
+			if option.Message == "" {
+				return fmt.Errorf("%smessage must not be empty for SAY", prefix)
+			}
+		case VoiceMenuActionMenu:
+			if option.Menu == nil {
+				return fmt.Errorf("%smenu must be set for MENU", prefix)
+			}
+			if err := validateVoiceSubmenu(option.Menu, prefix+"menu.", depth+1); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%saction must be DIAL, VOICEMAIL, SAY or MENU", prefix)
+		}
+	}
+
+	return nil
+}
+
+func isKeypadDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '*' || c == '#'
+}
+
+// getVoiceMenu returns the voice menu, or nil if none is configured.
+func (h *handlers) getVoiceMenu(ctx context.Context) (*storage.VoiceMenu, error) {
+	menu, err := h.Store.Config.VoiceMenu(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load voice menu: %w", err)
+	}
+	return menu, nil
+}
+
+// voiceMenuTwiML plays the menu reached by path and waits for a key press.
+// If the caller presses nothing, the redirect connects them to staff.
+func (h *handlers) voiceMenuTwiML(menu *storage.VoiceMenu, from string, path string, notice string) (string, error) {
+	params := url.Values{"from": {from}}
+	if path != "" {
+		params.Set("path", path)
+	}
+	actionURL := h.callbackURL("/voice-menu", params)
+
+	prompts := []string{menu.Prompt}
+	if notice != "" {
+		prompts = []string{notice, menu.Prompt}
+	}
+
+	return h.newVoiceResponse().
+		gather(actionURL, menuTimeout(menu), prompts...).
+		redirect(actionURL).
+		toXML()
+}
+
+// VoiceMenuInput handles a key press in the voice menu.
+func (h *handlers) VoiceMenuInput() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		from, _ := ginCtx.GetQuery("from")
+		path := ginCtx.Query("path")
+		digits := ginCtx.PostForm("Digits")
+
+		log.Printf("Voice menu - From: %s, Path: %q, Digits: %q", from, path, digits)
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		twimlResult, err := h.voiceMenuChoice(timedCtx, from, path, digits)
+		if err != nil {
+			log.Printf("Error handling voice menu choice for %s: %v", from, err)
+			ginCtx.String(http.StatusInternalServerError, "Server error")
+			return
+		}
+
+		writeTwiML(ginCtx, twimlResult)
+	}
+}
+
+// voiceMenuChoice returns the TwiML for a key press in the menu reached by
+// path. Pressing nothing, or the menu having been removed, connects the
+// caller to staff.
+func (h *handlers) voiceMenuChoice(ctx context.Context, from string, path string, digits string) (string, error) {
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := h.getVoiceMenu(ctx)
+	if err != nil {
+		log.Printf("Error loading voice menu, dialing staff: %v", err)
+	}
+
+	var menu *storage.VoiceMenu
+	if root != nil {
+		menu = submenu(root, path)
+	}
+	if menu == nil || digits == "" {
+		return h.connectCallTwiML(ctx, from, phoneConfig.Inbound)
+	}
+
+	option := menuOption(menu, digits[:1])
+	if option == nil {
+		return h.voiceMenuTwiML(menu, from, path, invalidMenuChoiceMessage)
+	}
+
+	switch option.Action {
+	case VoiceMenuActionMenu:
+		return h.voiceMenuTwiML(option.Menu, from, path+option.Digit, "")
+
+	case VoiceMenuActionSay:
+		return h.sayAndHangUpTwiML(option.Message)
+
+	case VoiceMenuActionVoicemail:
+		thread, err := h.findOpenThread(ctx, from)
+		if err != nil {
+			return "", err
+		}
+		if err := h.alertMissedCall(ctx, from, thread); err != nil {
+			return "", err
+		}
+		var threadID bson.ObjectID
+		if thread != nil {
+			threadID = thread.ID
+		}
+		return h.voicemailTwiML(from, threadID, option.Message)
+
+	case VoiceMenuActionDial:
+		if option.Target == "" {
+			return h.connectCallTwiML(ctx, from, phoneConfig.Inbound)
+		}
+
+		tier := storage.EscalationTier{Target: option.Target, ScheduleTier: option.ScheduleTier, StaffIDs: option.StaffIDs}
+		staff, err := h.escalationTierStaff(ctx, tier, h.now())
+		if err != nil {
+			return "", err
+		}
+		if len(dialNumbers(staff, from)) == 0 {
+			log.Printf("Voice menu option %s%s has nobody to ring, dialing on-call staff", path, option.Digit)
+			return h.connectCallTwiML(ctx, from, phoneConfig.Inbound)
+		}
+		return h.dialStaffTwiML(staff, from, phoneConfig.Inbound, -1, h.dialTimeout())
+	}
+
+	return "", fmt.Errorf("unknown voice menu action %q", option.Action)
+}
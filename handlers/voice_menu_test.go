@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func testVoiceMenu() *storage.VoiceMenu {
+	return &storage.VoiceMenu{
+		Prompt: "For an emergency, press 1. To leave a message, press 2. For general information, press 3.",
+		Options: []storage.VoiceMenuOption{
+			{Digit: "1", Action: VoiceMenuActionDial},
+			{Digit: "2", Action: VoiceMenuActionVoicemail},
+			{Digit: "3", Action: VoiceMenuActionMenu, Menu: &storage.VoiceMenu{
+				Prompt:         "For office hours, press 1. To reach the coordinators, press 2.",
+				TimeoutSeconds: 8,
+				Options: []storage.VoiceMenuOption{
+					{Digit: "1", Action: VoiceMenuActionSay, Message: "The office is open 9 to 5 <weekdays> & Saturdays."},
+					{Digit: "2", Action: VoiceMenuActionDial, Target: EscalationTargetStaff, StaffIDs: []string{"coord1"}},
+				},
+			}},
+		},
+	}
+}
+
+func TestValidateVoiceMenu(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(menu *storage.VoiceMenu)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			modify: func(menu *storage.VoiceMenu) {},
+		},
+		{
+			name:    "missing prompt",
+			modify:  func(menu *storage.VoiceMenu) { menu.Prompt = "" },
+			wantErr: "prompt must not be empty",
+		},
+		{
+			name:    "bad digit",
+			modify:  func(menu *storage.VoiceMenu) { menu.Options[0].Digit = "12" },
+			wantErr: "options[0].digit must be one of 0-9, * or #",
+		},
+		{
+			name:    "duplicate digit",
+			modify:  func(menu *storage.VoiceMenu) { menu.Options[1].Digit = "1" },
+			wantErr: "options[1].digit 1 is used twice",
+		},
+		{
+			name:    "say without message",
+			modify:  func(menu *storage.VoiceMenu) { menu.Options[2].Menu.Options[0].Message = "" },
+			wantErr: "options[2].menu.options[0].message must not be empty for SAY",
+		},
+		{
+			name:    "staff target without staff",
+			modify:  func(menu *storage.VoiceMenu) { menu.Options[2].Menu.Options[1].StaffIDs = nil },
+			wantErr: "options[2].menu.options[1].staff_ids must not be empty for the STAFF target",
+		},
+		{
+			name:    "unknown action",
+			modify:  func(menu *storage.VoiceMenu) { menu.Options[0].Action = "FORWARD" },
+			wantErr: "options[0].action must be DIAL, VOICEMAIL, SAY or MENU",
+		},
+		{
+			name: "nested too deep",
+			modify: func(menu *storage.VoiceMenu) {
+				inner := menu.Options[2].Menu
+				inner.Options[0] = storage.VoiceMenuOption{Digit: "1", Action: VoiceMenuActionMenu, Menu: testVoiceMenu()}
+			},
+			wantErr: "options[2].menu.options[0].menu.options[2].menu.menus can be nested at most 3 deep",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menu := testVoiceMenu()
+			tt.modify(menu)
+
+			err := validateVoiceMenu(menu)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateVoiceMenu: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("validateVoiceMenu = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVoiceMenuSubmenu(t *testing.T) {
+	menu := testVoiceMenu()
+
+	if got := submenu(menu, ""); got != menu {
+		t.Error(`submenu("") is not the top menu`)
+	}
+	if got := submenu(menu, "3"); got != menu.Options[2].Menu {
+		t.Error(`submenu("3") is not the information menu`)
+	}
+	for _, path := range []string{"1", "9", "31"} {
+		if got := submenu(menu, path); got != nil {
+			t.Errorf("submenu(%q) = %+v, want nil", path, got)
+		}
+	}
+}
+
+func TestVoiceMenuTwiML(t *testing.T) {
+	h := &handlers{Config: Config{ValidateSignature: true}}
+	menu := testVoiceMenu()
+
+	tests := []struct {
+		name   string
+		menu   *storage.VoiceMenu
+		path   string
+		notice string
+		want   string
+	}{
+		{
+			name: "top menu",
+			menu: menu,
+			want: `<?xml version="1.0" encoding="UTF-8"?><Response>` +
+				`<Gather action="/voice-menu?from=%2B14158675309" input="dtmf" method="POST" numDigits="1" timeout="5">` +
+				`<Say>For an emergency, press 1. To leave a message, press 2. For general information, press 3.</Say>` +
+				`</Gather>` +
+				`<Redirect method="POST">/voice-menu?from=%2B14158675309</Redirect>` +
+				`</Response>`,
+		},
+		{
+			name:   "submenu after an invalid choice",
+			menu:   menu.Options[2].Menu,
+			path:   "3",
+			notice: invalidMenuChoiceMessage,
+			want: `<?xml version="1.0" encoding="UTF-8"?><Response>` +
+				`<Gather action="/voice-menu?from=%2B14158675309&amp;path=3" input="dtmf" method="POST" numDigits="1" timeout="8">` +
+				`<Say>Sorry, that is not an option.</Say>` +
+				`<Say>For office hours, press 1. To reach the coordinators, press 2.</Say>` +
+				`</Gather>` +
+				`<Redirect method="POST">/voice-menu?from=%2B14158675309&amp;path=3</Redirect>` +
+				`</Response>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.voiceMenuTwiML(tt.menu, "+14158675309", tt.path, tt.notice)
+			if err != nil {
+				t.Fatalf("voiceMenuTwiML: %v", err)
+			}
+			if canonicalTwiML(t, got) != canonicalTwiML(t, tt.want) {
+				t.Errorf("voiceMenuTwiML =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
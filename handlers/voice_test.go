@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+)
+
+func TestVoice(t *testing.T) {
+	const caller = "+14155550123"
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, store storage.Store)
+		from       string
+		wantStatus int
+		wantBody   []string
+		notBody    []string
+		wantThread bool
+	}{
+		{
+			name:       "call rings every active staff member",
+			from:       caller,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"Connecting you to dispatch.", "<Number>+15105550101</Number>", "<Number>+15105550102</Number>"},
+			notBody:    []string{"+15105550103"},
+			wantThread: true,
+		},
+		{
+			name: "call rings only on-call staff when schedules exist",
+			setup: func(t *testing.T, store storage.Store) {
+				schedule := storage.Schedule{PhoneNumber: "+15105550102", Always: true}
+				if err := store.Schedules.Insert(context.Background(), schedule); err != nil {
+					t.Fatal(err)
+				}
+			},
+			from:       caller,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"<Number>+15105550102</Number>"},
+			notBody:    []string{"+15105550101"},
+			wantThread: true,
+		},
+		{
+			name: "voice menu is played before ringing",
+			setup: func(t *testing.T, store storage.Store) {
+				menu := &storage.VoiceMenu{Prompt: "Press 1 for dispatch.", Options: []storage.VoiceMenuOption{{Digit: "1", Action: VoiceMenuActionDial}}}
+				if err := store.Config.SetVoiceMenu(context.Background(), menu); err != nil {
+					t.Fatal(err)
+				}
+			},
+			from:       caller,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"<Gather", "Press 1 for dispatch."},
+			notBody:    []string{"<Dial"},
+			wantThread: true,
+		},
+		{
+			name:       "call from staff is ignored",
+			from:       "+15105550101",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"<Response/>"},
+		},
+		{
+			name: "blocked caller is refused",
+			setup: func(t *testing.T, store storage.Store) {
+				if _, err := store.BlockList.Upsert(context.Background(), storage.BlockedNumber{PhoneNumber: caller, CreatedAt: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			from:       caller,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing caller is rejected",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, _ := newTestService(t)
+			addStaff(t, store, "+15105550101", true)
+			addStaff(t, store, "+15105550102", true)
+			addStaff(t, store, "+15105550103", false)
+			if tt.setup != nil {
+				tt.setup(t, store)
+			}
+
+			form := url.Values{"To": {testInboundNumber}, "CallSid": {"CA123"}}
+			if tt.from != "" {
+				form.Set("From", tt.from)
+			}
+			rec := postForm(h.Voice(), "/voice", form)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			assertBodyContains(t, rec, tt.wantBody...)
+			for _, fragment := range tt.notBody {
+				if strings.Contains(rec.Body.String(), fragment) {
+					t.Errorf("body = %q, want it not to contain %q", rec.Body.String(), fragment)
+				}
+			}
+
+			thread, err := store.Threads.FindActiveByPhoneNumber(context.Background(), caller)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (thread != nil) != tt.wantThread {
+				t.Fatalf("open thread = %v, want one: %v", thread, tt.wantThread)
+			}
+			if thread != nil {
+				call, err := store.Messages.FindLast(context.Background(), thread.ID, MessageKindCall)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if call == nil || call.CallSid != "CA123" {
+					t.Errorf("call message = %+v, want one with CallSid CA123", call)
+				}
+			}
+		})
+	}
+}
+
+func TestVoiceStatus(t *testing.T) {
+	const caller = "+14155550123"
+
+	tests := []struct {
+		name          string
+		voicemail     int
+		policy        *storage.EscalationPolicy
+		target        string
+		status        string
+		wantBody      []string
+		wantAlerted   []string
+		wantAlertKind string
+	}{
+		{
+			name:     "answered call thanks the caller",
+			target:   "/voice-status?from=%2B14155550123",
+			status:   "completed",
+			wantBody: []string{"Thank you for contacting dispatch."},
+		},
+		{
+			name:          "missed call alerts active staff",
+			target:        "/voice-status?from=%2B14155550123",
+			status:        "no-answer",
+			wantBody:      []string{"Nobody could take your call."},
+			wantAlerted:   []string{"+15105550101", "+15105550102"},
+			wantAlertKind: MessageKindMissedCall,
+		},
+		{
+			name:          "missed call alerts staff before offering voicemail",
+			voicemail:     120,
+			target:        "/voice-status?from=%2B14155550123",
+			status:        "busy",
+			wantBody:      []string{"Please leave a message.", "<Record"},
+			wantAlerted:   []string{"+15105550101", "+15105550102"},
+			wantAlertKind: MessageKindMissedCall,
+		},
+		{
+			name: "missed call rings the next escalation tier",
+			policy: &storage.EscalationPolicy{Tiers: []storage.EscalationTier{
+				{Target: EscalationTargetStaff, StaffIDs: []string{"staff0101"}, TimeoutSeconds: 20},
+				{Target: EscalationTargetStaff, StaffIDs: []string{"staff0102"}, TimeoutSeconds: 20},
+			}},
+			target:   "/voice-status?from=%2B14155550123&tier=0",
+			status:   "no-answer",
+			wantBody: []string{escalatingCallMessage, "<Number>+15105550102</Number>"},
+		},
+		{
+			name: "missed call on the last tier alerts staff",
+			policy: &storage.EscalationPolicy{Tiers: []storage.EscalationTier{
+				{Target: EscalationTargetStaff, StaffIDs: []string{"staff0101"}, TimeoutSeconds: 20},
+			}},
+			target:        "/voice-status?from=%2B14155550123&tier=0",
+			status:        "no-answer",
+			wantBody:      []string{"Nobody could take your call."},
+			wantAlerted:   []string{"+15105550101", "+15105550102"},
+			wantAlertKind: MessageKindMissedCall,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, notifier := newTestService(t)
+			h.Config.VoicemailMaxLength = tt.voicemail
+			addStaff(t, store, "+15105550101", true)
+			addStaff(t, store, "+15105550102", true)
+			thread := addThread(t, store, caller, "ABCD")
+			if tt.policy != nil {
+				if _, err := store.Escalation.Save(context.Background(), *tt.policy); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rec := postForm(h.VoiceStatus(), tt.target, url.Values{"DialCallStatus": {tt.status}, "CallSid": {"CA123"}})
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+			}
+			assertBodyContains(t, rec, tt.wantBody...)
+
+			if got := notifier.recipients(); !reflect.DeepEqual(got, tt.wantAlerted) {
+				t.Errorf("alerted %v, want %v", got, tt.wantAlerted)
+			}
+			if tt.wantAlertKind != "" && notifier.sent[0].Notification.ThreadID != thread.ID {
+				t.Errorf("alert not linked to thread %s", thread.Code)
+			}
+
+			status, err := store.Messages.FindLast(context.Background(), thread.ID, MessageKindCallStatus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status == nil || status.Status != tt.status {
+				t.Errorf("call status message = %+v, want status %q", status, tt.status)
+			}
+		})
+	}
+}
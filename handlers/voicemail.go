@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
+	"github.com/berkeley-neighbors/dispatch-relay/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go/twiml"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// maxTranscriptExcerpt is how much of a voicemail transcript is texted to
+// staff.
+const maxTranscriptExcerpt = 300
+
+// voicemailTwiML asks the caller to leave a message, with the voicemail
+// prompt template unless prompt is set. Staff must already have been
+// alerted; the recording follows from the recording status callback. The
+// redirect ends the call if nothing was recorded.
+func (h *handlers) voicemailTwiML(from string, threadID bson.ObjectID, prompt string) (string, error) {
+	if prompt == "" {
+		prompt = h.Templates.VoiceVoicemailPrompt
+	}
+
+	params := url.Values{"from": {from}}
+	if !threadID.IsZero() {
+		params.Set("thread", threadID.Hex())
+	}
+	actionURL := h.callbackURL("/voicemail", params)
+
+	threadParams := url.Values{}
+	if !threadID.IsZero() {
+		threadParams.Set("thread", threadID.Hex())
+	}
+
+	return h.newVoiceResponse().
+		say(prompt).
+		record(&twiml.VoiceRecord{
+			Action:                       actionURL,
+			Method:                       http.MethodPost,
+			MaxLength:                    strconv.Itoa(h.Config.VoicemailMaxLength),
+			PlayBeep:                     "true",
+			Trim:                         "trim-silence",
+			RecordingStatusCallback:      h.callbackURL("/voicemail-status", threadParams),
+			RecordingStatusCallbackEvent: "completed",
+			Transcribe:                   "true",
+			TranscribeCallback:           h.callbackURL("/voicemail-transcription", threadParams),
+		}).
+		redirect(actionURL).
+		toXML()
+}
+
+// Voicemail handles the end of a voicemail recording by thanking the caller
+// and hanging up.
+func (h *handlers) Voicemail() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		from, _ := ginCtx.GetQuery("from")
+		duration, _ := strconv.Atoi(ginCtx.PostForm("RecordingDuration"))
+
+		log.Printf("Voicemail finished - From: %s, Duration: %ds", from, duration)
+
+		twimlResult, err := h.sayAndHangUpTwiML(h.Templates.VoiceMissedCallCallerMessage)
+		respondTwiML(ginCtx, twimlResult, err)
+	}
+}
+
+// VoicemailStatus stores a finished voicemail recording on its thread and
+// sends staff a link to it.
+func (h *handlers) VoicemailStatus() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		recordingSid := ginCtx.PostForm("RecordingSid")
+		status := ginCtx.PostForm("RecordingStatus")
+
+		log.Printf("Voicemail recording status - RecordingSid: %s, Status: %s", recordingSid, status)
+
+		threadID, err := bson.ObjectIDFromHex(ginCtx.Query("thread"))
+		if err != nil || recordingSid == "" {
+			ginCtx.String(http.StatusBadRequest, "thread and RecordingSid are required")
+			return
+		}
+
+		if status != "completed" {
+			ginCtx.Status(http.StatusNoContent)
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		duration, _ := strconv.Atoi(ginCtx.PostForm("RecordingDuration"))
+		voicemail := storage.Voicemail{
+			CallSid:         ginCtx.PostForm("CallSid"),
+			RecordingSid:    recordingSid,
+			RecordingURL:    ginCtx.PostForm("RecordingUrl"),
+			DurationSeconds: duration,
+			CreatedAt:       time.Now(),
+		}
+
+		if err := h.Store.Threads.SaveVoicemail(timedCtx, threadID, voicemail); err != nil {
+			log.Printf("Error saving voicemail %s: %v", recordingSid, err)
+			ginCtx.String(http.StatusInternalServerError, "Server error")
+			return
+		}
+
+		h.emitEvent(timedCtx, EventVoicemailRecorded, map[string]any{
+			"thread_id": threadID,
+			"voicemail": voicemail,
+		})
+
+		if voicemail.RecordingURL != "" && voicemail.DurationSeconds > 0 {
+			if err := h.sendVoicemailLink(timedCtx, threadID, voicemail.RecordingURL+".mp3"); err != nil {
+				log.Printf("Error sending voicemail %s to staff: %v", recordingSid, err)
+			}
+		}
+
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// VoicemailTranscription stores a voicemail transcript on its thread and
+// texts an excerpt to the staff who were alerted about the missed call.
+func (h *handlers) VoicemailTranscription() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		recordingSid := ginCtx.PostForm("RecordingSid")
+		status := ginCtx.PostForm("TranscriptionStatus")
+		text := ginCtx.PostForm("TranscriptionText")
+
+		log.Printf("Voicemail transcription - RecordingSid: %s, Status: %s", recordingSid, status)
+
+		threadID, err := bson.ObjectIDFromHex(ginCtx.Query("thread"))
+		if err != nil || recordingSid == "" {
+			ginCtx.String(http.StatusBadRequest, "thread and RecordingSid are required")
+			return
+		}
+
+		timedCtx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
+		defer cancel()
+
+		if err := h.Store.Threads.SaveTranscription(timedCtx, threadID, recordingSid, status, text); err != nil {
+			log.Printf("Error saving transcription of %s: %v", recordingSid, err)
+			ginCtx.String(http.StatusInternalServerError, "Server error")
+			return
+		}
+
+		if status == "completed" && text != "" {
+			if err := h.sendTranscript(timedCtx, threadID, text); err != nil {
+				log.Printf("Error sending transcript of %s: %v", recordingSid, err)
+			}
+		}
+
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// alertMissedCall alerts every active staff member and the chat webhooks
+// about a call nobody answered.
+func (h *handlers) alertMissedCall(ctx context.Context, from string, thread *storage.Thread) error {
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching phone number config: %w", err)
+	}
+
+	staff, err := h.getActiveStaff(ctx)
+	if err != nil {
+		return fmt.Errorf("error retrieving active staff: %w", err)
+	}
+
+	var threadID bson.ObjectID
+	var threadCode string
+	if thread != nil {
+		threadID = thread.ID
+		threadCode = thread.Code
+	}
+
+	vars := map[string]string{
+		"from": from,
+		"code": threadCode,
+		"time": h.now().Format(time.RFC1123),
+	}
+	staffMessage := utils.ReplaceTemplateVars(h.Templates.VoiceMissedCallStaffMessage, vars)
+
+	notification := Notification{
+		Kind:     MessageKindMissedCall,
+		From:     phoneConfig.Outbound,
+		Body:     staffMessage,
+		Vars:     vars,
+		ThreadID: threadID,
+	}
+
+	// Notify all active staff members on their chosen channels
+	h.notifyStaff(ctx, staff, notification)
+
+	if len(h.ChatWebhooks) > 0 {
+		onCall, err := h.getOnCallStaff(ctx)
+		if err != nil {
+			log.Printf("Error retrieving on-call staff for chat: %v", err)
+		}
+		h.broadcastToChat(ctx, notification, onCall)
+	}
+
+	return nil
+}
+
+// sendVoicemailLink texts a link to a voicemail recording to every active
+// staff member, following up on the missed call alert.
+func (h *handlers) sendVoicemailLink(ctx context.Context, threadID bson.ObjectID, voicemailURL string) error {
+	thread, err := h.Store.Threads.FindByID(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to find thread: %w", err)
+	}
+	if thread == nil {
+		return fmt.Errorf("thread %s not found", threadID.Hex())
+	}
+
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		return err
+	}
+
+	staff, err := h.getActiveStaff(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.notifyStaff(ctx, staff, Notification{
+		Kind:     MessageKindVoicemail,
+		From:     phoneConfig.Outbound,
+		Body:     fmt.Sprintf("Voicemail from %s (#%s): %s", thread.PhoneNumber, thread.Code, voicemailURL),
+		ThreadID: thread.ID,
+	})
+	return nil
+}
+
+// sendTranscript texts an excerpt of a voicemail transcript to every active
+// staff member.
+func (h *handlers) sendTranscript(ctx context.Context, threadID bson.ObjectID, text string) error {
+	thread, err := h.Store.Threads.FindByID(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to find thread: %w", err)
+	}
+	if thread == nil {
+		return fmt.Errorf("thread %s not found", threadID.Hex())
+	}
+
+	phoneConfig, err := h.getSystemPhoneNumbers(ctx)
+	if err != nil {
+		return err
+	}
+
+	staff, err := h.getActiveStaff(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.notifyStaff(ctx, staff, Notification{
+		Kind:     MessageKindVoicemailTranscript,
+		From:     phoneConfig.Outbound,
+		Body:     fmt.Sprintf("Voicemail from %s (#%s):\n\n%s", thread.PhoneNumber, thread.Code, transcriptExcerpt(text)),
+		ThreadID: thread.ID,
+	})
+	return nil
+}
+
+// transcriptExcerpt shortens a transcript to maxTranscriptExcerpt runes.
+func transcriptExcerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxTranscriptExcerpt {
+		return text
+	}
+	return string(runes[:maxTranscriptExcerpt-1]) + "…"
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestVoicemailTwiML(t *testing.T) {
+	h := &handlers{
+		Config:    Config{ValidateSignature: true, VoicemailMaxLength: 90},
+		Templates: MessageTemplates{VoiceVoicemailPrompt: "Leave a message & hang up."},
+	}
+	threadID, _ := bson.ObjectIDFromHex("65f1c0de0000000000000001")
+
+	got, err := h.voicemailTwiML("+14158675309", threadID, "")
+	if err != nil {
+		t.Fatalf("voicemailTwiML: %v", err)
+	}
+
+	for _, want := range []string{
+		"<Say>Leave a message &amp; hang up.</Say>",
+		`action="/voicemail?from=%2B14158675309&amp;thread=65f1c0de0000000000000001"`,
+		`maxLength="90"`,
+		`recordingStatusCallback="/voicemail-status?thread=65f1c0de0000000000000001"`,
+		`transcribeCallback="/voicemail-transcription?thread=65f1c0de0000000000000001"`,
+		`transcribe="true"`,
+		`>/voicemail?from=%2B14158675309&amp;thread=65f1c0de0000000000000001</Redirect>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("TwiML missing %s:\n%s", want, got)
+		}
+	}
+
+	// The redirect ends the call when nothing was recorded, so it must
+	// come after the recording.
+	if strings.Index(got, "<Redirect") < strings.Index(got, "<Record") {
+		t.Errorf("Redirect comes before Record:\n%s", got)
+	}
+}
+
+func TestTranscriptExcerpt(t *testing.T) {
+	if got := transcriptExcerpt("Smoke coming from the garage."); got != "Smoke coming from the garage." {
+		t.Errorf("short transcript = %q", got)
+	}
+
+	long := strings.Repeat("ñ", maxTranscriptExcerpt+10)
+	got := transcriptExcerpt(long)
+	if n := len([]rune(got)); n != maxTranscriptExcerpt {
+		t.Errorf("excerpt is %d runes, want %d", n, maxTranscriptExcerpt)
+	}
+	if !strings.HasSuffix(got, "…") {
+		t.Errorf("excerpt %q is not marked as shortened", got)
+	}
+}
+
+func TestVoicemailCallerHangsUpBeforeRecording(t *testing.T) {
+	h, store, notifier := newTestService(t)
+	h.Config.VoicemailMaxLength = 120
+	addStaff(t, store, "+15105550101", true)
+	addThread(t, store, "+14155550123", "ABCD")
+
+	rec := postForm(h.VoiceStatus(), "/voice-status?from=%2B14155550123", url.Values{"DialCallStatus": {"no-answer"}, "CallSid": {"CA123"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	assertBodyContains(t, rec, "<Record")
+
+	// The caller hangs up during the prompt, so Twilio calls neither the
+	// record action nor the recording status callback. Staff must already
+	// know about the call.
+	if len(notifier.sent) != 1 || notifier.sent[0].Notification.Kind != MessageKindMissedCall {
+		t.Fatalf("sent %+v, want one missed call alert", notifier.sent)
+	}
+}
+
+func TestVoicemailStatusSendsRecording(t *testing.T) {
+	h, store, notifier := newTestService(t)
+	addStaff(t, store, "+15105550101", true)
+	thread := addThread(t, store, "+14155550123", "ABCD")
+
+	target := "/voicemail-status?thread=" + thread.ID.Hex()
+	rec := postForm(h.VoicemailStatus(), target, url.Values{
+		"RecordingSid":      {"RE123"},
+		"RecordingStatus":   {"completed"},
+		"RecordingUrl":      {"https://api.twilio.com/recordings/RE123"},
+		"RecordingDuration": {"12"},
+	})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	if len(notifier.sent) != 1 {
+		t.Fatalf("sent %d notifications, want 1", len(notifier.sent))
+	}
+	sent := notifier.sent[0].Notification
+	if sent.Kind != MessageKindVoicemail || !strings.Contains(sent.Body, "https://api.twilio.com/recordings/RE123.mp3") || !strings.Contains(sent.Body, "#ABCD") {
+		t.Errorf("notification = %+v, want a link to the recording on #ABCD", sent)
+	}
+
+	stored, err := store.Threads.FindByID(context.Background(), thread.ID)
+	if err != nil || stored == nil || len(stored.Voicemails) != 1 {
+		t.Errorf("thread = %+v, %v, want the voicemail saved", stored, err)
+	}
+}
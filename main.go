@@ -6,9 +6,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/berkeley-neighbors/dispatch-relay/handlers"
+	"github.com/berkeley-neighbors/dispatch-relay/storage"
 	"github.com/berkeley-neighbors/dispatch-relay/utils"
 
 	"github.com/gin-gonic/gin"
@@ -41,7 +45,15 @@ func main() {
 	router := gin.Default()
 
 	mongoConnectionStr := os.Getenv("MONGO_CONNECTION_STR")
+	databaseURL := os.Getenv("DATABASE_URL")
 	requestAuthToken := os.Getenv("AUTH_TOKEN")
+	publicBaseURL := os.Getenv("PUBLIC_BASE_URL")
+	adminAPIToken := os.Getenv("ADMIN_API_TOKEN")
+	twilioValidateSignature := os.Getenv("TWILIO_VALIDATE_SIGNATURE")
+	smsProviderName := os.Getenv("SMS_PROVIDER")
+	telnyxAPIKey := os.Getenv("TELNYX_API_KEY")
+	telnyxMessagingProfileID := os.Getenv("TELNYX_MESSAGING_PROFILE_ID")
+	telnyxPublicKey := os.Getenv("TELNYX_PUBLIC_KEY")
 	notificationMethods := os.Getenv("NOTIFICATION_METHODS")
 	notificationStrategy := os.Getenv("NOTIFICATION_STRATEGY")
 	// SMS message templates
@@ -50,18 +62,41 @@ func main() {
 	voiceConnectingMessage := os.Getenv("VOICE_CONNECTING_MESSAGE")
 	voiceMissedCallStaffMessage := os.Getenv("VOICE_MISSED_CALL_STAFF_MESSAGE")
 	voiceMissedCallCallerMessage := os.Getenv("VOICE_MISSED_CALL_CALLER_MESSAGE")
+	voiceVoicemailPrompt := os.Getenv("VOICE_VOICEMAIL_PROMPT")
+	voicemailMaxLength := os.Getenv("VOICEMAIL_MAX_LENGTH")
+	voiceTTSVoice := os.Getenv("VOICE_TTS_VOICE")
+	voiceLanguage := os.Getenv("VOICE_LANGUAGE")
+	voiceDialTimeout := os.Getenv("VOICE_DIAL_TIMEOUT")
+	voiceRingTone := os.Getenv("VOICE_RING_TONE")
+	voiceCallerID := os.Getenv("VOICE_CALLER_ID")
 	scheduleReminderMessage := os.Getenv("SCHEDULE_REMINDER_MESSAGE")
 	scheduleReminderHour := os.Getenv("SCHEDULE_REMINDER_HOUR")
+	threadInactivityTimeout := os.Getenv("THREAD_INACTIVITY_TIMEOUT")
+	routingMode := os.Getenv("ROUTING_MODE")
+	routingAckTimeout := os.Getenv("ROUTING_ACK_TIMEOUT")
+	timezone := os.Getenv("TIMEZONE")
+	// Email notifications
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPort := os.Getenv("SMTP_PORT")
+	smtpUsername := os.Getenv("SMTP_USERNAME")
+	smtpPassword := os.Getenv("SMTP_PASSWORD")
+	smtpFrom := os.Getenv("SMTP_FROM")
+	emailSubjectTemplate := os.Getenv("EMAIL_SUBJECT_TEMPLATE")
+	emailBodyTemplate := os.Getenv("EMAIL_BODY_TEMPLATE")
+	chatWebhooks := os.Getenv("CHAT_WEBHOOKS")
+	eventWebhookURLs := os.Getenv("EVENT_WEBHOOK_URLS")
+	eventWebhookSecret := os.Getenv("EVENT_WEBHOOK_SECRET")
 
 	smsStaffTemplateTest := os.Getenv("SMS_STAFF_MESSAGE_TEMPLATE_TEST")
 	smsSenderResponseTest := os.Getenv("SMS_SENDER_RESPONSE_MESSAGE_TEST")
 	voiceConnectingMessageTest := os.Getenv("VOICE_CONNECTING_MESSAGE_TEST")
 	voiceMissedCallStaffMessageTest := os.Getenv("VOICE_MISSED_CALL_STAFF_MESSAGE_TEST")
 	voiceMissedCallCallerMessageTest := os.Getenv("VOICE_MISSED_CALL_CALLER_MESSAGE_TEST")
+	voiceVoicemailPromptTest := os.Getenv("VOICE_VOICEMAIL_PROMPT_TEST")
 
 	// Set defaults if not provided
 	if smsStaffTemplate == "" {
-		smsStaffTemplate = "Dispatch message received\n\nFrom: {{from}}\nMessage: {{body}}\nTime: {{time}}\n\nTeam, please respond"
+		smsStaffTemplate = "Dispatch message received\n\nFrom: {{from}}\nMessage: {{body}}\nTime: {{time}}\nThread: #{{code}}\n\nTeam, please respond. Reply to this number to text the sender, starting with #{{code}} if several threads are open."
 	}
 
 	if smsSenderResponse == "" {
@@ -80,6 +115,51 @@ func main() {
 		voiceMissedCallCallerMessage = "Sorry, no dispatch staff are available to take your call right now. We have sent an urgent message to all staff members. Please try calling back in a few minutes or send a text message for assistance."
 	}
 
+	if voiceVoicemailPrompt == "" {
+		voiceVoicemailPrompt = "Sorry, no dispatch staff are available to take your call right now. Please leave a message after the tone, then hang up. We will send it to all staff members."
+	}
+
+	voicemailLength := 120
+	if voicemailMaxLength != "" {
+		parsed, err := strconv.Atoi(voicemailMaxLength)
+		if err != nil || parsed < 0 || parsed > 3600 {
+			log.Fatalf("Invalid VOICEMAIL_MAX_LENGTH %q, must be between 0 and 3600 seconds", voicemailMaxLength)
+		}
+		voicemailLength = parsed
+	}
+
+	voiceSettings := handlers.VoiceSettings{
+		Voice:       voiceTTSVoice,
+		Language:    voiceLanguage,
+		DialTimeout: 20,
+		RingTone:    strings.ToLower(voiceRingTone),
+		CallerID:    utils.UpperString(voiceCallerID),
+	}
+
+	if voiceSettings.Voice == "" {
+		voiceSettings.Voice = handlers.DefaultVoice
+	}
+
+	if voiceSettings.Language == "" {
+		voiceSettings.Language = handlers.DefaultLanguage
+	}
+
+	if voiceDialTimeout != "" {
+		parsed, err := strconv.Atoi(voiceDialTimeout)
+		if err != nil || parsed < 5 || parsed > 600 {
+			log.Fatalf("Invalid VOICE_DIAL_TIMEOUT %q, must be between 5 and 600 seconds", voiceDialTimeout)
+		}
+		voiceSettings.DialTimeout = parsed
+	}
+
+	switch voiceSettings.CallerID {
+	case "":
+		voiceSettings.CallerID = handlers.CallerIDSystem
+	case handlers.CallerIDSystem, handlers.CallerIDCaller:
+	default:
+		log.Fatalf("Invalid VOICE_CALLER_ID %q, must be SYSTEM or CALLER", voiceCallerID)
+	}
+
 	if scheduleReminderMessage == "" {
 		scheduleReminderMessage = "Reminder: You are on-call today. Please ensure you are available to respond to dispatch messages and calls."
 	}
@@ -92,6 +172,75 @@ func main() {
 		}
 	}
 
+	location := time.Local
+	if timezone != "" {
+		loaded, err := time.LoadLocation(timezone)
+		if err != nil {
+			log.Fatalf("Invalid TIMEZONE %q: %v", timezone, err)
+		}
+		location = loaded
+	} else {
+		log.Printf("TIMEZONE is not set, using container time zone %s", location)
+	}
+
+	// Threads stay open until staff close them unless auto-closing is
+	// turned on.
+	var threadTimeout time.Duration
+	if threadInactivityTimeout != "" {
+		parsed, err := time.ParseDuration(threadInactivityTimeout)
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid THREAD_INACTIVITY_TIMEOUT %q, threads will not close automatically", threadInactivityTimeout)
+		} else {
+			threadTimeout = parsed
+		}
+	}
+
+	routingMode = utils.UpperString(routingMode)
+	switch routingMode {
+	case "":
+		routingMode = handlers.RoutingModeAll
+	case handlers.RoutingModeAll, handlers.RoutingModeRoundRobin, handlers.RoutingModeLeastRecent:
+	default:
+		log.Fatalf("Invalid ROUTING_MODE %q, must be ALL, ROUND_ROBIN or LEAST_RECENT", routingMode)
+	}
+
+	routingTimeout := 5 * time.Minute
+	if routingAckTimeout != "" {
+		parsed, err := time.ParseDuration(routingAckTimeout)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid ROUTING_ACK_TIMEOUT %q, using %s", routingAckTimeout, routingTimeout)
+		} else {
+			routingTimeout = parsed
+		}
+	}
+
+	if emailSubjectTemplate == "" {
+		emailSubjectTemplate = "Dispatch alert"
+	}
+
+	if emailBodyTemplate == "" {
+		emailBodyTemplate = "{{message}}"
+	}
+
+	smtpPortNumber := 587
+	if smtpPort != "" {
+		parsed, err := strconv.Atoi(smtpPort)
+		if err != nil || parsed <= 0 || parsed > 65535 {
+			log.Fatalf("Invalid SMTP_PORT %q", smtpPort)
+		}
+		smtpPortNumber = parsed
+	}
+
+	parsedChatWebhooks, err := handlers.ParseChatWebhooks(chatWebhooks)
+	if err != nil {
+		log.Fatalf("Invalid CHAT_WEBHOOKS: %v", err)
+	}
+
+	parsedEventWebhooks, err := handlers.ParseEventWebhooks(eventWebhookURLs, eventWebhookSecret)
+	if err != nil {
+		log.Fatalf("Invalid EVENT_WEBHOOK_URLS or EVENT_WEBHOOK_SECRET: %v", err)
+	}
+
 	if notificationStrategy == "" {
 		notificationStrategy = "THREAD"
 	}
@@ -106,16 +255,6 @@ func main() {
 
 	timeout := 60 * time.Second
 
-	if _, found := os.LookupEnv("TWILIO_ACCOUNT_SID"); !found {
-		fmt.Println("TWILIO_ACCOUNT_SID is not set")
-		return
-	}
-
-	if _, found := os.LookupEnv("TWILIO_AUTH_TOKEN"); !found {
-		fmt.Println("TWILIO_AUTH_TOKEN is not set")
-		return
-	}
-
 	enableSMS := false
 	enableVoice := false
 
@@ -129,45 +268,81 @@ func main() {
 	}
 
 	log.Printf("SMS enabled: %v, Voice enabled: %v", enableSMS, enableVoice)
-	if enableSMS {
-		log.Printf("SMS staff message template: %s", smsStaffTemplate)
-		log.Printf("SMS sender response: %s", smsSenderResponse)
-	}
 
-	// Connect to MongoDB
-	client, err := mongo.Connect(options.Client().ApplyURI(mongoConnectionStr))
-	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	smsProviderName = strings.ToLower(smsProviderName)
+	if smsProviderName == "" {
+		smsProviderName = handlers.SMSProviderTwilio
 	}
 
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v", err)
+	var smsProvider handlers.SMSProvider
+	switch smsProviderName {
+	case handlers.SMSProviderTwilio:
+		smsProvider = handlers.NewTwilioSMSProvider()
+	case handlers.SMSProviderTelnyx:
+		if telnyxAPIKey == "" {
+			log.Fatalf("TELNYX_API_KEY is required when SMS_PROVIDER is telnyx")
 		}
-	}()
+		smsProvider = &handlers.TelnyxSMSProvider{
+			APIKey:             telnyxAPIKey,
+			MessagingProfileID: telnyxMessagingProfileID,
+		}
+	case handlers.SMSProviderFake:
+		log.Println("WARNING: SMS_PROVIDER is fake, texts are logged and not sent")
+		smsProvider = handlers.NewFakeSMSProvider()
+	default:
+		log.Fatalf("Invalid SMS_PROVIDER %q, must be twilio, telnyx or fake", smsProviderName)
+	}
+	log.Printf("SMS provider: %s", smsProvider.Name())
 
-	config := handlers.Config{
-		DatabaseName:         "dispatch_relay",
-		RequestAuthToken:     requestAuthToken,
-		NotificationStrategy: notificationStrategy,
-		Timeout:              timeout,
-		SkipStaffIgnore:      false,
+	// Calls are always handled by Twilio, so its credentials are needed for
+	// voice even when texts go through another provider.
+	useTwilio := enableVoice || smsProviderName == handlers.SMSProviderTwilio
+
+	if _, found := os.LookupEnv("TWILIO_ACCOUNT_SID"); !found && useTwilio {
+		fmt.Println("TWILIO_ACCOUNT_SID is not set")
+		return
+	}
+
+	twilioAuthToken, found := os.LookupEnv("TWILIO_AUTH_TOKEN")
+	if !found && useTwilio {
+		fmt.Println("TWILIO_AUTH_TOKEN is not set")
+		return
+	}
+
+	validateSignature := utils.UpperString(twilioValidateSignature) != "FALSE"
+	if !validateSignature && useTwilio {
+		log.Println("WARNING: Twilio signature validation is disabled")
+	}
+
+	if enableSMS {
+		log.Printf("SMS staff message template: %s", smsStaffTemplate)
+		log.Printf("SMS sender response: %s", smsSenderResponse)
 	}
 
-	testConfig := handlers.Config{
-		DatabaseName:         "dispatch_relay_test",
-		RequestAuthToken:     requestAuthToken,
-		NotificationStrategy: notificationStrategy,
-		Timeout:              timeout,
-		SkipStaffIgnore:      true,
+	config := handlers.Config{
+		DatabaseName:            "dispatch_relay",
+		RequestAuthToken:        requestAuthToken,
+		ValidateSignature:       validateSignature,
+		NotificationStrategy:    notificationStrategy,
+		Timeout:                 timeout,
+		SkipStaffIgnore:         false,
+		ThreadInactivityTimeout: threadTimeout,
+		RoutingMode:             routingMode,
+		RoutingAckTimeout:       routingTimeout,
+		Voice:                   voiceSettings,
+		VoicemailMaxLength:      voicemailLength,
+		Location:                location,
 	}
 
+	testConfig := config.TestConfig()
+
 	templates := handlers.MessageTemplates{
 		SMSSenderResponse:            smsSenderResponse,
 		SMSStaffTemplate:             smsStaffTemplate,
 		VoiceConnectingMessage:       voiceConnectingMessage,
 		VoiceMissedCallStaffMessage:  voiceMissedCallStaffMessage,
 		VoiceMissedCallCallerMessage: voiceMissedCallCallerMessage,
+		VoiceVoicemailPrompt:         voiceVoicemailPrompt,
 	}
 
 	testTemplates := handlers.MessageTemplates{
@@ -176,19 +351,106 @@ func main() {
 		VoiceConnectingMessage:       voiceConnectingMessageTest,
 		VoiceMissedCallStaffMessage:  voiceMissedCallStaffMessageTest,
 		VoiceMissedCallCallerMessage: voiceMissedCallCallerMessageTest,
+		VoiceVoicemailPrompt:         voiceVoicemailPromptTest,
+	}
+
+	if databaseURL == "" {
+		databaseURL = mongoConnectionStr
+	}
+
+	var store, testStore storage.Store
+	if storage.IsSQLDatabaseURL(databaseURL) {
+		db, sqlDB, err := storage.OpenSQLStore(context.Background(), databaseURL)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		defer sqlDB.Close()
+
+		testDatabaseURL, err := storage.SQLTestDatabaseURL(databaseURL)
+		if err != nil {
+			log.Fatalf("Invalid DATABASE_URL: %v", err)
+		}
+		testDB, testSQLDB, err := storage.OpenSQLStore(context.Background(), testDatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to open test database: %v", err)
+		}
+		defer testSQLDB.Close()
+
+		store, testStore = db, testDB
+	} else {
+		// Connect to MongoDB
+		client, err := mongo.Connect(options.Client().ApplyURI(databaseURL))
+		if err != nil {
+			log.Fatalf("Failed to connect to MongoDB: %v", err)
+		}
+
+		defer func() {
+			if err := client.Disconnect(context.TODO()); err != nil {
+				log.Printf("Error disconnecting from MongoDB: %v", err)
+			}
+		}()
+
+		schemaCtx, schemaCancel := context.WithTimeout(context.Background(), time.Minute)
+		for _, databaseName := range []string{config.DatabaseName, testConfig.DatabaseName} {
+			if err := storage.EnsureMongoSchema(schemaCtx, client, databaseName); err != nil {
+				log.Fatalf("Error preparing %s: %v", databaseName, err)
+			}
+		}
+		schemaCancel()
+
+		store = storage.NewMongoStore(client, config.DatabaseName)
+		testStore = storage.NewMongoStore(client, testConfig.DatabaseName)
 	}
 
-	realHandlers := handlers.NewService(client, config.DatabaseName, config, templates)
-	testHandlers := handlers.NewService(client, testConfig.DatabaseName, testConfig, testTemplates)
+	realHandlers := handlers.NewService(store, smsProvider, config, templates)
+	testHandlers := handlers.NewService(testStore, smsProvider, testConfig, testTemplates)
+
+	if smtpHost != "" {
+		if smtpFrom == "" {
+			log.Fatalf("SMTP_FROM is required when SMTP_HOST is set")
+		}
+
+		emailNotifier := &handlers.EmailNotifier{
+			Host:            smtpHost,
+			Port:            smtpPortNumber,
+			Username:        smtpUsername,
+			Password:        smtpPassword,
+			From:            smtpFrom,
+			SubjectTemplate: emailSubjectTemplate,
+			BodyTemplate:    emailBodyTemplate,
+		}
+		realHandlers.RegisterNotifier(emailNotifier)
+		testHandlers.RegisterNotifier(emailNotifier)
+		log.Printf("Email notifications enabled via %s:%d", smtpHost, smtpPortNumber)
+	}
+
+	for _, webhook := range parsedChatWebhooks {
+		realHandlers.RegisterChatWebhook(webhook)
+		testHandlers.RegisterChatWebhook(webhook)
+	}
+	if len(parsedChatWebhooks) > 0 {
+		log.Printf("Posting alerts to %d chat webhooks", len(parsedChatWebhooks))
+	}
+
+	// Events describe live traffic only, so ?test requests never reach
+	// connected tools.
+	for _, webhook := range parsedEventWebhooks {
+		realHandlers.RegisterEventWebhook(webhook)
+	}
+
+	startupCtx, startupCancel := context.WithTimeout(context.Background(), timeout)
+	if err := realHandlers.EnsureStaffPublicIDs(startupCtx); err != nil {
+		log.Printf("Error assigning staff IDs: %v", err)
+	}
+	if err := testHandlers.EnsureStaffPublicIDs(startupCtx); err != nil {
+		log.Printf("Error assigning test staff IDs: %v", err)
+	}
+	startupCancel()
 
 	// Start background schedule reminder goroutine
 	go func() {
 		for {
-			now := time.Now()
-			nextRun := time.Date(now.Year(), now.Month(), now.Day(), reminderHour, 0, 0, 0, now.Location())
-			if now.After(nextRun) {
-				nextRun = nextRun.Add(24 * time.Hour)
-			}
+			nextRun := handlers.NextReminderTime(time.Now(), reminderHour, location)
 			log.Printf("Schedule reminder: next check at %s", nextRun.Format(time.RFC3339))
 			time.Sleep(time.Until(nextRun))
 
@@ -198,16 +460,132 @@ func main() {
 		}
 	}()
 
+	// Start background text escalation and routing fallback goroutine
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			realHandlers.EscalatePendingThreads(ctx)
+			testHandlers.EscalatePendingThreads(ctx)
+			realHandlers.AlertUnacknowledgedThreads(ctx)
+			testHandlers.AlertUnacknowledgedThreads(ctx)
+			cancel()
+		}
+	}()
+
+	// Start background thread expiry goroutine
+	if threadTimeout > 0 {
+		log.Printf("Threads close after %s of inactivity", threadTimeout)
+		go func() {
+			ticker := time.NewTicker(5 * time.Minute)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				realHandlers.CloseInactiveThreads(ctx)
+				testHandlers.CloseInactiveThreads(ctx)
+				cancel()
+			}
+		}()
+	}
+
+	// Start background event webhook retry goroutine
+	if len(parsedEventWebhooks) > 0 {
+		log.Printf("Sending events to %d webhooks", len(parsedEventWebhooks))
+		go func() {
+			ticker := time.NewTicker(30 * time.Second)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				realHandlers.RetryEventDeliveries(ctx)
+				cancel()
+			}
+		}()
+	}
+
+	// Twilio webhooks are authenticated by request signature. The query token
+	// is an optional second factor on the routes configured in the Twilio
+	// console; callbacks we generate only carry it when signatures are off.
+	webhookAuth := []gin.HandlerFunc{}
+	callbackAuth := []gin.HandlerFunc{handlers.RequestToken(requestAuthToken)}
+	if validateSignature {
+		signatureAuth := handlers.TwilioSignature(twilioAuthToken, publicBaseURL)
+		webhookAuth = append(webhookAuth, signatureAuth)
+		callbackAuth = []gin.HandlerFunc{signatureAuth}
+	}
+	webhookAuth = append(webhookAuth, handlers.RequestToken(requestAuthToken))
+
+	// Other SMS providers sign their webhooks their own way.
+	smsAuth := webhookAuth
+	switch smsProviderName {
+	case handlers.SMSProviderTelnyx:
+		smsAuth = []gin.HandlerFunc{handlers.RequestToken(requestAuthToken)}
+		if telnyxPublicKey != "" {
+			signatureAuth, err := handlers.TelnyxSignature(telnyxPublicKey)
+			if err != nil {
+				log.Fatalf("Invalid TELNYX_PUBLIC_KEY: %v", err)
+			}
+			smsAuth = append([]gin.HandlerFunc{signatureAuth}, smsAuth...)
+		} else {
+			log.Println("WARNING: TELNYX_PUBLIC_KEY is not set, Telnyx signature validation is disabled")
+		}
+	case handlers.SMSProviderFake:
+		smsAuth = []gin.HandlerFunc{handlers.RequestToken(requestAuthToken)}
+	}
+
+	webhooks := router.Group("/", webhookAuth...)
+	callbacks := router.Group("/", callbackAuth...)
+	smsWebhooks := router.Group("/", smsAuth...)
+
 	// TODO Don't contaminate the environment with prod and test handling
 	if enableSMS {
 		log.Println("Registering /sms route")
-		router.POST("/sms", routeByTestParam(realHandlers.SMS(), testHandlers.SMS()))
+		smsWebhooks.POST("/sms", routeByTestParam(realHandlers.SMS(), testHandlers.SMS()))
 	}
 
 	if enableVoice {
-		log.Println("Registering /voice and /voice-status routes")
-		router.POST("/voice", routeByTestParam(realHandlers.Voice(), testHandlers.Voice()))
-		router.POST("/voice-status", routeByTestParam(realHandlers.VoiceStatus(), testHandlers.VoiceStatus()))
+		log.Println("Registering /voice, /voice-menu, /voice-status and /voicemail routes")
+		webhooks.POST("/voice", routeByTestParam(realHandlers.Voice(), testHandlers.Voice()))
+		callbacks.POST("/voice-menu", routeByTestParam(realHandlers.VoiceMenuInput(), testHandlers.VoiceMenuInput()))
+		callbacks.POST("/voice-status", routeByTestParam(realHandlers.VoiceStatus(), testHandlers.VoiceStatus()))
+		callbacks.POST("/voicemail", routeByTestParam(realHandlers.Voicemail(), testHandlers.Voicemail()))
+		callbacks.POST("/voicemail-status", routeByTestParam(realHandlers.VoicemailStatus(), testHandlers.VoicemailStatus()))
+		callbacks.POST("/voicemail-transcription", routeByTestParam(realHandlers.VoicemailTranscription(), testHandlers.VoicemailTranscription()))
+	}
+
+	if adminAPIToken != "" {
+		log.Println("Registering /api routes")
+		api := router.Group("/api", handlers.AdminToken(adminAPIToken))
+
+		api.GET("/staff", routeByTestParam(realHandlers.ListStaff(), testHandlers.ListStaff()))
+		api.POST("/staff", routeByTestParam(realHandlers.CreateStaff(), testHandlers.CreateStaff()))
+		api.GET("/staff/:id", routeByTestParam(realHandlers.GetStaff(), testHandlers.GetStaff()))
+		api.PATCH("/staff/:id", routeByTestParam(realHandlers.UpdateStaff(), testHandlers.UpdateStaff()))
+		api.DELETE("/staff/:id", routeByTestParam(realHandlers.DeleteStaff(), testHandlers.DeleteStaff()))
+
+		api.GET("/blocklist", routeByTestParam(realHandlers.ListBlockedNumbers(), testHandlers.ListBlockedNumbers()))
+		api.POST("/blocklist", routeByTestParam(realHandlers.BlockNumber(), testHandlers.BlockNumber()))
+		api.DELETE("/blocklist/:phone_number", routeByTestParam(realHandlers.UnblockNumber(), testHandlers.UnblockNumber()))
+
+		api.GET("/schedules", routeByTestParam(realHandlers.ListSchedules(), testHandlers.ListSchedules()))
+		api.POST("/schedules", routeByTestParam(realHandlers.CreateSchedule(), testHandlers.CreateSchedule()))
+		api.GET("/schedules/on-call", routeByTestParam(realHandlers.OnCallPreview(), testHandlers.OnCallPreview()))
+		api.GET("/schedules/:id", routeByTestParam(realHandlers.GetSchedule(), testHandlers.GetSchedule()))
+		api.PUT("/schedules/:id", routeByTestParam(realHandlers.UpdateSchedule(), testHandlers.UpdateSchedule()))
+		api.DELETE("/schedules/:id", routeByTestParam(realHandlers.DeleteSchedule(), testHandlers.DeleteSchedule()))
+
+		api.GET("/escalation-policy", routeByTestParam(realHandlers.GetEscalationPolicy(), testHandlers.GetEscalationPolicy()))
+		api.PUT("/escalation-policy", routeByTestParam(realHandlers.UpdateEscalationPolicy(), testHandlers.UpdateEscalationPolicy()))
+		api.DELETE("/escalation-policy", routeByTestParam(realHandlers.DeleteEscalationPolicy(), testHandlers.DeleteEscalationPolicy()))
+
+		api.GET("/voice-menu", routeByTestParam(realHandlers.GetVoiceMenu(), testHandlers.GetVoiceMenu()))
+		api.PUT("/voice-menu", routeByTestParam(realHandlers.UpdateVoiceMenu(), testHandlers.UpdateVoiceMenu()))
+		api.DELETE("/voice-menu", routeByTestParam(realHandlers.DeleteVoiceMenu(), testHandlers.DeleteVoiceMenu()))
+	} else {
+		log.Println("ADMIN_API_TOKEN is not set, admin API disabled")
 	}
 
 	router.GET("/health", func(ginCtx *gin.Context) {
@@ -0,0 +1,816 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// NewMemoryStore returns an empty store that keeps everything in memory. It
+// is meant for tests and local development; nothing survives a restart.
+func NewMemoryStore() Store {
+	db := &memoryDB{config: make(map[string]string)}
+
+	return Store{
+		Staff:             &memoryStaff{db},
+		Threads:           &memoryThreads{db},
+		BlockList:         &memoryBlockList{db},
+		Schedules:         &memorySchedules{db},
+		Config:            &memoryConfig{db},
+		Messages:          &memoryMessages{db},
+		WebhookDeliveries: &memoryWebhookDeliveries{db},
+		Escalation:        &memoryEscalation{db},
+	}
+}
+
+// memoryDB holds the records of every memory repository behind one lock.
+type memoryDB struct {
+	mu         sync.Mutex
+	staff      []Staff
+	threads    []Thread
+	blocked    []BlockedNumber
+	schedules  []Schedule
+	config     map[string]string
+	voiceMenu  *VoiceMenu
+	messages   []Message
+	deliveries []WebhookDelivery
+	policy     *EscalationPolicy
+}
+
+// clone deep-copies a record through BSON, so callers never share slices
+// with the store and times are rounded the way MongoDB rounds them.
+func clone[T any](v T) T {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	var out T
+	if err := bson.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func cloneAll[T any](items []T) []T {
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		out = append(out, clone(item))
+	}
+	return out
+}
+
+// indexWhere returns the index of the first item matching match, or -1.
+func indexWhere[T any](items []T, match func(*T) bool) int {
+	for i := range items {
+		if match(&items[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// cloneWhere returns copies of the items matching match.
+func cloneWhere[T any](items []T, match func(*T) bool) []T {
+	out := []T{}
+	for i := range items {
+		if match(&items[i]) {
+			out = append(out, clone(items[i]))
+		}
+	}
+	return out
+}
+
+type memoryStaff struct {
+	*memoryDB
+}
+
+func (s *memoryStaff) List(ctx context.Context) ([]Staff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	staff := cloneAll(s.staff)
+	slices.SortFunc(staff, func(a, b Staff) int { return cmp.Compare(a.PhoneNumber, b.PhoneNumber) })
+	return staff, nil
+}
+
+func (s *memoryStaff) ListActive(ctx context.Context) ([]Staff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneWhere(s.staff, func(m *Staff) bool { return m.Active }), nil
+}
+
+func (s *memoryStaff) ListWithoutPublicID(ctx context.Context) ([]Staff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneWhere(s.staff, func(m *Staff) bool { return m.PublicID == "" }), nil
+}
+
+func (s *memoryStaff) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*Staff, error) {
+	return s.findOne(func(m *Staff) bool { return m.PhoneNumber == phoneNumber })
+}
+
+func (s *memoryStaff) FindByPhoneNumbers(ctx context.Context, phoneNumbers []string) ([]Staff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneWhere(s.staff, func(m *Staff) bool { return slices.Contains(phoneNumbers, m.PhoneNumber) }), nil
+}
+
+func (s *memoryStaff) FindByPublicID(ctx context.Context, publicID string) (*Staff, error) {
+	return s.findOne(func(m *Staff) bool { return m.PublicID == publicID })
+}
+
+func (s *memoryStaff) FindByPublicIDs(ctx context.Context, publicIDs []string) ([]Staff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneWhere(s.staff, func(m *Staff) bool { return slices.Contains(publicIDs, m.PublicID) }), nil
+}
+
+func (s *memoryStaff) findOne(match func(*Staff) bool) (*Staff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.staff, match)
+	if i < 0 {
+		return nil, nil
+	}
+	staff := clone(s.staff[i])
+	return &staff, nil
+}
+
+func (s *memoryStaff) PhoneNumberTaken(ctx context.Context, phoneNumber string, exceptID bson.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.phoneNumberTaken(phoneNumber, exceptID), nil
+}
+
+func (s *memoryStaff) phoneNumberTaken(phoneNumber string, exceptID bson.ObjectID) bool {
+	return indexWhere(s.staff, func(m *Staff) bool {
+		return m.PhoneNumber == phoneNumber && (exceptID.IsZero() || m.ID != exceptID)
+	}) >= 0
+}
+
+func (s *memoryStaff) Insert(ctx context.Context, staff Staff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.phoneNumberTaken(staff.PhoneNumber, bson.ObjectID{}) {
+		return ErrDuplicate
+	}
+	if staff.ID.IsZero() {
+		staff.ID = bson.NewObjectID()
+	}
+	s.staff = append(s.staff, clone(staff))
+	return nil
+}
+
+func (s *memoryStaff) Update(ctx context.Context, staff Staff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.phoneNumberTaken(staff.PhoneNumber, staff.ID) {
+		return ErrDuplicate
+	}
+	return s.update(staff.ID, func(m *Staff) {
+		m.PhoneNumber = staff.PhoneNumber
+		m.Active = staff.Active
+		m.Email = staff.Email
+		m.Channels = slices.Clone(staff.Channels)
+	})
+}
+
+func (s *memoryStaff) SetActive(ctx context.Context, id bson.ObjectID, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(id, func(m *Staff) { m.Active = active })
+}
+
+func (s *memoryStaff) SetPublicID(ctx context.Context, id bson.ObjectID, publicID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(id, func(m *Staff) { m.PublicID = publicID })
+}
+
+// update applies change to a staff member. Like an update that matches
+// nothing, a missing member is not an error.
+func (s *memoryStaff) update(id bson.ObjectID, change func(*Staff)) error {
+	if i := indexWhere(s.staff, func(m *Staff) bool { return m.ID == id }); i >= 0 {
+		change(&s.staff[i])
+	}
+	return nil
+}
+
+func (s *memoryStaff) MarkAlerted(ctx context.Context, ids []bson.ObjectID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.staff {
+		if slices.Contains(ids, s.staff[i].ID) {
+			alertedAt := at
+			s.staff[i].LastAlertedAt = &alertedAt
+		}
+	}
+	return nil
+}
+
+func (s *memoryStaff) Delete(ctx context.Context, publicID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.staff, func(m *Staff) bool { return m.PublicID == publicID })
+	if i < 0 {
+		return false, nil
+	}
+	s.staff = slices.Delete(s.staff, i, i+1)
+	return true, nil
+}
+
+type memoryThreads struct {
+	*memoryDB
+}
+
+func isActiveThread(t *Thread) bool {
+	return slices.Contains(ActiveThreadStatuses, t.Status)
+}
+
+func (s *memoryThreads) findOne(match func(*Thread) bool) (*Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.threads, match)
+	if i < 0 {
+		return nil, nil
+	}
+	thread := clone(s.threads[i])
+	return &thread, nil
+}
+
+func (s *memoryThreads) FindByID(ctx context.Context, id bson.ObjectID) (*Thread, error) {
+	return s.findOne(func(t *Thread) bool { return t.ID == id })
+}
+
+func (s *memoryThreads) FindActiveByPhoneNumber(ctx context.Context, phoneNumber string) (*Thread, error) {
+	return s.findOne(func(t *Thread) bool { return t.PhoneNumber == phoneNumber && isActiveThread(t) })
+}
+
+func (s *memoryThreads) FindActiveByCode(ctx context.Context, code string) (*Thread, error) {
+	return s.findOne(func(t *Thread) bool { return t.Code == code && isActiveThread(t) })
+}
+
+func (s *memoryThreads) FindLastClosed(ctx context.Context, phoneNumber string) (*Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last *Thread
+	for i := range s.threads {
+		t := &s.threads[i]
+		if t.PhoneNumber == phoneNumber && t.Status == ThreadStatusClosed && (last == nil || t.CreatedAt.After(last.CreatedAt)) {
+			last = t
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	thread := clone(*last)
+	return &thread, nil
+}
+
+func (s *memoryThreads) ListActive(ctx context.Context) ([]Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	threads := cloneWhere(s.threads, isActiveThread)
+	slices.SortStableFunc(threads, func(a, b Thread) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return threads, nil
+}
+
+func (s *memoryThreads) Insert(ctx context.Context, thread Thread) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if indexWhere(s.threads, func(t *Thread) bool { return t.ID == thread.ID }) >= 0 {
+		return ErrDuplicate
+	}
+	// Like the unique index of the other stores, allow one active thread
+	// per reporter.
+	if isActiveThread(&thread) && indexWhere(s.threads, func(t *Thread) bool {
+		return t.PhoneNumber == thread.PhoneNumber && isActiveThread(t)
+	}) >= 0 {
+		return ErrDuplicate
+	}
+	s.threads = append(s.threads, clone(thread))
+	return nil
+}
+
+// update applies change to a thread. Like an update that matches nothing, a
+// missing thread is not an error.
+func (s *memoryThreads) update(id bson.ObjectID, change func(*Thread)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := indexWhere(s.threads, func(t *Thread) bool { return t.ID == id }); i >= 0 {
+		change(&s.threads[i])
+	}
+	return nil
+}
+
+func (s *memoryThreads) SetCode(ctx context.Context, id bson.ObjectID, code string) error {
+	return s.update(id, func(t *Thread) { t.Code = code })
+}
+
+func (s *memoryThreads) Touch(ctx context.Context, id bson.ObjectID, now time.Time) error {
+	return s.update(id, func(t *Thread) {
+		t.LastActivityAt = now
+		t.UpdatedAt = now
+	})
+}
+
+// claim applies change to the first thread matching match and returns a
+// copy of it afterwards, or nil if none matched.
+func (s *memoryThreads) claim(match func(*Thread) bool, change func(*Thread)) (*Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.threads, match)
+	if i < 0 {
+		return nil, nil
+	}
+	change(&s.threads[i])
+	thread := clone(s.threads[i])
+	return &thread, nil
+}
+
+func applyTransition(t *Thread, to string, by string, now time.Time) {
+	t.Status = to
+	t.UpdatedAt = now
+
+	switch to {
+	case ThreadStatusAcknowledged:
+		t.AcknowledgedAt = &now
+		t.AcknowledgedBy = by
+	case ThreadStatusClosed:
+		t.ClosedAt = &now
+		t.ClosedBy = by
+	}
+
+	t.Transitions = append(t.Transitions, ThreadTransition{Status: to, At: now, By: by})
+}
+
+func (s *memoryThreads) Transition(ctx context.Context, id bson.ObjectID, from []string, to string, by string, now time.Time) (*Thread, error) {
+	return s.claim(
+		func(t *Thread) bool { return t.ID == id && slices.Contains(from, t.Status) },
+		func(t *Thread) { applyTransition(t, to, by, now) },
+	)
+}
+
+func (s *memoryThreads) CloseInactive(ctx context.Context, cutoff time.Time, by string, now time.Time) (*Thread, error) {
+	return s.claim(
+		func(t *Thread) bool {
+			lastActivity := t.LastActivityAt
+			if lastActivity.IsZero() {
+				lastActivity = t.CreatedAt
+			}
+			return isActiveThread(t) && lastActivity.Before(cutoff)
+		},
+		func(t *Thread) { applyTransition(t, ThreadStatusClosed, by, now) },
+	)
+}
+
+func (s *memoryThreads) SetEscalation(ctx context.Context, id bson.ObjectID, tier int, next *time.Time) error {
+	return s.update(id, func(t *Thread) {
+		t.EscalationTier = tier
+		t.NextEscalationAt = nil
+		if next != nil {
+			at := *next
+			t.NextEscalationAt = &at
+		}
+	})
+}
+
+func (s *memoryThreads) ClaimDueEscalation(ctx context.Context, now time.Time) (*Thread, error) {
+	var claimed Thread
+	thread, err := s.claim(
+		func(t *Thread) bool {
+			return t.Status == ThreadStatusOpen && t.NextEscalationAt != nil && !t.NextEscalationAt.After(now)
+		},
+		func(t *Thread) {
+			// Return the thread as it was before the claim, as MongoDB does.
+			claimed = clone(*t)
+			t.NextEscalationAt = nil
+		},
+	)
+	if thread == nil || err != nil {
+		return nil, err
+	}
+	return &claimed, nil
+}
+
+func (s *memoryThreads) Assign(ctx context.Context, id bson.ObjectID, publicID string, groupAlertAt time.Time) error {
+	return s.update(id, func(t *Thread) {
+		t.AssignedTo = publicID
+		t.GroupAlertAt = &groupAlertAt
+	})
+}
+
+func (s *memoryThreads) ClaimDueGroupAlert(ctx context.Context, now time.Time) (*Thread, error) {
+	return s.claim(
+		func(t *Thread) bool {
+			return t.Status == ThreadStatusOpen && t.GroupAlertAt != nil && !t.GroupAlertAt.After(now)
+		},
+		func(t *Thread) { t.GroupAlertAt = nil },
+	)
+}
+
+func (s *memoryThreads) SaveVoicemail(ctx context.Context, id bson.ObjectID, voicemail Voicemail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.threads, func(t *Thread) bool { return t.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	thread := &s.threads[i]
+
+	if j := indexWhere(thread.Voicemails, func(v *Voicemail) bool { return v.RecordingSid == voicemail.RecordingSid }); j >= 0 {
+		thread.Voicemails[j].CallSid = voicemail.CallSid
+		thread.Voicemails[j].RecordingURL = voicemail.RecordingURL
+		thread.Voicemails[j].DurationSeconds = voicemail.DurationSeconds
+		return nil
+	}
+
+	thread.Voicemails = append(thread.Voicemails, voicemail)
+	return nil
+}
+
+func (s *memoryThreads) SaveTranscription(ctx context.Context, id bson.ObjectID, recordingSid string, status string, text string) error {
+	s.mu.Lock()
+	i := indexWhere(s.threads, func(t *Thread) bool { return t.ID == id })
+	if i >= 0 {
+		voicemails := s.threads[i].Voicemails
+		if j := indexWhere(voicemails, func(v *Voicemail) bool { return v.RecordingSid == recordingSid }); j >= 0 {
+			voicemails[j].TranscriptionStatus = status
+			voicemails[j].Transcription = text
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	s.mu.Unlock()
+
+	return s.SaveVoicemail(ctx, id, Voicemail{
+		RecordingSid:        recordingSid,
+		TranscriptionStatus: status,
+		Transcription:       text,
+		CreatedAt:           time.Now(),
+	})
+}
+
+type memoryBlockList struct {
+	*memoryDB
+}
+
+func blockActiveAt(b *BlockedNumber, now time.Time) bool {
+	return b.ExpiresAt == nil || b.ExpiresAt.After(now)
+}
+
+func (s *memoryBlockList) IsBlocked(ctx context.Context, phoneNumber string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return indexWhere(s.blocked, func(b *BlockedNumber) bool {
+		return b.PhoneNumber == phoneNumber && blockActiveAt(b, now)
+	}) >= 0, nil
+}
+
+func (s *memoryBlockList) Upsert(ctx context.Context, blocked BlockedNumber) (*BlockedNumber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := indexWhere(s.blocked, func(b *BlockedNumber) bool { return b.PhoneNumber == blocked.PhoneNumber }); i >= 0 {
+		blocked.ID = s.blocked[i].ID
+		s.blocked[i] = clone(blocked)
+	} else {
+		blocked.ID = bson.NewObjectID()
+		s.blocked = append(s.blocked, clone(blocked))
+	}
+
+	stored := clone(blocked)
+	return &stored, nil
+}
+
+func (s *memoryBlockList) List(ctx context.Context, includeExpired bool, now time.Time, skip int64, limit int64) ([]BlockedNumber, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := cloneWhere(s.blocked, func(b *BlockedNumber) bool { return includeExpired || blockActiveAt(b, now) })
+	slices.SortStableFunc(items, func(a, b BlockedNumber) int { return b.CreatedAt.Compare(a.CreatedAt) })
+
+	total := int64(len(items))
+	start := min(skip, total)
+	end := min(start+limit, total)
+	return items[start:end], total, nil
+}
+
+func (s *memoryBlockList) Delete(ctx context.Context, phoneNumber string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.blocked)
+	s.blocked = slices.DeleteFunc(s.blocked, func(b BlockedNumber) bool { return b.PhoneNumber == phoneNumber })
+	return len(s.blocked) < before, nil
+}
+
+type memorySchedules struct {
+	*memoryDB
+}
+
+func (s *memorySchedules) Count(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.schedules)), nil
+}
+
+func (s *memorySchedules) List(ctx context.Context, phoneNumber string) ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := cloneWhere(s.schedules, func(sc *Schedule) bool { return phoneNumber == "" || sc.PhoneNumber == phoneNumber })
+	slices.SortStableFunc(schedules, func(a, b Schedule) int {
+		return cmp.Or(
+			cmp.Compare(a.PhoneNumber, b.PhoneNumber),
+			cmp.Compare(a.DayOfWeek, b.DayOfWeek),
+			cmp.Compare(a.StartTime, b.StartTime),
+		)
+	})
+	return schedules, nil
+}
+
+func (s *memorySchedules) FindCandidates(ctx context.Context, daysOfWeek []int, dates []string) ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneWhere(s.schedules, func(sc *Schedule) bool {
+		return sc.Always ||
+			(sc.Recurring && slices.Contains(daysOfWeek, sc.DayOfWeek)) ||
+			(!sc.Recurring && slices.Contains(dates, sc.Date))
+	}), nil
+}
+
+func (s *memorySchedules) FindByID(ctx context.Context, id bson.ObjectID) (*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.schedules, func(sc *Schedule) bool { return sc.ID == id })
+	if i < 0 {
+		return nil, nil
+	}
+	schedule := clone(s.schedules[i])
+	return &schedule, nil
+}
+
+func (s *memorySchedules) Insert(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule.ID.IsZero() {
+		schedule.ID = bson.NewObjectID()
+	}
+	s.schedules = append(s.schedules, clone(schedule))
+	return nil
+}
+
+func (s *memorySchedules) Replace(ctx context.Context, schedule Schedule) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.schedules, func(sc *Schedule) bool { return sc.ID == schedule.ID })
+	if i < 0 {
+		return false, nil
+	}
+	s.schedules[i] = clone(schedule)
+	return true, nil
+}
+
+func (s *memorySchedules) Delete(ctx context.Context, id bson.ObjectID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.schedules)
+	s.schedules = slices.DeleteFunc(s.schedules, func(sc Schedule) bool { return sc.ID == id })
+	return len(s.schedules) < before, nil
+}
+
+func (s *memorySchedules) ChangePhoneNumber(ctx context.Context, from string, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.schedules {
+		if s.schedules[i].PhoneNumber == from {
+			s.schedules[i].PhoneNumber = to
+		}
+	}
+	return nil
+}
+
+func (s *memorySchedules) DeleteByPhoneNumber(ctx context.Context, phoneNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schedules = slices.DeleteFunc(s.schedules, func(sc Schedule) bool { return sc.PhoneNumber == phoneNumber })
+	return nil
+}
+
+type memoryConfig struct {
+	*memoryDB
+}
+
+func (s *memoryConfig) Get(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config[key], nil
+}
+
+func (s *memoryConfig) Set(ctx context.Context, key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config[key] = value
+	return nil
+}
+
+func (s *memoryConfig) CompareAndSet(ctx context.Context, key string, old string, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config[key] != old {
+		return false, nil
+	}
+	s.config[key] = value
+	return true, nil
+}
+
+func (s *memoryConfig) VoiceMenu(ctx context.Context) (*VoiceMenu, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.voiceMenu == nil {
+		return nil, nil
+	}
+	menu := clone(*s.voiceMenu)
+	return &menu, nil
+}
+
+func (s *memoryConfig) SetVoiceMenu(ctx context.Context, menu *VoiceMenu) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := clone(*menu)
+	s.voiceMenu = &stored
+	return nil
+}
+
+func (s *memoryConfig) DeleteVoiceMenu(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existed := s.voiceMenu != nil
+	s.voiceMenu = nil
+	return existed, nil
+}
+
+type memoryMessages struct {
+	*memoryDB
+}
+
+func (s *memoryMessages) Insert(ctx context.Context, message Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, clone(message))
+	return nil
+}
+
+func (s *memoryMessages) FindLast(ctx context.Context, threadID bson.ObjectID, kind string) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last *Message
+	for i := range s.messages {
+		m := &s.messages[i]
+		if m.ThreadID == threadID && m.Kind == kind && (last == nil || !m.CreatedAt.Before(last.CreatedAt)) {
+			last = m
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	message := clone(*last)
+	return &message, nil
+}
+
+type memoryWebhookDeliveries struct {
+	*memoryDB
+}
+
+func (s *memoryWebhookDeliveries) Insert(ctx context.Context, delivery WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries = append(s.deliveries, clone(delivery))
+	return nil
+}
+
+func (s *memoryWebhookDeliveries) ClaimDue(ctx context.Context, now time.Time, leaseUntil time.Time) (*WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := -1
+	for i := range s.deliveries {
+		d := &s.deliveries[i]
+		if d.Status != DeliveryStatusPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		if due < 0 || d.NextAttemptAt.Before(s.deliveries[due].NextAttemptAt) {
+			due = i
+		}
+	}
+	if due < 0 {
+		return nil, nil
+	}
+
+	// Return the delivery as it was before the lease, as MongoDB does.
+	delivery := clone(s.deliveries[due])
+	s.deliveries[due].NextAttemptAt = leaseUntil
+	return &delivery, nil
+}
+
+func (s *memoryWebhookDeliveries) RecordAttempt(ctx context.Context, delivery WebhookDelivery, attempt DeliveryAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := indexWhere(s.deliveries, func(d *WebhookDelivery) bool { return d.ID == delivery.ID })
+	if i < 0 {
+		return nil
+	}
+
+	d := &s.deliveries[i]
+	d.Status = delivery.Status
+	d.Attempts = delivery.Attempts
+	d.NextAttemptAt = delivery.NextAttemptAt
+	d.LastError = delivery.LastError
+	d.UpdatedAt = delivery.UpdatedAt
+	d.History = append(d.History, attempt)
+	return nil
+}
+
+type memoryEscalation struct {
+	*memoryDB
+}
+
+func (s *memoryEscalation) Get(ctx context.Context) (*EscalationPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policy == nil {
+		return nil, nil
+	}
+	policy := clone(*s.policy)
+	return &policy, nil
+}
+
+func (s *memoryEscalation) Save(ctx context.Context, policy EscalationPolicy) (*EscalationPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy.Name = DefaultEscalationPolicy
+	if s.policy != nil {
+		policy.ID = s.policy.ID
+	} else {
+		policy.ID = bson.NewObjectID()
+	}
+
+	stored := clone(policy)
+	s.policy = &stored
+	result := clone(policy)
+	return &result, nil
+}
+
+func (s *memoryEscalation) Delete(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existed := s.policy != nil
+	s.policy = nil
+	return existed, nil
+}
@@ -0,0 +1,114 @@
+-- Tables for the SQL store. The SQL here runs unchanged on SQLite and
+-- Postgres: IDs are MongoDB-style ObjectID hex strings, times are Unix
+-- milliseconds and lists are JSON text.
+
+CREATE TABLE staff (
+    id TEXT PRIMARY KEY,
+    public_id TEXT NOT NULL DEFAULT '',
+    phone_number TEXT NOT NULL UNIQUE,
+    active BOOLEAN NOT NULL DEFAULT FALSE,
+    email TEXT NOT NULL DEFAULT '',
+    last_alerted_at BIGINT,
+    channels TEXT NOT NULL DEFAULT 'null'
+);
+
+CREATE INDEX staff_public_id ON staff (public_id);
+
+CREATE TABLE threads (
+    id TEXT PRIMARY KEY,
+    phone_number TEXT NOT NULL,
+    code TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL,
+    last_activity_at BIGINT NOT NULL,
+    acknowledged_at BIGINT,
+    acknowledged_by TEXT NOT NULL DEFAULT '',
+    closed_at BIGINT,
+    closed_by TEXT NOT NULL DEFAULT '',
+    previous_thread_id TEXT,
+    transitions TEXT NOT NULL DEFAULT 'null',
+    escalation_tier INTEGER NOT NULL DEFAULT 0,
+    next_escalation_at BIGINT,
+    assigned_to TEXT NOT NULL DEFAULT '',
+    group_alert_at BIGINT,
+    voicemails TEXT NOT NULL DEFAULT 'null'
+);
+
+CREATE INDEX threads_phone_number_status ON threads (phone_number, status);
+CREATE INDEX threads_status_code ON threads (status, code);
+CREATE INDEX threads_next_escalation_at ON threads (next_escalation_at);
+CREATE INDEX threads_group_alert_at ON threads (group_alert_at);
+
+CREATE TABLE blocklist (
+    id TEXT PRIMARY KEY,
+    phone_number TEXT NOT NULL UNIQUE,
+    created_at BIGINT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    blocked_by TEXT NOT NULL DEFAULT '',
+    expires_at BIGINT
+);
+
+CREATE TABLE schedules (
+    id TEXT PRIMARY KEY,
+    uid INTEGER NOT NULL DEFAULT 0,
+    phone_number TEXT NOT NULL,
+    start_time TEXT NOT NULL DEFAULT '',
+    end_time TEXT NOT NULL DEFAULT '',
+    day_of_week INTEGER NOT NULL DEFAULT 0,
+    recurring BOOLEAN NOT NULL DEFAULT FALSE,
+    always BOOLEAN NOT NULL DEFAULT FALSE,
+    date TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    tier INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX schedules_phone_number ON schedules (phone_number);
+
+CREATE TABLE config (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE messages (
+    id TEXT PRIMARY KEY,
+    thread_id TEXT NOT NULL DEFAULT '',
+    direction TEXT NOT NULL,
+    channel TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    from_number TEXT NOT NULL DEFAULT '',
+    to_numbers TEXT NOT NULL DEFAULT 'null',
+    body TEXT NOT NULL DEFAULT '',
+    message_sid TEXT NOT NULL DEFAULT '',
+    call_sid TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT '',
+    deliveries TEXT NOT NULL DEFAULT 'null',
+    created_at BIGINT NOT NULL
+);
+
+CREATE INDEX messages_thread_id_kind ON messages (thread_id, kind, created_at);
+
+CREATE TABLE webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    url TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at BIGINT NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    history TEXT NOT NULL DEFAULT 'null',
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_status_next_attempt_at ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE escalation_policies (
+    name TEXT PRIMARY KEY,
+    id TEXT NOT NULL,
+    tiers TEXT NOT NULL DEFAULT 'null',
+    updated_at BIGINT NOT NULL
+);
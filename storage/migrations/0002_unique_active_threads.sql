@@ -0,0 +1,5 @@
+-- One active thread per reporter, so concurrent messages cannot open two.
+-- Any existing duplicates are closed first, keeping the newest, by
+-- closeDuplicateActiveSQLThreads so that they get a closing transition.
+
+CREATE UNIQUE INDEX threads_active_phone_number ON threads (phone_number) WHERE status IN ('OPEN', 'ACKNOWLEDGED');
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DefaultEscalationPolicy is the name the escalation policy is stored under.
+const DefaultEscalationPolicy = "default"
+
+// voiceMenuKey is the config entry holding the voice menu.
+const voiceMenuKey = "voice_menu"
+
+const (
+	ThreadStatusOpen         = "OPEN"
+	ThreadStatusAcknowledged = "ACKNOWLEDGED"
+	ThreadStatusClosed       = "CLOSED"
+)
+
+// ActiveThreadStatuses are the statuses of threads that still route new
+// messages from the reporter.
+var ActiveThreadStatuses = []string{ThreadStatusOpen, ThreadStatusAcknowledged}
+
+type Staff struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id"`
+	PublicID    string        `bson:"id" json:"id"`
+	PhoneNumber string        `bson:"phone_number" json:"phone_number"`
+	Active      bool          `bson:"active" json:"active"`
+	// Email receives alerts when the EMAIL channel is chosen.
+	Email string `bson:"email,omitempty" json:"email,omitempty"`
+	// LastAlertedAt is when the member was last alerted about a thread.
+	LastAlertedAt *time.Time `bson:"last_alerted_at,omitempty" json:"last_alerted_at,omitempty"`
+	// Channels lists the notifier channels the member receives alerts on.
+	// Empty means SMS only.
+	Channels []string `bson:"channels,omitempty" json:"channels,omitempty"`
+}
+
+type Thread struct {
+	ID               bson.ObjectID      `bson:"_id" json:"_id"`
+	PhoneNumber      string             `bson:"phone_number" json:"phone_number"`
+	Code             string             `bson:"code" json:"code"`
+	Status           string             `bson:"status" json:"status"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+	LastActivityAt   time.Time          `bson:"last_activity_at" json:"last_activity_at"`
+	AcknowledgedAt   *time.Time         `bson:"acknowledged_at,omitempty" json:"acknowledged_at,omitempty"`
+	AcknowledgedBy   string             `bson:"acknowledged_by,omitempty" json:"acknowledged_by,omitempty"`
+	ClosedAt         *time.Time         `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	ClosedBy         string             `bson:"closed_by,omitempty" json:"closed_by,omitempty"`
+	PreviousThreadID *bson.ObjectID     `bson:"previous_thread_id,omitempty" json:"previous_thread_id,omitempty"`
+	Transitions      []ThreadTransition `bson:"transitions,omitempty" json:"transitions,omitempty"`
+	// EscalationTier is the index of the last escalation tier alerted.
+	EscalationTier int `bson:"escalation_tier,omitempty" json:"escalation_tier,omitempty"`
+	// NextEscalationAt is when the next tier is alerted if the thread is
+	// still OPEN. Nil when there is no tier left.
+	NextEscalationAt *time.Time `bson:"next_escalation_at,omitempty" json:"next_escalation_at,omitempty"`
+	// AssignedTo is the public ID of the staff member a routed thread was
+	// given to.
+	AssignedTo string `bson:"assigned_to,omitempty" json:"assigned_to,omitempty"`
+	// GroupAlertAt is when the rest of the group is alerted if the assigned
+	// staff member has not acknowledged the thread.
+	GroupAlertAt *time.Time `bson:"group_alert_at,omitempty" json:"group_alert_at,omitempty"`
+	// Voicemails are messages the reporter left when nobody answered.
+	Voicemails []Voicemail `bson:"voicemails,omitempty" json:"voicemails,omitempty"`
+}
+
+// ThreadTransition records a change of thread status and who made it.
+type ThreadTransition struct {
+	Status string    `bson:"status" json:"status"`
+	At     time.Time `bson:"at" json:"at"`
+	By     string    `bson:"by" json:"by"`
+}
+
+type BlockedNumber struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id"`
+	PhoneNumber string        `bson:"phone_number" json:"phone_number"`
+	CreatedAt   time.Time     `bson:"created_at" json:"created_at"`
+	Reason      string        `bson:"reason" json:"reason"`
+	BlockedBy   string        `bson:"blocked_by" json:"blocked_by"`
+	// ExpiresAt lifts the block at the given time. Nil blocks indefinitely.
+	ExpiresAt *time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+type Schedule struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UID         int           `bson:"uid" json:"uid"`
+	PhoneNumber string        `bson:"phone_number" json:"phone_number"`
+	StartTime   string        `bson:"start_time" json:"start_time"`
+	EndTime     string        `bson:"end_time" json:"end_time"`
+	DayOfWeek   int           `bson:"day_of_week" json:"day_of_week"`
+	Recurring   bool          `bson:"recurring" json:"recurring"`
+	Always      bool          `bson:"always" json:"always"`
+	Date        string        `bson:"date" json:"date"`
+	// Timezone is an IANA time zone for StartTime and EndTime. Empty uses
+	// the service's configured time zone.
+	Timezone string `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	// Tier is the escalation level of the shift: 1 (or 0) is primary, 2 is
+	// backup, and so on.
+	Tier int `bson:"tier,omitempty" json:"tier,omitempty"`
+}
+
+// Message is a single SMS or call event. Outbound messages sent to several
+// recipients are stored once, with one delivery per recipient.
+type Message struct {
+	ID         bson.ObjectID     `bson:"_id,omitempty" json:"_id"`
+	ThreadID   bson.ObjectID     `bson:"thread_id,omitempty" json:"thread_id"`
+	Direction  string            `bson:"direction" json:"direction"`
+	Channel    string            `bson:"channel" json:"channel"`
+	Kind       string            `bson:"kind" json:"kind"`
+	From       string            `bson:"from" json:"from"`
+	To         []string          `bson:"to" json:"to"`
+	Body       string            `bson:"body,omitempty" json:"body,omitempty"`
+	MessageSid string            `bson:"message_sid,omitempty" json:"message_sid,omitempty"`
+	CallSid    string            `bson:"call_sid,omitempty" json:"call_sid,omitempty"`
+	Status     string            `bson:"status,omitempty" json:"status,omitempty"`
+	Deliveries []MessageDelivery `bson:"deliveries,omitempty" json:"deliveries,omitempty"`
+	CreatedAt  time.Time         `bson:"created_at" json:"created_at"`
+}
+
+// MessageDelivery is the outcome of sending a message to one recipient.
+type MessageDelivery struct {
+	Channel    string `bson:"channel,omitempty" json:"channel,omitempty"`
+	To         string `bson:"to" json:"to"`
+	MessageSid string `bson:"message_sid,omitempty" json:"message_sid,omitempty"`
+	Error      string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryStatusPending   = "PENDING"
+	DeliveryStatusDelivered = "DELIVERED"
+	DeliveryStatusFailed    = "FAILED"
+)
+
+// WebhookDelivery is one event sent to one webhook URL, with every attempt.
+type WebhookDelivery struct {
+	ID            bson.ObjectID     `bson:"_id"`
+	EventID       string            `bson:"event_id"`
+	EventType     string            `bson:"event_type"`
+	URL           string            `bson:"url"`
+	Payload       string            `bson:"payload"`
+	Status        string            `bson:"status"`
+	Attempts      int               `bson:"attempts"`
+	NextAttemptAt time.Time         `bson:"next_attempt_at"`
+	LastError     string            `bson:"last_error,omitempty"`
+	History       []DeliveryAttempt `bson:"history,omitempty"`
+	CreatedAt     time.Time         `bson:"created_at"`
+	UpdatedAt     time.Time         `bson:"updated_at"`
+}
+
+// DeliveryAttempt is the outcome of one POST to an event webhook.
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at"`
+	StatusCode int       `bson:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty"`
+}
+
+// EscalationPolicy is the order in which staff are contacted about a call or
+// a new thread. Each tier is tried for its timeout before moving on to the
+// next.
+type EscalationPolicy struct {
+	ID        bson.ObjectID    `bson:"_id,omitempty" json:"_id"`
+	Name      string           `bson:"name" json:"name"`
+	Tiers     []EscalationTier `bson:"tiers" json:"tiers"`
+	UpdatedAt time.Time        `bson:"updated_at" json:"updated_at"`
+}
+
+// EscalationTier is one step of an escalation policy.
+type EscalationTier struct {
+	Target string `bson:"target" json:"target"`
+	// ScheduleTier limits ON_CALL to shifts of one schedule tier. 0 matches
+	// every tier.
+	ScheduleTier int `bson:"schedule_tier,omitempty" json:"schedule_tier,omitempty"`
+	// StaffIDs are the public IDs of the staff for the STAFF target.
+	StaffIDs []string `bson:"staff_ids,omitempty" json:"staff_ids,omitempty"`
+	// TimeoutSeconds is how long calls ring and how long texts wait for an
+	// acknowledgement before the next tier is contacted.
+	TimeoutSeconds int `bson:"timeout_seconds" json:"timeout_seconds"`
+}
+
+// VoiceMenu is a keypad menu played to callers before they are connected.
+type VoiceMenu struct {
+	Prompt string `bson:"prompt" json:"prompt"`
+	// TimeoutSeconds is how long to wait for a key press. When the caller
+	// presses nothing, they are connected to the on-call staff.
+	TimeoutSeconds int               `bson:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
+	Options        []VoiceMenuOption `bson:"options" json:"options"`
+}
+
+// VoiceMenuOption is what happens when a caller presses a key.
+type VoiceMenuOption struct {
+	Digit  string `bson:"digit" json:"digit"`
+	Action string `bson:"action" json:"action"`
+	// Target picks the staff DIAL rings, as in an escalation tier. Without
+	// a target the call goes to the on-call staff or escalation policy.
+	Target       string   `bson:"target,omitempty" json:"target,omitempty"`
+	ScheduleTier int      `bson:"schedule_tier,omitempty" json:"schedule_tier,omitempty"`
+	StaffIDs     []string `bson:"staff_ids,omitempty" json:"staff_ids,omitempty"`
+	// Message is spoken by SAY, or replaces the voicemail prompt for
+	// VOICEMAIL.
+	Message string `bson:"message,omitempty" json:"message,omitempty"`
+	// Menu is the submenu MENU opens.
+	Menu *VoiceMenu `bson:"menu,omitempty" json:"menu,omitempty"`
+}
+
+// Voicemail is a message a caller recorded after nobody answered.
+type Voicemail struct {
+	CallSid         string `bson:"call_sid,omitempty" json:"call_sid,omitempty"`
+	RecordingSid    string `bson:"recording_sid" json:"recording_sid"`
+	RecordingURL    string `bson:"recording_url,omitempty" json:"recording_url,omitempty"`
+	DurationSeconds int    `bson:"duration_seconds,omitempty" json:"duration_seconds,omitempty"`
+	// TranscriptionStatus is Twilio's transcription status, completed or
+	// failed, once the transcription callback arrives.
+	TranscriptionStatus string    `bson:"transcription_status,omitempty" json:"transcription_status,omitempty"`
+	Transcription       string    `bson:"transcription,omitempty" json:"transcription,omitempty"`
+	CreatedAt           time.Time `bson:"created_at" json:"created_at"`
+}
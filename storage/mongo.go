@@ -0,0 +1,645 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// NewMongoStore returns a store backed by the given MongoDB database.
+func NewMongoStore(client *mongo.Client, databaseName string) Store {
+	db := client.Database(databaseName)
+
+	return Store{
+		Staff:             &mongoStaff{db.Collection("staff")},
+		Threads:           &mongoThreads{db.Collection("threads")},
+		BlockList:         &mongoBlockList{db.Collection("blocklist")},
+		Schedules:         &mongoSchedules{db.Collection("schedules")},
+		Config:            &mongoConfig{db.Collection("config")},
+		Messages:          &mongoMessages{db.Collection("messages")},
+		WebhookDeliveries: &mongoWebhookDeliveries{db.Collection("webhook_deliveries")},
+		Escalation:        &mongoEscalation{db.Collection("escalation_policies")},
+	}
+}
+
+// findOne decodes the first document matching filter, or returns nil if
+// there is none.
+func findOne[T any](ctx context.Context, col *mongo.Collection, filter any, opts ...options.Lister[options.FindOneOptions]) (*T, error) {
+	var doc T
+	err := col.FindOne(ctx, filter, opts...).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// findAll decodes every document matching filter.
+func findAll[T any](ctx context.Context, col *mongo.Collection, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	cursor, err := col.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	docs := []T{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// findOneAndUpdate applies update to the first document matching filter and
+// decodes it, or returns nil if there is none.
+func findOneAndUpdate[T any](ctx context.Context, col *mongo.Collection, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) (*T, error) {
+	var doc T
+	err := col.FindOneAndUpdate(ctx, filter, update, opts...).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// duplicateErr maps duplicate key errors to ErrDuplicate.
+func duplicateErr(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return err
+}
+
+type mongoStaff struct {
+	col *mongo.Collection
+}
+
+func (s *mongoStaff) List(ctx context.Context) ([]Staff, error) {
+	return findAll[Staff](ctx, s.col, bson.M{}, options.Find().SetSort(bson.D{{Key: "phone_number", Value: 1}}))
+}
+
+func (s *mongoStaff) ListActive(ctx context.Context) ([]Staff, error) {
+	return findAll[Staff](ctx, s.col, bson.M{"active": true})
+}
+
+func (s *mongoStaff) ListWithoutPublicID(ctx context.Context) ([]Staff, error) {
+	return findAll[Staff](ctx, s.col, bson.M{"$or": []bson.M{
+		{"id": bson.M{"$exists": false}},
+		{"id": ""},
+	}})
+}
+
+func (s *mongoStaff) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*Staff, error) {
+	return findOne[Staff](ctx, s.col, bson.M{"phone_number": phoneNumber})
+}
+
+func (s *mongoStaff) FindByPhoneNumbers(ctx context.Context, phoneNumbers []string) ([]Staff, error) {
+	return findAll[Staff](ctx, s.col, bson.M{"phone_number": bson.M{"$in": phoneNumbers}})
+}
+
+func (s *mongoStaff) FindByPublicID(ctx context.Context, publicID string) (*Staff, error) {
+	return findOne[Staff](ctx, s.col, bson.M{"id": publicID})
+}
+
+func (s *mongoStaff) FindByPublicIDs(ctx context.Context, publicIDs []string) ([]Staff, error) {
+	return findAll[Staff](ctx, s.col, bson.M{"id": bson.M{"$in": publicIDs}})
+}
+
+func (s *mongoStaff) PhoneNumberTaken(ctx context.Context, phoneNumber string, exceptID bson.ObjectID) (bool, error) {
+	filter := bson.M{"phone_number": phoneNumber}
+	if !exceptID.IsZero() {
+		filter["_id"] = bson.M{"$ne": exceptID}
+	}
+
+	staff, err := findOne[Staff](ctx, s.col, filter)
+	return staff != nil, err
+}
+
+func (s *mongoStaff) Insert(ctx context.Context, staff Staff) error {
+	_, err := s.col.InsertOne(ctx, staff)
+	return duplicateErr(err)
+}
+
+func (s *mongoStaff) Update(ctx context.Context, staff Staff) error {
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": staff.ID}, bson.M{"$set": bson.M{
+		"phone_number": staff.PhoneNumber,
+		"active":       staff.Active,
+		"email":        staff.Email,
+		"channels":     staff.Channels,
+	}})
+	return duplicateErr(err)
+}
+
+func (s *mongoStaff) SetActive(ctx context.Context, id bson.ObjectID, active bool) error {
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"active": active}})
+	return err
+}
+
+func (s *mongoStaff) SetPublicID(ctx context.Context, id bson.ObjectID, publicID string) error {
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"id": publicID}})
+	return err
+}
+
+func (s *mongoStaff) MarkAlerted(ctx context.Context, ids []bson.ObjectID, at time.Time) error {
+	_, err := s.col.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"last_alerted_at": at}},
+	)
+	return err
+}
+
+func (s *mongoStaff) Delete(ctx context.Context, publicID string) (bool, error) {
+	result, err := s.col.DeleteOne(ctx, bson.M{"id": publicID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+type mongoThreads struct {
+	col *mongo.Collection
+}
+
+func (s *mongoThreads) FindByID(ctx context.Context, id bson.ObjectID) (*Thread, error) {
+	return findOne[Thread](ctx, s.col, bson.M{"_id": id})
+}
+
+func (s *mongoThreads) FindActiveByPhoneNumber(ctx context.Context, phoneNumber string) (*Thread, error) {
+	return findOne[Thread](ctx, s.col, bson.M{"phone_number": phoneNumber, "status": bson.M{"$in": ActiveThreadStatuses}})
+}
+
+func (s *mongoThreads) FindActiveByCode(ctx context.Context, code string) (*Thread, error) {
+	return findOne[Thread](ctx, s.col, bson.M{"code": code, "status": bson.M{"$in": ActiveThreadStatuses}})
+}
+
+func (s *mongoThreads) FindLastClosed(ctx context.Context, phoneNumber string) (*Thread, error) {
+	return findOne[Thread](ctx, s.col,
+		bson.M{"phone_number": phoneNumber, "status": ThreadStatusClosed},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+}
+
+func (s *mongoThreads) ListActive(ctx context.Context) ([]Thread, error) {
+	return findAll[Thread](ctx, s.col,
+		bson.M{"status": bson.M{"$in": ActiveThreadStatuses}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+}
+
+func (s *mongoThreads) Insert(ctx context.Context, thread Thread) error {
+	_, err := s.col.InsertOne(ctx, thread)
+	return duplicateErr(err)
+}
+
+func (s *mongoThreads) SetCode(ctx context.Context, id bson.ObjectID, code string) error {
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"code": code}})
+	return err
+}
+
+func (s *mongoThreads) Touch(ctx context.Context, id bson.ObjectID, now time.Time) error {
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"last_activity_at": now, "updated_at": now}},
+	)
+	return err
+}
+
+func (s *mongoThreads) Transition(ctx context.Context, id bson.ObjectID, from []string, to string, by string, now time.Time) (*Thread, error) {
+	return findOneAndUpdate[Thread](ctx, s.col,
+		bson.M{"_id": id, "status": bson.M{"$in": from}},
+		threadTransitionUpdate(to, by, now),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+}
+
+func (s *mongoThreads) CloseInactive(ctx context.Context, cutoff time.Time, by string, now time.Time) (*Thread, error) {
+	// Threads created before activity was tracked fall back to their
+	// creation time.
+	filter := bson.M{
+		"status": bson.M{"$in": ActiveThreadStatuses},
+		"$or": []bson.M{
+			{"last_activity_at": bson.M{"$lt": cutoff}},
+			{"last_activity_at": bson.M{"$exists": false}, "created_at": bson.M{"$lt": cutoff}},
+		},
+	}
+
+	return findOneAndUpdate[Thread](ctx, s.col, filter,
+		threadTransitionUpdate(ThreadStatusClosed, by, now),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+}
+
+func threadTransitionUpdate(to string, by string, now time.Time) bson.M {
+	set := bson.M{"status": to, "updated_at": now}
+
+	switch to {
+	case ThreadStatusAcknowledged:
+		set["acknowledged_at"] = now
+		set["acknowledged_by"] = by
+	case ThreadStatusClosed:
+		set["closed_at"] = now
+		set["closed_by"] = by
+	}
+
+	return bson.M{
+		"$set":  set,
+		"$push": bson.M{"transitions": ThreadTransition{Status: to, At: now, By: by}},
+	}
+}
+
+func (s *mongoThreads) SetEscalation(ctx context.Context, id bson.ObjectID, tier int, next *time.Time) error {
+	set := bson.M{"escalation_tier": tier}
+	update := bson.M{"$set": set}
+	if next != nil {
+		set["next_escalation_at"] = *next
+	} else {
+		update["$unset"] = bson.M{"next_escalation_at": ""}
+	}
+
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (s *mongoThreads) ClaimDueEscalation(ctx context.Context, now time.Time) (*Thread, error) {
+	return findOneAndUpdate[Thread](ctx, s.col,
+		bson.M{"status": ThreadStatusOpen, "next_escalation_at": bson.M{"$lte": now}},
+		bson.M{"$unset": bson.M{"next_escalation_at": ""}},
+	)
+}
+
+func (s *mongoThreads) Assign(ctx context.Context, id bson.ObjectID, publicID string, groupAlertAt time.Time) error {
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"assigned_to": publicID, "group_alert_at": groupAlertAt}},
+	)
+	return err
+}
+
+func (s *mongoThreads) ClaimDueGroupAlert(ctx context.Context, now time.Time) (*Thread, error) {
+	return findOneAndUpdate[Thread](ctx, s.col,
+		bson.M{"status": ThreadStatusOpen, "group_alert_at": bson.M{"$lte": now}},
+		bson.M{"$unset": bson.M{"group_alert_at": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+}
+
+func (s *mongoThreads) SaveVoicemail(ctx context.Context, id bson.ObjectID, voicemail Voicemail) error {
+	result, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": id, "voicemails.recording_sid": voicemail.RecordingSid},
+		bson.M{"$set": bson.M{
+			"voicemails.$.call_sid":         voicemail.CallSid,
+			"voicemails.$.recording_url":    voicemail.RecordingURL,
+			"voicemails.$.duration_seconds": voicemail.DurationSeconds,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	result, err = s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$push": bson.M{"voicemails": voicemail}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoThreads) SaveTranscription(ctx context.Context, id bson.ObjectID, recordingSid string, status string, text string) error {
+	result, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": id, "voicemails.recording_sid": recordingSid},
+		bson.M{"$set": bson.M{
+			"voicemails.$.transcription_status": status,
+			"voicemails.$.transcription":        text,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	return s.SaveVoicemail(ctx, id, Voicemail{
+		RecordingSid:        recordingSid,
+		TranscriptionStatus: status,
+		Transcription:       text,
+		CreatedAt:           time.Now(),
+	})
+}
+
+type mongoBlockList struct {
+	col *mongo.Collection
+}
+
+// activeBlockFilter matches blocklist entries that have not expired.
+func activeBlockFilter(now time.Time) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"expires_at": nil},
+		{"expires_at": bson.M{"$gt": now}},
+	}}
+}
+
+func (s *mongoBlockList) IsBlocked(ctx context.Context, phoneNumber string, now time.Time) (bool, error) {
+	filter := activeBlockFilter(now)
+	filter["phone_number"] = phoneNumber
+
+	blocked, err := findOne[BlockedNumber](ctx, s.col, filter)
+	return blocked != nil, err
+}
+
+// Upsert retries once on a duplicate key error, which the unique phone
+// number index raises when two upserts of a new number race.
+func (s *mongoBlockList) Upsert(ctx context.Context, blocked BlockedNumber) (*BlockedNumber, error) {
+	result, err := s.upsert(ctx, blocked)
+	if mongo.IsDuplicateKeyError(err) {
+		result, err = s.upsert(ctx, blocked)
+	}
+	return result, err
+}
+
+func (s *mongoBlockList) upsert(ctx context.Context, blocked BlockedNumber) (*BlockedNumber, error) {
+	result, err := findOneAndUpdate[BlockedNumber](ctx, s.col,
+		bson.M{"phone_number": blocked.PhoneNumber},
+		bson.M{"$set": bson.M{
+			"phone_number": blocked.PhoneNumber,
+			"reason":       blocked.Reason,
+			"blocked_by":   blocked.BlockedBy,
+			"created_at":   blocked.CreatedAt,
+			"expires_at":   blocked.ExpiresAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+	if err == nil && result == nil {
+		err = errors.New("upsert returned no document")
+	}
+	return result, err
+}
+
+func (s *mongoBlockList) List(ctx context.Context, includeExpired bool, now time.Time, skip int64, limit int64) ([]BlockedNumber, int64, error) {
+	filter := bson.M{}
+	if !includeExpired {
+		filter = activeBlockFilter(now)
+	}
+
+	total, err := s.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, err := findAll[BlockedNumber](ctx, s.col, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *mongoBlockList) Delete(ctx context.Context, phoneNumber string) (bool, error) {
+	result, err := s.col.DeleteMany(ctx, bson.M{"phone_number": phoneNumber})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+type mongoSchedules struct {
+	col *mongo.Collection
+}
+
+func (s *mongoSchedules) Count(ctx context.Context) (int64, error) {
+	return s.col.CountDocuments(ctx, bson.M{})
+}
+
+func (s *mongoSchedules) List(ctx context.Context, phoneNumber string) ([]Schedule, error) {
+	filter := bson.M{}
+	if phoneNumber != "" {
+		filter["phone_number"] = phoneNumber
+	}
+
+	return findAll[Schedule](ctx, s.col, filter, options.Find().SetSort(bson.D{
+		{Key: "phone_number", Value: 1},
+		{Key: "day_of_week", Value: 1},
+		{Key: "start_time", Value: 1},
+	}))
+}
+
+func (s *mongoSchedules) FindCandidates(ctx context.Context, daysOfWeek []int, dates []string) ([]Schedule, error) {
+	return findAll[Schedule](ctx, s.col, bson.M{
+		"$or": []bson.M{
+			{
+				"always": true,
+			},
+			{
+				"recurring":   true,
+				"day_of_week": bson.M{"$in": daysOfWeek},
+			},
+			{
+				"recurring": false,
+				"date":      bson.M{"$in": dates},
+			},
+		},
+	})
+}
+
+func (s *mongoSchedules) FindByID(ctx context.Context, id bson.ObjectID) (*Schedule, error) {
+	return findOne[Schedule](ctx, s.col, bson.M{"_id": id})
+}
+
+func (s *mongoSchedules) Insert(ctx context.Context, schedule Schedule) error {
+	_, err := s.col.InsertOne(ctx, schedule)
+	return err
+}
+
+func (s *mongoSchedules) Replace(ctx context.Context, schedule Schedule) (bool, error) {
+	result, err := s.col.ReplaceOne(ctx, bson.M{"_id": schedule.ID}, schedule)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (s *mongoSchedules) Delete(ctx context.Context, id bson.ObjectID) (bool, error) {
+	result, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (s *mongoSchedules) ChangePhoneNumber(ctx context.Context, from string, to string) error {
+	_, err := s.col.UpdateMany(ctx,
+		bson.M{"phone_number": from},
+		bson.M{"$set": bson.M{"phone_number": to}},
+	)
+	return err
+}
+
+func (s *mongoSchedules) DeleteByPhoneNumber(ctx context.Context, phoneNumber string) error {
+	_, err := s.col.DeleteMany(ctx, bson.M{"phone_number": phoneNumber})
+	return err
+}
+
+type mongoConfig struct {
+	col *mongo.Collection
+}
+
+func (s *mongoConfig) Get(ctx context.Context, key string) (string, error) {
+	config, err := findOne[struct {
+		Value string `bson:"value"`
+	}](ctx, s.col, bson.M{"key": key})
+	if err != nil || config == nil {
+		return "", err
+	}
+	return config.Value, nil
+}
+
+func (s *mongoConfig) Set(ctx context.Context, key string, value string) error {
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"key": key},
+		bson.M{"$set": bson.M{"key": key, "value": value}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+// CompareAndSet matches on the old value in the same update. When old is
+// "" a missing setting is inserted, and the unique key index turns a
+// concurrent insert into a duplicate key error.
+func (s *mongoConfig) CompareAndSet(ctx context.Context, key string, old string, value string) (bool, error) {
+	result, err := s.col.UpdateOne(ctx,
+		bson.M{"key": key, "value": old},
+		bson.M{"$set": bson.M{"key": key, "value": value}},
+		options.UpdateOne().SetUpsert(old == ""),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0 || result.UpsertedCount > 0, nil
+}
+
+func (s *mongoConfig) VoiceMenu(ctx context.Context) (*VoiceMenu, error) {
+	config, err := findOne[struct {
+		Value *VoiceMenu `bson:"value"`
+	}](ctx, s.col, bson.M{"key": voiceMenuKey})
+	if err != nil || config == nil {
+		return nil, err
+	}
+	return config.Value, nil
+}
+
+func (s *mongoConfig) SetVoiceMenu(ctx context.Context, menu *VoiceMenu) error {
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"key": voiceMenuKey},
+		bson.M{"$set": bson.M{"key": voiceMenuKey, "value": menu, "updated_at": time.Now()}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *mongoConfig) DeleteVoiceMenu(ctx context.Context) (bool, error) {
+	result, err := s.col.DeleteOne(ctx, bson.M{"key": voiceMenuKey})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+type mongoMessages struct {
+	col *mongo.Collection
+}
+
+func (s *mongoMessages) Insert(ctx context.Context, message Message) error {
+	_, err := s.col.InsertOne(ctx, message)
+	return err
+}
+
+func (s *mongoMessages) FindLast(ctx context.Context, threadID bson.ObjectID, kind string) (*Message, error) {
+	return findOne[Message](ctx, s.col,
+		bson.M{"thread_id": threadID, "kind": kind},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+}
+
+type mongoWebhookDeliveries struct {
+	col *mongo.Collection
+}
+
+func (s *mongoWebhookDeliveries) Insert(ctx context.Context, delivery WebhookDelivery) error {
+	_, err := s.col.InsertOne(ctx, delivery)
+	return err
+}
+
+func (s *mongoWebhookDeliveries) ClaimDue(ctx context.Context, now time.Time, leaseUntil time.Time) (*WebhookDelivery, error) {
+	return findOneAndUpdate[WebhookDelivery](ctx, s.col,
+		bson.M{"status": DeliveryStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": leaseUntil}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+	)
+}
+
+func (s *mongoWebhookDeliveries) RecordAttempt(ctx context.Context, delivery WebhookDelivery, attempt DeliveryAttempt) error {
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": delivery.ID},
+		bson.M{
+			"$set": bson.M{
+				"status":          delivery.Status,
+				"attempts":        delivery.Attempts,
+				"next_attempt_at": delivery.NextAttemptAt,
+				"last_error":      delivery.LastError,
+				"updated_at":      delivery.UpdatedAt,
+			},
+			"$push": bson.M{"history": attempt},
+		},
+	)
+	return err
+}
+
+type mongoEscalation struct {
+	col *mongo.Collection
+}
+
+func (s *mongoEscalation) Get(ctx context.Context) (*EscalationPolicy, error) {
+	return findOne[EscalationPolicy](ctx, s.col, bson.M{"name": DefaultEscalationPolicy})
+}
+
+func (s *mongoEscalation) Save(ctx context.Context, policy EscalationPolicy) (*EscalationPolicy, error) {
+	result, err := findOneAndUpdate[EscalationPolicy](ctx, s.col,
+		bson.M{"name": DefaultEscalationPolicy},
+		bson.M{"$set": bson.M{
+			"name":       DefaultEscalationPolicy,
+			"tiers":      policy.Tiers,
+			"updated_at": policy.UpdatedAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+	if err == nil && result == nil {
+		err = errors.New("upsert returned no document")
+	}
+	return result, err
+}
+
+func (s *mongoEscalation) Delete(ctx context.Context) (bool, error) {
+	result, err := s.col.DeleteOne(ctx, bson.M{"name": DefaultEscalationPolicy})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// mongoMigration is a one-off change to existing data. Applied versions are
+// recorded in the schema_migrations collection so each runs once.
+type mongoMigration struct {
+	version string
+	apply   func(ctx context.Context, db *mongo.Database) error
+}
+
+// mongoMigrations run in order, before the indexes are created.
+var mongoMigrations = []mongoMigration{
+	{version: "0001_close_duplicate_active_threads", apply: closeDuplicateActiveThreads},
+	{version: "0002_remove_duplicate_blocks", apply: removeDuplicateBlocks},
+}
+
+// mongoUniqueIndexes enforce the uniqueness the handlers rely on. The
+// active thread index allows one active thread per reporter, so concurrent
+// messages cannot open two; openThread relies on it.
+var mongoUniqueIndexes = map[string][]mongo.IndexModel{
+	"threads": {
+		{
+			Keys: bson.D{{Key: "phone_number", Value: 1}},
+			Options: options.Index().SetName("phone_number_active_unique").SetUnique(true).SetPartialFilterExpression(bson.M{
+				"status": bson.M{"$in": ActiveThreadStatuses},
+			}),
+		},
+	},
+	"staff": {
+		{Keys: bson.D{{Key: "phone_number", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"blocklist": {
+		{Keys: bson.D{{Key: "phone_number", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"config": {
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"escalation_policies": {
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+}
+
+// mongoIndexes are the other indexes each collection needs for the lookups
+// the store makes.
+var mongoIndexes = map[string][]mongo.IndexModel{
+	"staff": {
+		{Keys: bson.D{{Key: "id", Value: 1}}},
+	},
+	"threads": {
+		{Keys: bson.D{{Key: "phone_number", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "code", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "last_activity_at", Value: 1}}},
+		{Keys: bson.D{{Key: "next_escalation_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "group_alert_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	},
+	"blocklist": {
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	},
+	"schedules": {
+		{Keys: bson.D{{Key: "phone_number", Value: 1}}},
+	},
+	"messages": {
+		{Keys: bson.D{{Key: "thread_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"webhook_deliveries": {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+	},
+}
+
+// EnsureMongoSchema applies pending data migrations and creates any missing
+// indexes. It is safe to run on every start. It fails if the migrations or
+// a unique index fail, for example because existing data has two staff with
+// one phone number, since the store would otherwise let duplicates in. Any
+// other index that cannot be built is logged without stopping the others.
+func EnsureMongoSchema(ctx context.Context, client *mongo.Client, databaseName string) error {
+	db := client.Database(databaseName)
+
+	if err := migrateMongo(ctx, db); err != nil {
+		return err
+	}
+
+	for collection, indexes := range mongoUniqueIndexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			return fmt.Errorf("error creating %s unique indexes in %s: %w", collection, databaseName, err)
+		}
+	}
+
+	for collection, indexes := range mongoIndexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			log.Printf("Error creating %s indexes in %s: %v", collection, databaseName, err)
+		}
+	}
+	return nil
+}
+
+func migrateMongo(ctx context.Context, db *mongo.Database) error {
+	col := db.Collection("schema_migrations")
+
+	for _, migration := range mongoMigrations {
+		applied, err := col.CountDocuments(ctx, bson.M{"_id": migration.version})
+		if err != nil {
+			return fmt.Errorf("error reading schema_migrations: %w", err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		if err := migration.apply(ctx, db); err != nil {
+			return fmt.Errorf("error applying migration %s: %w", migration.version, err)
+		}
+
+		if _, err := col.InsertOne(ctx, bson.M{"_id": migration.version, "applied_at": time.Now()}); err != nil {
+			return fmt.Errorf("error recording migration %s: %w", migration.version, err)
+		}
+		log.Printf("Applied migration %s to %s", migration.version, db.Name())
+	}
+
+	return nil
+}
+
+// closeDuplicateActiveThreads closes all but the newest active thread of
+// each reporter, which the unique active thread index requires.
+func closeDuplicateActiveThreads(ctx context.Context, db *mongo.Database) error {
+	threads := db.Collection("threads")
+
+	cursor, err := threads.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$in": ActiveThreadStatuses}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$phone_number", "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		IDs []bson.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, duplicate := range duplicates {
+		_, err := threads.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": duplicate.IDs[1:]}},
+			bson.M{
+				"$set": bson.M{
+					"status":     ThreadStatusClosed,
+					"updated_at": now,
+					"closed_at":  now,
+					"closed_by":  migrationActor,
+				},
+				"$push": bson.M{"transitions": ThreadTransition{Status: ThreadStatusClosed, At: now, By: migrationActor}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(duplicates) > 0 {
+		log.Printf("Closed duplicate active threads for %d phone numbers", len(duplicates))
+	}
+	return nil
+}
+
+// removeDuplicateBlocks keeps only the newest blocklist entry of each phone
+// number, which the unique blocklist index requires.
+func removeDuplicateBlocks(ctx context.Context, db *mongo.Database) error {
+	blocklist := db.Collection("blocklist")
+
+	cursor, err := blocklist.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$phone_number", "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		IDs []bson.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		if _, err := blocklist.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicate.IDs[1:]}}); err != nil {
+			return err
+		}
+	}
+
+	if len(duplicates) > 0 {
+		log.Printf("Removed duplicate blocklist entries for %d phone numbers", len(duplicates))
+	}
+	return nil
+}
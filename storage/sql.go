@@ -0,0 +1,1153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlMigrations are applied in file name order. Each file may hold several
+// statements separated by semicolons, and must run on both SQLite and
+// Postgres.
+//
+//go:embed migrations/*.sql
+var sqlMigrations embed.FS
+
+// sqlDataMigrations are run in Go inside the transaction of the migration
+// with the same version, before its script, for changes the SQL cannot make
+// on both databases.
+var sqlDataMigrations = map[string]func(ctx context.Context, db *sqlDB, tx *sql.Tx) error{
+	"0002_unique_active_threads": closeDuplicateActiveSQLThreads,
+}
+
+// sqlClaimAttempts limits how often a claim is retried when another request
+// changes the same row between the read and the write.
+const sqlClaimAttempts = 10
+
+// IsSQLDatabaseURL reports whether a connection string names a SQLite or
+// Postgres database rather than MongoDB.
+func IsSQLDatabaseURL(databaseURL string) bool {
+	_, _, err := sqlDriver(databaseURL)
+	return err == nil
+}
+
+// sqlDriver returns the database/sql driver and data source name for a
+// sqlite:// or postgres:// connection string.
+func sqlDriver(databaseURL string) (driverName string, dataSourceName string, err error) {
+	switch {
+	case strings.HasPrefix(databaseURL, "sqlite:"):
+		file := strings.TrimPrefix(strings.TrimPrefix(databaseURL, "sqlite:"), "//")
+		if file == "" {
+			return "", "", errors.New("sqlite connection string has no file, e.g. sqlite:///var/lib/dispatch-relay/relay.db")
+		}
+		return "sqlite", "file:" + file + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", nil
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		return "pgx", databaseURL, nil
+	}
+	return "", "", errors.New("unsupported database URL, must start with sqlite: or postgres://")
+}
+
+// SQLTestDatabaseURL returns the database for ?test requests next to the
+// one named by databaseURL: a sibling SQLite file, or the dispatch_relay_test
+// schema of the same Postgres database.
+func SQLTestDatabaseURL(databaseURL string) (string, error) {
+	if strings.HasPrefix(databaseURL, "sqlite:") {
+		ext := path.Ext(databaseURL)
+		return strings.TrimSuffix(databaseURL, ext) + "_test" + ext, nil
+	}
+
+	parsed, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	query.Set("search_path", "dispatch_relay_test")
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// OpenSQLStore connects to the SQLite or Postgres database named by
+// databaseURL, applies any pending migrations and returns a store backed by
+// it. The database should be closed on shutdown.
+func OpenSQLStore(ctx context.Context, databaseURL string) (Store, *sql.DB, error) {
+	driverName, dataSourceName, err := sqlDriver(databaseURL)
+	if err != nil {
+		return Store{}, nil, err
+	}
+
+	conn, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return Store{}, nil, err
+	}
+
+	db := &sqlDB{DB: conn, postgres: driverName == "pgx"}
+	if !db.postgres {
+		// SQLite allows one writer at a time. A single connection queues
+		// writes here instead of failing them with SQLITE_BUSY.
+		conn.SetMaxOpenConns(1)
+	}
+
+	if err := db.prepareSchema(ctx, databaseURL); err != nil {
+		conn.Close()
+		return Store{}, nil, err
+	}
+
+	if err := db.migrate(ctx); err != nil {
+		conn.Close()
+		return Store{}, nil, err
+	}
+
+	return newSQLStore(db), conn, nil
+}
+
+func newSQLStore(db *sqlDB) Store {
+	return Store{
+		Staff:             &sqlStaff{db},
+		Threads:           &sqlThreads{db},
+		BlockList:         &sqlBlockList{db},
+		Schedules:         &sqlSchedules{db},
+		Config:            &sqlConfig{db},
+		Messages:          &sqlMessages{db},
+		WebhookDeliveries: &sqlWebhookDeliveries{db},
+		Escalation:        &sqlEscalation{db},
+	}
+}
+
+// sqlDB runs queries written with ? placeholders on SQLite or Postgres.
+type sqlDB struct {
+	*sql.DB
+	postgres bool
+}
+
+// rebind rewrites ? placeholders to Postgres' $1, $2, ...
+func (db *sqlDB) rebind(query string) string {
+	if !db.postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// exec runs a statement and returns the number of rows it changed.
+func (db *sqlDB) exec(ctx context.Context, query string, args ...any) (int64, error) {
+	result, err := db.ExecContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (db *sqlDB) count(ctx context.Context, query string, args ...any) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, db.rebind(query), args...).Scan(&n)
+	return n, err
+}
+
+// prepareSchema creates the Postgres schema named by the search_path of the
+// connection string, so that the test database needs no manual setup.
+func (db *sqlDB) prepareSchema(ctx context.Context, databaseURL string) error {
+	if !db.postgres {
+		return nil
+	}
+
+	parsed, err := url.Parse(databaseURL)
+	if err != nil {
+		return err
+	}
+	schema, _, _ := strings.Cut(parsed.Query().Get("search_path"), ",")
+	if schema = strings.TrimSpace(schema); schema == "" {
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{schema}.Sanitize())
+	return err
+}
+
+// migrate applies the embedded migrations that are not yet recorded in
+// schema_migrations, each in its own transaction.
+func (db *sqlDB) migrate(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	files, err := fs.Glob(sqlMigrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := strings.TrimSuffix(path.Base(file), ".sql")
+
+		applied, err := db.count(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?", version)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := sqlMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if err := db.applyMigration(ctx, version, string(script)); err != nil {
+			return fmt.Errorf("error applying migration %s: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *sqlDB) applyMigration(ctx context.Context, version string, script string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if migrate, ok := sqlDataMigrations[version]; ok {
+		if err := migrate(ctx, db, tx); err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range strings.Split(script, ";") {
+		if strings.TrimSpace(stripSQLComments(statement)) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, db.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"), version, time.Now().UnixMilli()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// closeDuplicateActiveSQLThreads closes all but the newest active thread of
+// each reporter, which the unique active thread index requires. Like the
+// MongoDB migration it records who closed them and why.
+func closeDuplicateActiveSQLThreads(ctx context.Context, db *sqlDB, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, db.rebind(`SELECT id, transitions FROM threads
+		WHERE status IN (?, ?)
+		AND EXISTS (
+			SELECT 1 FROM threads newer
+			WHERE newer.phone_number = threads.phone_number
+			AND newer.status IN (?, ?)
+			AND (newer.created_at > threads.created_at OR (newer.created_at = threads.created_at AND newer.id > threads.id))
+		)`), ThreadStatusOpen, ThreadStatusAcknowledged, ThreadStatusOpen, ThreadStatusAcknowledged)
+	if err != nil {
+		return err
+	}
+
+	var duplicates []Thread
+	for rows.Next() {
+		var thread Thread
+		if err := rows.Scan(sqlID{&thread.ID}, sqlJSON[[]ThreadTransition]{&thread.Transitions}); err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates = append(duplicates, thread)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, thread := range duplicates {
+		transitions := append(thread.Transitions, ThreadTransition{Status: ThreadStatusClosed, At: now, By: migrationActor})
+		_, err := tx.ExecContext(ctx, db.rebind("UPDATE threads SET status = ?, updated_at = ?, closed_at = ?, closed_by = ?, transitions = ? WHERE id = ?"),
+			ThreadStatusClosed, sqlTime{&now}, sqlTime{&now}, migrationActor, sqlJSON[[]ThreadTransition]{&transitions}, sqlID{&thread.ID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripSQLComments removes -- comments from a migration statement.
+func stripSQLComments(statement string) string {
+	lines := strings.Split(statement, "\n")
+	for i, line := range lines {
+		if before, _, found := strings.Cut(line, "--"); found {
+			lines[i] = before
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// sqlFindOne scans the first row of a query, or returns nil if there is
+// none.
+func sqlFindOne[T any](ctx context.Context, db *sqlDB, scan func(rowScanner) (T, error), query string, args ...any) (*T, error) {
+	doc, err := scan(db.QueryRowContext(ctx, db.rebind(query), args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// sqlFindAll scans every row of a query.
+func sqlFindAll[T any](ctx context.Context, db *sqlDB, scan func(rowScanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []T{}
+	for rows.Next() {
+		doc, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// placeholders returns "?, ?, ..." for n values.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// anySlice converts values for use as query arguments.
+func anySlice[T any](values []T) []any {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// sqlDuplicateErr maps unique constraint violations to ErrDuplicate.
+func sqlDuplicateErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) && (liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY) {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+
+	return err
+}
+
+// sqlID stores an ObjectID as hex, and the zero ID as "".
+type sqlID struct {
+	id *bson.ObjectID
+}
+
+func (v sqlID) Value() (driver.Value, error) {
+	if v.id.IsZero() {
+		return "", nil
+	}
+	return v.id.Hex(), nil
+}
+
+func (v sqlID) Scan(src any) error {
+	s, err := sqlString(src)
+	if err != nil || s == "" {
+		*v.id = bson.ObjectID{}
+		return err
+	}
+	*v.id, err = bson.ObjectIDFromHex(s)
+	return err
+}
+
+// sqlNullID stores an optional ObjectID, with nil as NULL.
+type sqlNullID struct {
+	id **bson.ObjectID
+}
+
+func (v sqlNullID) Value() (driver.Value, error) {
+	if *v.id == nil {
+		return nil, nil
+	}
+	return (*v.id).Hex(), nil
+}
+
+func (v sqlNullID) Scan(src any) error {
+	if src == nil {
+		*v.id = nil
+		return nil
+	}
+	id := new(bson.ObjectID)
+	if err := (sqlID{id}).Scan(src); err != nil {
+		return err
+	}
+	*v.id = id
+	return nil
+}
+
+// sqlTime stores a time as Unix milliseconds, the precision MongoDB keeps.
+type sqlTime struct {
+	t *time.Time
+}
+
+func (v sqlTime) Value() (driver.Value, error) {
+	return v.t.UnixMilli(), nil
+}
+
+func (v sqlTime) Scan(src any) error {
+	ms, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("cannot read %T as a time", src)
+	}
+	*v.t = time.UnixMilli(ms).UTC()
+	return nil
+}
+
+// sqlNullTime stores an optional time, with nil as NULL.
+type sqlNullTime struct {
+	t **time.Time
+}
+
+func (v sqlNullTime) Value() (driver.Value, error) {
+	if *v.t == nil {
+		return nil, nil
+	}
+	return (*v.t).UnixMilli(), nil
+}
+
+func (v sqlNullTime) Scan(src any) error {
+	if src == nil {
+		*v.t = nil
+		return nil
+	}
+	t := new(time.Time)
+	if err := (sqlTime{t}).Scan(src); err != nil {
+		return err
+	}
+	*v.t = t
+	return nil
+}
+
+// sqlJSON stores a value as JSON text.
+type sqlJSON[T any] struct {
+	v *T
+}
+
+func (v sqlJSON[T]) Value() (driver.Value, error) {
+	data, err := json.Marshal(*v.v)
+	return string(data), err
+}
+
+func (v sqlJSON[T]) Scan(src any) error {
+	s, err := sqlString(src)
+	if err != nil {
+		return err
+	}
+	var value T
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		return err
+	}
+	*v.v = value
+	return nil
+}
+
+func sqlString(src any) (string, error) {
+	switch s := src.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("cannot read %T as text", src)
+}
+
+type sqlStaff struct {
+	db *sqlDB
+}
+
+const staffColumns = "id, public_id, phone_number, active, email, last_alerted_at, channels"
+
+func scanStaff(row rowScanner) (Staff, error) {
+	var s Staff
+	err := row.Scan(sqlID{&s.ID}, &s.PublicID, &s.PhoneNumber, &s.Active, &s.Email, sqlNullTime{&s.LastAlertedAt}, sqlJSON[[]string]{&s.Channels})
+	return s, err
+}
+
+func (s *sqlStaff) List(ctx context.Context) ([]Staff, error) {
+	return sqlFindAll(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff ORDER BY phone_number")
+}
+
+func (s *sqlStaff) ListActive(ctx context.Context) ([]Staff, error) {
+	return sqlFindAll(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff WHERE active = ?", true)
+}
+
+func (s *sqlStaff) ListWithoutPublicID(ctx context.Context) ([]Staff, error) {
+	return sqlFindAll(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff WHERE public_id = ''")
+}
+
+func (s *sqlStaff) FindByPhoneNumber(ctx context.Context, phoneNumber string) (*Staff, error) {
+	return sqlFindOne(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff WHERE phone_number = ?", phoneNumber)
+}
+
+func (s *sqlStaff) FindByPhoneNumbers(ctx context.Context, phoneNumbers []string) ([]Staff, error) {
+	if len(phoneNumbers) == 0 {
+		return []Staff{}, nil
+	}
+	return sqlFindAll(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff WHERE phone_number IN ("+placeholders(len(phoneNumbers))+")", anySlice(phoneNumbers)...)
+}
+
+func (s *sqlStaff) FindByPublicID(ctx context.Context, publicID string) (*Staff, error) {
+	return sqlFindOne(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff WHERE public_id = ?", publicID)
+}
+
+func (s *sqlStaff) FindByPublicIDs(ctx context.Context, publicIDs []string) ([]Staff, error) {
+	if len(publicIDs) == 0 {
+		return []Staff{}, nil
+	}
+	return sqlFindAll(ctx, s.db, scanStaff, "SELECT "+staffColumns+" FROM staff WHERE public_id IN ("+placeholders(len(publicIDs))+")", anySlice(publicIDs)...)
+}
+
+func (s *sqlStaff) PhoneNumberTaken(ctx context.Context, phoneNumber string, exceptID bson.ObjectID) (bool, error) {
+	n, err := s.db.count(ctx, "SELECT COUNT(*) FROM staff WHERE phone_number = ? AND id <> ?", phoneNumber, sqlID{&exceptID})
+	return n > 0, err
+}
+
+func (s *sqlStaff) Insert(ctx context.Context, staff Staff) error {
+	if staff.ID.IsZero() {
+		staff.ID = bson.NewObjectID()
+	}
+
+	_, err := s.db.exec(ctx, "INSERT INTO staff ("+staffColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sqlID{&staff.ID}, staff.PublicID, staff.PhoneNumber, staff.Active, staff.Email, sqlNullTime{&staff.LastAlertedAt}, sqlJSON[[]string]{&staff.Channels})
+	return sqlDuplicateErr(err)
+}
+
+func (s *sqlStaff) Update(ctx context.Context, staff Staff) error {
+	_, err := s.db.exec(ctx, "UPDATE staff SET phone_number = ?, active = ?, email = ?, channels = ? WHERE id = ?",
+		staff.PhoneNumber, staff.Active, staff.Email, sqlJSON[[]string]{&staff.Channels}, sqlID{&staff.ID})
+	return sqlDuplicateErr(err)
+}
+
+func (s *sqlStaff) SetActive(ctx context.Context, id bson.ObjectID, active bool) error {
+	_, err := s.db.exec(ctx, "UPDATE staff SET active = ? WHERE id = ?", active, sqlID{&id})
+	return err
+}
+
+func (s *sqlStaff) SetPublicID(ctx context.Context, id bson.ObjectID, publicID string) error {
+	_, err := s.db.exec(ctx, "UPDATE staff SET public_id = ? WHERE id = ?", publicID, sqlID{&id})
+	return err
+}
+
+func (s *sqlStaff) MarkAlerted(ctx context.Context, ids []bson.ObjectID, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []any{sqlTime{&at}}
+	for i := range ids {
+		args = append(args, sqlID{&ids[i]})
+	}
+
+	_, err := s.db.exec(ctx, "UPDATE staff SET last_alerted_at = ? WHERE id IN ("+placeholders(len(ids))+")", args...)
+	return err
+}
+
+func (s *sqlStaff) Delete(ctx context.Context, publicID string) (bool, error) {
+	n, err := s.db.exec(ctx, "DELETE FROM staff WHERE public_id = ?", publicID)
+	return n > 0, err
+}
+
+type sqlThreads struct {
+	db *sqlDB
+}
+
+const threadColumns = "id, phone_number, code, status, created_at, updated_at, last_activity_at, acknowledged_at, acknowledged_by, " +
+	"closed_at, closed_by, previous_thread_id, transitions, escalation_tier, next_escalation_at, assigned_to, group_alert_at, voicemails"
+
+// threadValues returns the columns of threadColumns for a thread.
+func threadValues(t *Thread) []any {
+	return []any{
+		sqlID{&t.ID}, t.PhoneNumber, t.Code, t.Status, sqlTime{&t.CreatedAt}, sqlTime{&t.UpdatedAt}, sqlTime{&t.LastActivityAt},
+		sqlNullTime{&t.AcknowledgedAt}, t.AcknowledgedBy, sqlNullTime{&t.ClosedAt}, t.ClosedBy, sqlNullID{&t.PreviousThreadID},
+		sqlJSON[[]ThreadTransition]{&t.Transitions}, t.EscalationTier, sqlNullTime{&t.NextEscalationAt}, t.AssignedTo,
+		sqlNullTime{&t.GroupAlertAt}, sqlJSON[[]Voicemail]{&t.Voicemails},
+	}
+}
+
+func scanThread(row rowScanner) (Thread, error) {
+	var t Thread
+	err := row.Scan(
+		sqlID{&t.ID}, &t.PhoneNumber, &t.Code, &t.Status, sqlTime{&t.CreatedAt}, sqlTime{&t.UpdatedAt}, sqlTime{&t.LastActivityAt},
+		sqlNullTime{&t.AcknowledgedAt}, &t.AcknowledgedBy, sqlNullTime{&t.ClosedAt}, &t.ClosedBy, sqlNullID{&t.PreviousThreadID},
+		sqlJSON[[]ThreadTransition]{&t.Transitions}, &t.EscalationTier, sqlNullTime{&t.NextEscalationAt}, &t.AssignedTo,
+		sqlNullTime{&t.GroupAlertAt}, sqlJSON[[]Voicemail]{&t.Voicemails},
+	)
+	return t, err
+}
+
+func (s *sqlThreads) FindByID(ctx context.Context, id bson.ObjectID) (*Thread, error) {
+	return sqlFindOne(ctx, s.db, scanThread, "SELECT "+threadColumns+" FROM threads WHERE id = ?", sqlID{&id})
+}
+
+func (s *sqlThreads) FindActiveByPhoneNumber(ctx context.Context, phoneNumber string) (*Thread, error) {
+	return sqlFindOne(ctx, s.db, scanThread, "SELECT "+threadColumns+" FROM threads WHERE phone_number = ? AND status IN (?, ?)",
+		phoneNumber, ThreadStatusOpen, ThreadStatusAcknowledged)
+}
+
+func (s *sqlThreads) FindActiveByCode(ctx context.Context, code string) (*Thread, error) {
+	return sqlFindOne(ctx, s.db, scanThread, "SELECT "+threadColumns+" FROM threads WHERE code = ? AND status IN (?, ?)",
+		code, ThreadStatusOpen, ThreadStatusAcknowledged)
+}
+
+func (s *sqlThreads) FindLastClosed(ctx context.Context, phoneNumber string) (*Thread, error) {
+	return sqlFindOne(ctx, s.db, scanThread, "SELECT "+threadColumns+" FROM threads WHERE phone_number = ? AND status = ? ORDER BY created_at DESC LIMIT 1",
+		phoneNumber, ThreadStatusClosed)
+}
+
+func (s *sqlThreads) ListActive(ctx context.Context) ([]Thread, error) {
+	return sqlFindAll(ctx, s.db, scanThread, "SELECT "+threadColumns+" FROM threads WHERE status IN (?, ?) ORDER BY created_at",
+		ThreadStatusOpen, ThreadStatusAcknowledged)
+}
+
+func (s *sqlThreads) Insert(ctx context.Context, thread Thread) error {
+	_, err := s.db.exec(ctx, "INSERT INTO threads ("+threadColumns+") VALUES ("+placeholders(18)+")", threadValues(&thread)...)
+	return sqlDuplicateErr(err)
+}
+
+func (s *sqlThreads) SetCode(ctx context.Context, id bson.ObjectID, code string) error {
+	_, err := s.db.exec(ctx, "UPDATE threads SET code = ? WHERE id = ?", code, sqlID{&id})
+	return err
+}
+
+func (s *sqlThreads) Touch(ctx context.Context, id bson.ObjectID, now time.Time) error {
+	_, err := s.db.exec(ctx, "UPDATE threads SET last_activity_at = ?, updated_at = ? WHERE id = ?", sqlTime{&now}, sqlTime{&now}, sqlID{&id})
+	return err
+}
+
+// claim applies change to one thread matching where and returns the thread
+// as it was before and after. The write is conditional on where still
+// matching, so two requests cannot claim the same thread; a request that
+// loses the race moves on to the next match.
+func (s *sqlThreads) claim(ctx context.Context, where string, args []any, change func(*Thread)) (before *Thread, after *Thread, err error) {
+	for range sqlClaimAttempts {
+		thread, err := sqlFindOne(ctx, s.db, scanThread, "SELECT "+threadColumns+" FROM threads WHERE "+where+" LIMIT 1", args...)
+		if err != nil || thread == nil {
+			return nil, nil, err
+		}
+
+		updated := *thread
+		updated.Transitions = slices.Clone(thread.Transitions)
+		change(&updated)
+
+		n, err := s.db.exec(ctx, `UPDATE threads SET status = ?, updated_at = ?, acknowledged_at = ?, acknowledged_by = ?, closed_at = ?,
+			closed_by = ?, transitions = ?, next_escalation_at = ?, group_alert_at = ? WHERE id = ? AND `+where,
+			append([]any{
+				updated.Status, sqlTime{&updated.UpdatedAt}, sqlNullTime{&updated.AcknowledgedAt}, updated.AcknowledgedBy,
+				sqlNullTime{&updated.ClosedAt}, updated.ClosedBy, sqlJSON[[]ThreadTransition]{&updated.Transitions},
+				sqlNullTime{&updated.NextEscalationAt}, sqlNullTime{&updated.GroupAlertAt}, sqlID{&thread.ID},
+			}, args...)...)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n > 0 {
+			return thread, &updated, nil
+		}
+	}
+	return nil, nil, errors.New("thread claim kept conflicting with other updates")
+}
+
+func (s *sqlThreads) Transition(ctx context.Context, id bson.ObjectID, from []string, to string, by string, now time.Time) (*Thread, error) {
+	if len(from) == 0 {
+		return nil, nil
+	}
+
+	_, after, err := s.claim(ctx, "id = ? AND status IN ("+placeholders(len(from))+")",
+		append([]any{sqlID{&id}}, anySlice(from)...),
+		func(t *Thread) { applyTransition(t, to, by, now) },
+	)
+	return after, err
+}
+
+func (s *sqlThreads) CloseInactive(ctx context.Context, cutoff time.Time, by string, now time.Time) (*Thread, error) {
+	_, after, err := s.claim(ctx, "status IN (?, ?) AND last_activity_at < ?",
+		[]any{ThreadStatusOpen, ThreadStatusAcknowledged, sqlTime{&cutoff}},
+		func(t *Thread) { applyTransition(t, ThreadStatusClosed, by, now) },
+	)
+	return after, err
+}
+
+func (s *sqlThreads) SetEscalation(ctx context.Context, id bson.ObjectID, tier int, next *time.Time) error {
+	_, err := s.db.exec(ctx, "UPDATE threads SET escalation_tier = ?, next_escalation_at = ? WHERE id = ?", tier, sqlNullTime{&next}, sqlID{&id})
+	return err
+}
+
+func (s *sqlThreads) ClaimDueEscalation(ctx context.Context, now time.Time) (*Thread, error) {
+	before, _, err := s.claim(ctx, "status = ? AND next_escalation_at <= ?",
+		[]any{ThreadStatusOpen, sqlTime{&now}},
+		func(t *Thread) { t.NextEscalationAt = nil },
+	)
+	return before, err
+}
+
+func (s *sqlThreads) Assign(ctx context.Context, id bson.ObjectID, publicID string, groupAlertAt time.Time) error {
+	_, err := s.db.exec(ctx, "UPDATE threads SET assigned_to = ?, group_alert_at = ? WHERE id = ?", publicID, sqlTime{&groupAlertAt}, sqlID{&id})
+	return err
+}
+
+func (s *sqlThreads) ClaimDueGroupAlert(ctx context.Context, now time.Time) (*Thread, error) {
+	_, after, err := s.claim(ctx, "status = ? AND group_alert_at <= ?",
+		[]any{ThreadStatusOpen, sqlTime{&now}},
+		func(t *Thread) { t.GroupAlertAt = nil },
+	)
+	return after, err
+}
+
+// updateVoicemails rewrites the voicemails of a thread. The write only
+// applies if the list is unchanged since it was read, and is retried
+// otherwise, since Twilio sends the recording and transcription callbacks
+// close together.
+func (s *sqlThreads) updateVoicemails(ctx context.Context, id bson.ObjectID, change func([]Voicemail) []Voicemail) error {
+	for range sqlClaimAttempts {
+		var raw string
+		err := s.db.QueryRowContext(ctx, s.db.rebind("SELECT voicemails FROM threads WHERE id = ?"), sqlID{&id}).Scan(&raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var voicemails []Voicemail
+		if err := json.Unmarshal([]byte(raw), &voicemails); err != nil {
+			return err
+		}
+		voicemails = change(voicemails)
+
+		n, err := s.db.exec(ctx, "UPDATE threads SET voicemails = ? WHERE id = ? AND voicemails = ?", sqlJSON[[]Voicemail]{&voicemails}, sqlID{&id}, raw)
+		if err != nil || n > 0 {
+			return err
+		}
+	}
+	return errors.New("voicemail update kept conflicting with other updates")
+}
+
+func (s *sqlThreads) SaveVoicemail(ctx context.Context, id bson.ObjectID, voicemail Voicemail) error {
+	return s.updateVoicemails(ctx, id, func(voicemails []Voicemail) []Voicemail {
+		if j := indexWhere(voicemails, func(v *Voicemail) bool { return v.RecordingSid == voicemail.RecordingSid }); j >= 0 {
+			voicemails[j].CallSid = voicemail.CallSid
+			voicemails[j].RecordingURL = voicemail.RecordingURL
+			voicemails[j].DurationSeconds = voicemail.DurationSeconds
+			return voicemails
+		}
+		return append(voicemails, voicemail)
+	})
+}
+
+func (s *sqlThreads) SaveTranscription(ctx context.Context, id bson.ObjectID, recordingSid string, status string, text string) error {
+	return s.updateVoicemails(ctx, id, func(voicemails []Voicemail) []Voicemail {
+		if j := indexWhere(voicemails, func(v *Voicemail) bool { return v.RecordingSid == recordingSid }); j >= 0 {
+			voicemails[j].TranscriptionStatus = status
+			voicemails[j].Transcription = text
+			return voicemails
+		}
+		return append(voicemails, Voicemail{
+			RecordingSid:        recordingSid,
+			TranscriptionStatus: status,
+			Transcription:       text,
+			CreatedAt:           time.Now(),
+		})
+	})
+}
+
+type sqlBlockList struct {
+	db *sqlDB
+}
+
+const blockedNumberColumns = "id, phone_number, created_at, reason, blocked_by, expires_at"
+
+func scanBlockedNumber(row rowScanner) (BlockedNumber, error) {
+	var b BlockedNumber
+	err := row.Scan(sqlID{&b.ID}, &b.PhoneNumber, sqlTime{&b.CreatedAt}, &b.Reason, &b.BlockedBy, sqlNullTime{&b.ExpiresAt})
+	return b, err
+}
+
+func (s *sqlBlockList) IsBlocked(ctx context.Context, phoneNumber string, now time.Time) (bool, error) {
+	n, err := s.db.count(ctx, "SELECT COUNT(*) FROM blocklist WHERE phone_number = ? AND (expires_at IS NULL OR expires_at > ?)",
+		phoneNumber, sqlTime{&now})
+	return n > 0, err
+}
+
+func (s *sqlBlockList) Upsert(ctx context.Context, blocked BlockedNumber) (*BlockedNumber, error) {
+	if blocked.ID.IsZero() {
+		blocked.ID = bson.NewObjectID()
+	}
+
+	_, err := s.db.exec(ctx, `INSERT INTO blocklist (`+blockedNumberColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (phone_number) DO UPDATE SET created_at = excluded.created_at, reason = excluded.reason,
+		blocked_by = excluded.blocked_by, expires_at = excluded.expires_at`,
+		sqlID{&blocked.ID}, blocked.PhoneNumber, sqlTime{&blocked.CreatedAt}, blocked.Reason, blocked.BlockedBy, sqlNullTime{&blocked.ExpiresAt})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := sqlFindOne(ctx, s.db, scanBlockedNumber, "SELECT "+blockedNumberColumns+" FROM blocklist WHERE phone_number = ?", blocked.PhoneNumber)
+	if err == nil && result == nil {
+		err = errors.New("upsert returned no row")
+	}
+	return result, err
+}
+
+func (s *sqlBlockList) List(ctx context.Context, includeExpired bool, now time.Time, skip int64, limit int64) ([]BlockedNumber, int64, error) {
+	where := "1 = 1"
+	var args []any
+	if !includeExpired {
+		where = "(expires_at IS NULL OR expires_at > ?)"
+		args = append(args, sqlTime{&now})
+	}
+
+	total, err := s.db.count(ctx, "SELECT COUNT(*) FROM blocklist WHERE "+where, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, err := sqlFindAll(ctx, s.db, scanBlockedNumber,
+		"SELECT "+blockedNumberColumns+" FROM blocklist WHERE "+where+" ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		append(args, limit, skip)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *sqlBlockList) Delete(ctx context.Context, phoneNumber string) (bool, error) {
+	n, err := s.db.exec(ctx, "DELETE FROM blocklist WHERE phone_number = ?", phoneNumber)
+	return n > 0, err
+}
+
+type sqlSchedules struct {
+	db *sqlDB
+}
+
+const scheduleColumns = "id, uid, phone_number, start_time, end_time, day_of_week, recurring, always, date, timezone, tier"
+
+func scheduleValues(s *Schedule) []any {
+	return []any{sqlID{&s.ID}, s.UID, s.PhoneNumber, s.StartTime, s.EndTime, s.DayOfWeek, s.Recurring, s.Always, s.Date, s.Timezone, s.Tier}
+}
+
+func scanSchedule(row rowScanner) (Schedule, error) {
+	var s Schedule
+	err := row.Scan(sqlID{&s.ID}, &s.UID, &s.PhoneNumber, &s.StartTime, &s.EndTime, &s.DayOfWeek, &s.Recurring, &s.Always, &s.Date, &s.Timezone, &s.Tier)
+	return s, err
+}
+
+func (s *sqlSchedules) Count(ctx context.Context) (int64, error) {
+	return s.db.count(ctx, "SELECT COUNT(*) FROM schedules")
+}
+
+func (s *sqlSchedules) List(ctx context.Context, phoneNumber string) ([]Schedule, error) {
+	where := "1 = 1"
+	var args []any
+	if phoneNumber != "" {
+		where = "phone_number = ?"
+		args = append(args, phoneNumber)
+	}
+
+	return sqlFindAll(ctx, s.db, scanSchedule,
+		"SELECT "+scheduleColumns+" FROM schedules WHERE "+where+" ORDER BY phone_number, day_of_week, start_time", args...)
+}
+
+func (s *sqlSchedules) FindCandidates(ctx context.Context, daysOfWeek []int, dates []string) ([]Schedule, error) {
+	conditions := []string{"always = ?"}
+	args := []any{true}
+
+	if len(daysOfWeek) > 0 {
+		conditions = append(conditions, "(recurring = ? AND day_of_week IN ("+placeholders(len(daysOfWeek))+"))")
+		args = append(append(args, true), anySlice(daysOfWeek)...)
+	}
+	if len(dates) > 0 {
+		conditions = append(conditions, "(recurring = ? AND date IN ("+placeholders(len(dates))+"))")
+		args = append(append(args, false), anySlice(dates)...)
+	}
+
+	return sqlFindAll(ctx, s.db, scanSchedule, "SELECT "+scheduleColumns+" FROM schedules WHERE "+strings.Join(conditions, " OR "), args...)
+}
+
+func (s *sqlSchedules) FindByID(ctx context.Context, id bson.ObjectID) (*Schedule, error) {
+	return sqlFindOne(ctx, s.db, scanSchedule, "SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", sqlID{&id})
+}
+
+func (s *sqlSchedules) Insert(ctx context.Context, schedule Schedule) error {
+	if schedule.ID.IsZero() {
+		schedule.ID = bson.NewObjectID()
+	}
+
+	_, err := s.db.exec(ctx, "INSERT INTO schedules ("+scheduleColumns+") VALUES ("+placeholders(11)+")", scheduleValues(&schedule)...)
+	return err
+}
+
+func (s *sqlSchedules) Replace(ctx context.Context, schedule Schedule) (bool, error) {
+	n, err := s.db.exec(ctx, `UPDATE schedules SET uid = ?, phone_number = ?, start_time = ?, end_time = ?, day_of_week = ?,
+		recurring = ?, always = ?, date = ?, timezone = ?, tier = ? WHERE id = ?`,
+		append(scheduleValues(&schedule)[1:], sqlID{&schedule.ID})...)
+	return n > 0, err
+}
+
+func (s *sqlSchedules) Delete(ctx context.Context, id bson.ObjectID) (bool, error) {
+	n, err := s.db.exec(ctx, "DELETE FROM schedules WHERE id = ?", sqlID{&id})
+	return n > 0, err
+}
+
+func (s *sqlSchedules) ChangePhoneNumber(ctx context.Context, from string, to string) error {
+	_, err := s.db.exec(ctx, "UPDATE schedules SET phone_number = ? WHERE phone_number = ?", to, from)
+	return err
+}
+
+func (s *sqlSchedules) DeleteByPhoneNumber(ctx context.Context, phoneNumber string) error {
+	_, err := s.db.exec(ctx, "DELETE FROM schedules WHERE phone_number = ?", phoneNumber)
+	return err
+}
+
+type sqlConfig struct {
+	db *sqlDB
+}
+
+func (s *sqlConfig) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, s.db.rebind("SELECT value FROM config WHERE key = ?"), key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *sqlConfig) Set(ctx context.Context, key string, value string) error {
+	now := time.Now()
+	_, err := s.db.exec(ctx, `INSERT INTO config (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, value, sqlTime{&now})
+	return err
+}
+
+func (s *sqlConfig) CompareAndSet(ctx context.Context, key string, old string, value string) (bool, error) {
+	now := time.Now()
+	if old == "" {
+		n, err := s.db.exec(ctx, `INSERT INTO config (key, value, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+			WHERE config.value = ''`,
+			key, value, sqlTime{&now})
+		return n > 0, err
+	}
+
+	n, err := s.db.exec(ctx, "UPDATE config SET value = ?, updated_at = ? WHERE key = ? AND value = ?",
+		value, sqlTime{&now}, key, old)
+	return n > 0, err
+}
+
+func (s *sqlConfig) VoiceMenu(ctx context.Context) (*VoiceMenu, error) {
+	value, err := s.Get(ctx, voiceMenuKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	var menu *VoiceMenu
+	if err := json.Unmarshal([]byte(value), &menu); err != nil {
+		return nil, err
+	}
+	return menu, nil
+}
+
+func (s *sqlConfig) SetVoiceMenu(ctx context.Context, menu *VoiceMenu) error {
+	value, err := json.Marshal(menu)
+	if err != nil {
+		return err
+	}
+	return s.Set(ctx, voiceMenuKey, string(value))
+}
+
+func (s *sqlConfig) DeleteVoiceMenu(ctx context.Context) (bool, error) {
+	n, err := s.db.exec(ctx, "DELETE FROM config WHERE key = ?", voiceMenuKey)
+	return n > 0, err
+}
+
+type sqlMessages struct {
+	db *sqlDB
+}
+
+const messageColumns = "id, thread_id, direction, channel, kind, from_number, to_numbers, body, message_sid, call_sid, status, deliveries, created_at"
+
+func scanMessage(row rowScanner) (Message, error) {
+	var m Message
+	err := row.Scan(sqlID{&m.ID}, sqlID{&m.ThreadID}, &m.Direction, &m.Channel, &m.Kind, &m.From, sqlJSON[[]string]{&m.To},
+		&m.Body, &m.MessageSid, &m.CallSid, &m.Status, sqlJSON[[]MessageDelivery]{&m.Deliveries}, sqlTime{&m.CreatedAt})
+	return m, err
+}
+
+func (s *sqlMessages) Insert(ctx context.Context, message Message) error {
+	if message.ID.IsZero() {
+		message.ID = bson.NewObjectID()
+	}
+
+	_, err := s.db.exec(ctx, "INSERT INTO messages ("+messageColumns+") VALUES ("+placeholders(13)+")",
+		sqlID{&message.ID}, sqlID{&message.ThreadID}, message.Direction, message.Channel, message.Kind, message.From,
+		sqlJSON[[]string]{&message.To}, message.Body, message.MessageSid, message.CallSid, message.Status,
+		sqlJSON[[]MessageDelivery]{&message.Deliveries}, sqlTime{&message.CreatedAt})
+	return err
+}
+
+func (s *sqlMessages) FindLast(ctx context.Context, threadID bson.ObjectID, kind string) (*Message, error) {
+	// ObjectIDs from one process increase, so the ID breaks ties between
+	// messages recorded in the same millisecond.
+	return sqlFindOne(ctx, s.db, scanMessage,
+		"SELECT "+messageColumns+" FROM messages WHERE thread_id = ? AND kind = ? ORDER BY created_at DESC, id DESC LIMIT 1",
+		sqlID{&threadID}, kind)
+}
+
+type sqlWebhookDeliveries struct {
+	db *sqlDB
+}
+
+const webhookDeliveryColumns = "id, event_id, event_type, url, payload, status, attempts, next_attempt_at, last_error, history, created_at, updated_at"
+
+func scanWebhookDelivery(row rowScanner) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(sqlID{&d.ID}, &d.EventID, &d.EventType, &d.URL, &d.Payload, &d.Status, &d.Attempts, sqlTime{&d.NextAttemptAt},
+		&d.LastError, sqlJSON[[]DeliveryAttempt]{&d.History}, sqlTime{&d.CreatedAt}, sqlTime{&d.UpdatedAt})
+	return d, err
+}
+
+func (s *sqlWebhookDeliveries) Insert(ctx context.Context, delivery WebhookDelivery) error {
+	_, err := s.db.exec(ctx, "INSERT INTO webhook_deliveries ("+webhookDeliveryColumns+") VALUES ("+placeholders(12)+")",
+		sqlID{&delivery.ID}, delivery.EventID, delivery.EventType, delivery.URL, delivery.Payload, delivery.Status, delivery.Attempts,
+		sqlTime{&delivery.NextAttemptAt}, delivery.LastError, sqlJSON[[]DeliveryAttempt]{&delivery.History},
+		sqlTime{&delivery.CreatedAt}, sqlTime{&delivery.UpdatedAt})
+	return err
+}
+
+func (s *sqlWebhookDeliveries) ClaimDue(ctx context.Context, now time.Time, leaseUntil time.Time) (*WebhookDelivery, error) {
+	for range sqlClaimAttempts {
+		delivery, err := sqlFindOne(ctx, s.db, scanWebhookDelivery,
+			"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT 1",
+			DeliveryStatusPending, sqlTime{&now})
+		if err != nil || delivery == nil {
+			return nil, err
+		}
+
+		n, err := s.db.exec(ctx, "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at <= ?",
+			sqlTime{&leaseUntil}, sqlID{&delivery.ID}, DeliveryStatusPending, sqlTime{&now})
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return delivery, nil
+		}
+	}
+	return nil, errors.New("webhook delivery claim kept conflicting with other updates")
+}
+
+func (s *sqlWebhookDeliveries) RecordAttempt(ctx context.Context, delivery WebhookDelivery, attempt DeliveryAttempt) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var history []DeliveryAttempt
+	err = tx.QueryRowContext(ctx, s.db.rebind("SELECT history FROM webhook_deliveries WHERE id = ?"), sqlID{&delivery.ID}).
+		Scan(sqlJSON[[]DeliveryAttempt]{&history})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	history = append(history, attempt)
+
+	_, err = tx.ExecContext(ctx, s.db.rebind(`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?,
+		updated_at = ?, history = ? WHERE id = ?`),
+		delivery.Status, delivery.Attempts, sqlTime{&delivery.NextAttemptAt}, delivery.LastError, sqlTime{&delivery.UpdatedAt},
+		sqlJSON[[]DeliveryAttempt]{&history}, sqlID{&delivery.ID})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlEscalation struct {
+	db *sqlDB
+}
+
+func scanEscalationPolicy(row rowScanner) (EscalationPolicy, error) {
+	var p EscalationPolicy
+	err := row.Scan(sqlID{&p.ID}, &p.Name, sqlJSON[[]EscalationTier]{&p.Tiers}, sqlTime{&p.UpdatedAt})
+	return p, err
+}
+
+func (s *sqlEscalation) Get(ctx context.Context) (*EscalationPolicy, error) {
+	return sqlFindOne(ctx, s.db, scanEscalationPolicy,
+		"SELECT id, name, tiers, updated_at FROM escalation_policies WHERE name = ?", DefaultEscalationPolicy)
+}
+
+func (s *sqlEscalation) Save(ctx context.Context, policy EscalationPolicy) (*EscalationPolicy, error) {
+	id := bson.NewObjectID()
+	_, err := s.db.exec(ctx, `INSERT INTO escalation_policies (id, name, tiers, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET tiers = excluded.tiers, updated_at = excluded.updated_at`,
+		sqlID{&id}, DefaultEscalationPolicy, sqlJSON[[]EscalationTier]{&policy.Tiers}, sqlTime{&policy.UpdatedAt})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.Get(ctx)
+	if err == nil && result == nil {
+		err = errors.New("upsert returned no row")
+	}
+	return result, err
+}
+
+func (s *sqlEscalation) Delete(ctx context.Context) (bool, error) {
+	n, err := s.db.exec(ctx, "DELETE FROM escalation_policies WHERE name = ?", DefaultEscalationPolicy)
+	return n > 0, err
+}
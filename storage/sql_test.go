@@ -0,0 +1,472 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestSQLDatabaseURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		sql     bool
+		testURL string
+	}{
+		{url: "mongodb://localhost:27017", sql: false},
+		{url: "mongodb+srv://cluster0.example.net", sql: false},
+		{url: "sqlite:///var/lib/relay/relay.db", sql: true, testURL: "sqlite:///var/lib/relay/relay_test.db"},
+		{url: "sqlite:relay.db", sql: true, testURL: "sqlite:relay_test.db"},
+		{url: "sqlite:", sql: false},
+		{url: "postgres://relay@db/relay?sslmode=disable", sql: true, testURL: "postgres://relay@db/relay?search_path=dispatch_relay_test&sslmode=disable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := IsSQLDatabaseURL(tt.url); got != tt.sql {
+				t.Fatalf("IsSQLDatabaseURL = %v, want %v", got, tt.sql)
+			}
+			if tt.testURL == "" {
+				return
+			}
+			got, err := SQLTestDatabaseURL(tt.url)
+			if err != nil || got != tt.testURL {
+				t.Errorf("SQLTestDatabaseURL = %q, %v, want %q", got, err, tt.testURL)
+			}
+		})
+	}
+}
+
+func TestSQLStoreReopens(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "relay.db")
+	ctx := context.Background()
+
+	store := newSQLiteStore(t, file)
+	if err := store.Config.Set(ctx, "inbound_number", testInboundNumber); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the database again must skip the migrations already applied
+	// and keep the data.
+	store = newSQLiteStore(t, file)
+	got, err := store.Config.Get(ctx, "inbound_number")
+	if err != nil || got != testInboundNumber {
+		t.Errorf("inbound_number = %q, %v, want %q", got, err, testInboundNumber)
+	}
+}
+
+func TestStoreStaff(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		alice := addStaff(t, store, "+15105550101", true)
+		addStaff(t, store, "+15105550102", false)
+
+		err := store.Staff.Insert(ctx, Staff{ID: bson.NewObjectID(), PhoneNumber: alice.PhoneNumber})
+		if !errors.Is(err, ErrDuplicate) {
+			t.Errorf("duplicate Insert = %v, want ErrDuplicate", err)
+		}
+
+		active, err := store.Staff.ListActive(ctx)
+		if err != nil || len(active) != 1 || active[0].PhoneNumber != alice.PhoneNumber {
+			t.Fatalf("ListActive = %+v, %v, want only alice", active, err)
+		}
+
+		alice.Channels = []string{"SMS", "EMAIL"}
+		alice.Email = "alice@example.org"
+		if err := store.Staff.Update(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now().Truncate(time.Millisecond)
+		if err := store.Staff.MarkAlerted(ctx, []bson.ObjectID{alice.ID}, now); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Staff.FindByPublicID(ctx, alice.PublicID)
+		if err != nil || got == nil {
+			t.Fatalf("FindByPublicID = %v, %v", got, err)
+		}
+		if len(got.Channels) != 2 || got.Email != alice.Email || got.LastAlertedAt == nil || !got.LastAlertedAt.Equal(now) {
+			t.Errorf("staff = %+v, want channels, email and alert time saved", got)
+		}
+
+		taken, err := store.Staff.PhoneNumberTaken(ctx, alice.PhoneNumber, alice.ID)
+		if err != nil || taken {
+			t.Errorf("PhoneNumberTaken by self = %v, %v, want false", taken, err)
+		}
+		taken, err = store.Staff.PhoneNumberTaken(ctx, alice.PhoneNumber, bson.ObjectID{})
+		if err != nil || !taken {
+			t.Errorf("PhoneNumberTaken = %v, %v, want true", taken, err)
+		}
+
+		missing, err := store.Staff.FindByPhoneNumber(ctx, "+15105550199")
+		if err != nil || missing != nil {
+			t.Errorf("FindByPhoneNumber of unknown number = %v, %v, want nil", missing, err)
+		}
+
+		deleted, err := store.Staff.Delete(ctx, alice.PublicID)
+		if err != nil || !deleted {
+			t.Errorf("Delete = %v, %v, want true", deleted, err)
+		}
+	})
+}
+
+func TestStoreThreads(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		thread := addThread(t, store, "+14155550123", "AB12")
+		now := time.Now().Truncate(time.Millisecond)
+
+		duplicate := thread
+		duplicate.ID = bson.NewObjectID()
+		if err := store.Threads.Insert(ctx, duplicate); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("second active thread Insert = %v, want ErrDuplicate", err)
+		}
+
+		found, err := store.Threads.FindActiveByCode(ctx, "AB12")
+		if err != nil || found == nil || found.ID != thread.ID {
+			t.Fatalf("FindActiveByCode = %+v, %v, want the thread", found, err)
+		}
+
+		acked, err := store.Threads.Transition(ctx, thread.ID, []string{ThreadStatusOpen}, ThreadStatusAcknowledged, "staff0101", now)
+		if err != nil || acked == nil {
+			t.Fatalf("Transition = %+v, %v", acked, err)
+		}
+		if acked.AcknowledgedBy != "staff0101" || acked.AcknowledgedAt == nil || len(acked.Transitions) != 1 {
+			t.Errorf("acknowledged thread = %+v", acked)
+		}
+
+		again, err := store.Threads.Transition(ctx, thread.ID, []string{ThreadStatusOpen}, ThreadStatusAcknowledged, "staff0102", now)
+		if err != nil || again != nil {
+			t.Errorf("second Transition = %+v, %v, want nil", again, err)
+		}
+
+		closed, err := store.Threads.CloseInactive(ctx, now.Add(time.Hour), "system", now)
+		if err != nil || closed == nil || closed.Status != ThreadStatusClosed {
+			t.Fatalf("CloseInactive = %+v, %v, want the thread closed", closed, err)
+		}
+		last, err := store.Threads.FindLastClosed(ctx, thread.PhoneNumber)
+		if err != nil || last == nil || last.ClosedBy != "system" || len(last.Transitions) != 2 {
+			t.Errorf("FindLastClosed = %+v, %v", last, err)
+		}
+
+		active, err := store.Threads.ListActive(ctx)
+		if err != nil || len(active) != 0 {
+			t.Errorf("ListActive = %+v, %v, want none", active, err)
+		}
+
+		// A closed thread no longer blocks a new one.
+		if err := store.Threads.Insert(ctx, duplicate); err != nil {
+			t.Errorf("Insert after close = %v", err)
+		}
+	})
+}
+
+func TestStoreThreadClaims(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		thread := addThread(t, store, "+14155550123", "AB12")
+		now := time.Now().Truncate(time.Millisecond)
+		due := now.Add(-time.Minute)
+
+		if err := store.Threads.SetEscalation(ctx, thread.ID, 1, &due); err != nil {
+			t.Fatal(err)
+		}
+		claimed, err := store.Threads.ClaimDueEscalation(ctx, now)
+		if err != nil || claimed == nil || claimed.NextEscalationAt == nil || !claimed.NextEscalationAt.Equal(due) {
+			t.Fatalf("ClaimDueEscalation = %+v, %v, want the thread as it was", claimed, err)
+		}
+		if claimed, err = store.Threads.ClaimDueEscalation(ctx, now); err != nil || claimed != nil {
+			t.Errorf("second ClaimDueEscalation = %+v, %v, want nil", claimed, err)
+		}
+
+		if err := store.Threads.Assign(ctx, thread.ID, "staff0101", due); err != nil {
+			t.Fatal(err)
+		}
+		claimed, err = store.Threads.ClaimDueGroupAlert(ctx, now)
+		if err != nil || claimed == nil || claimed.GroupAlertAt != nil || claimed.AssignedTo != "staff0101" {
+			t.Fatalf("ClaimDueGroupAlert = %+v, %v, want the claimed thread", claimed, err)
+		}
+		if claimed, err = store.Threads.ClaimDueGroupAlert(ctx, now); err != nil || claimed != nil {
+			t.Errorf("second ClaimDueGroupAlert = %+v, %v, want nil", claimed, err)
+		}
+	})
+}
+
+func TestStoreVoicemails(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		thread := addThread(t, store, "+14155550123", "AB12")
+
+		// The transcription callback can arrive before the recording.
+		if err := store.Threads.SaveTranscription(ctx, thread.ID, "RE1", "completed", "A tree fell"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Threads.SaveVoicemail(ctx, thread.ID, Voicemail{CallSid: "CA1", RecordingSid: "RE1", DurationSeconds: 12}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Threads.FindByID(ctx, thread.ID)
+		if err != nil || got == nil || len(got.Voicemails) != 1 {
+			t.Fatalf("thread = %+v, %v, want one voicemail", got, err)
+		}
+		if v := got.Voicemails[0]; v.CallSid != "CA1" || v.DurationSeconds != 12 || v.Transcription != "A tree fell" {
+			t.Errorf("voicemail = %+v, want recording and transcript merged", v)
+		}
+
+		err = store.Threads.SaveVoicemail(ctx, bson.NewObjectID(), Voicemail{RecordingSid: "RE2"})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("SaveVoicemail on a missing thread = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreBlockList(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Millisecond)
+		expired := now.Add(-time.Hour)
+
+		first, err := store.BlockList.Upsert(ctx, BlockedNumber{PhoneNumber: "+14155550123", CreatedAt: now.Add(-time.Minute), Reason: "spam"})
+		if err != nil || first == nil || first.ID.IsZero() {
+			t.Fatalf("Upsert = %+v, %v", first, err)
+		}
+		if _, err := store.BlockList.Upsert(ctx, BlockedNumber{PhoneNumber: "+14155550124", CreatedAt: now, ExpiresAt: &expired}); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err := store.BlockList.Upsert(ctx, BlockedNumber{PhoneNumber: "+14155550123", CreatedAt: now, Reason: "abuse"})
+		if err != nil || updated.ID != first.ID || updated.Reason != "abuse" {
+			t.Errorf("second Upsert = %+v, %v, want the entry replaced in place", updated, err)
+		}
+
+		blocked, err := store.BlockList.IsBlocked(ctx, "+14155550124", now)
+		if err != nil || blocked {
+			t.Errorf("IsBlocked after expiry = %v, %v, want false", blocked, err)
+		}
+
+		items, total, err := store.BlockList.List(ctx, true, now, 0, 1)
+		if err != nil || total != 2 || len(items) != 1 {
+			t.Fatalf("List = %+v, %d, %v, want one of two entries", items, total, err)
+		}
+		_, total, err = store.BlockList.List(ctx, false, now, 0, 10)
+		if err != nil || total != 1 {
+			t.Errorf("List without expired total = %d, %v, want 1", total, err)
+		}
+	})
+}
+
+func TestStoreSchedules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		schedules := []Schedule{
+			{ID: bson.NewObjectID(), PhoneNumber: "+15105550101", Always: true},
+			{ID: bson.NewObjectID(), PhoneNumber: "+15105550102", Recurring: true, DayOfWeek: 2, StartTime: "09:00", EndTime: "17:00"},
+			{ID: bson.NewObjectID(), PhoneNumber: "+15105550103", Date: "2026-03-01", StartTime: "09:00", EndTime: "17:00", Tier: 2},
+		}
+		for _, schedule := range schedules {
+			if err := store.Schedules.Insert(ctx, schedule); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		candidates, err := store.Schedules.FindCandidates(ctx, []int{2}, nil)
+		if err != nil || len(candidates) != 2 {
+			t.Errorf("FindCandidates by day = %+v, %v, want the always and recurring entries", candidates, err)
+		}
+		candidates, err = store.Schedules.FindCandidates(ctx, nil, []string{"2026-03-01"})
+		if err != nil || len(candidates) != 2 {
+			t.Errorf("FindCandidates by date = %+v, %v, want the always and dated entries", candidates, err)
+		}
+
+		if err := store.Schedules.ChangePhoneNumber(ctx, "+15105550103", "+15105550104"); err != nil {
+			t.Fatal(err)
+		}
+		moved, err := store.Schedules.List(ctx, "+15105550104")
+		if err != nil || len(moved) != 1 || moved[0].Tier != 2 {
+			t.Errorf("List = %+v, %v, want the moved entry", moved, err)
+		}
+
+		replaced, err := store.Schedules.Replace(ctx, Schedule{ID: bson.NewObjectID(), PhoneNumber: "+15105550101"})
+		if err != nil || replaced {
+			t.Errorf("Replace of unknown entry = %v, %v, want false", replaced, err)
+		}
+
+		if err := store.Schedules.DeleteByPhoneNumber(ctx, "+15105550104"); err != nil {
+			t.Fatal(err)
+		}
+		if count, err := store.Schedules.Count(ctx); err != nil || count != 2 {
+			t.Errorf("Count after DeleteByPhoneNumber = %d, %v, want 2", count, err)
+		}
+	})
+}
+
+func TestStoreConfig(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		if got, err := store.Config.Get(ctx, "outbound_number"); err != nil || got != "" {
+			t.Errorf("Get of unset key = %q, %v, want empty", got, err)
+		}
+		for _, value := range []string{"+15105550001", testOutboundNumber} {
+			if err := store.Config.Set(ctx, "outbound_number", value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got, err := store.Config.Get(ctx, "outbound_number"); err != nil || got != testOutboundNumber {
+			t.Errorf("Get = %q, %v, want the last value set", got, err)
+		}
+
+		steps := []struct {
+			old, value string
+			want       bool
+		}{
+			{"", "a", true},
+			{"", "b", false},
+			{"b", "c", false},
+			{"a", "b", true},
+		}
+		for _, step := range steps {
+			if got, err := store.Config.CompareAndSet(ctx, "cursor", step.old, step.value); err != nil || got != step.want {
+				t.Errorf("CompareAndSet(%q, %q) = %v, %v, want %v", step.old, step.value, got, err, step.want)
+			}
+		}
+		if got, err := store.Config.Get(ctx, "cursor"); err != nil || got != "b" {
+			t.Errorf("Get after CompareAndSet = %q, %v, want b", got, err)
+		}
+
+		menu := &VoiceMenu{Prompt: "Press 1", Options: []VoiceMenuOption{{Digit: "1", Action: "DIAL"}}}
+		if err := store.Config.SetVoiceMenu(ctx, menu); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Config.VoiceMenu(ctx)
+		if err != nil || got == nil || got.Prompt != "Press 1" || len(got.Options) != 1 {
+			t.Errorf("VoiceMenu = %+v, %v", got, err)
+		}
+		if deleted, err := store.Config.DeleteVoiceMenu(ctx); err != nil || !deleted {
+			t.Errorf("DeleteVoiceMenu = %v, %v, want true", deleted, err)
+		}
+	})
+}
+
+func TestStoreMessagesAndDeliveries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		threadID := bson.NewObjectID()
+		now := time.Now().Truncate(time.Millisecond)
+
+		for _, body := range []string{"first", "second"} {
+			if err := store.Messages.Insert(ctx, Message{ID: bson.NewObjectID(), ThreadID: threadID, Kind: "staff_reply", Body: body, CreatedAt: now}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		last, err := store.Messages.FindLast(ctx, threadID, "staff_reply")
+		if err != nil || last == nil || last.Body != "second" {
+			t.Errorf("FindLast = %+v, %v, want the second message", last, err)
+		}
+
+		delivery := WebhookDelivery{ID: bson.NewObjectID(), EventID: "evt-1", Status: DeliveryStatusPending, NextAttemptAt: now, CreatedAt: now, UpdatedAt: now}
+		if err := store.WebhookDeliveries.Insert(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		claimed, err := store.WebhookDeliveries.ClaimDue(ctx, now, now.Add(time.Minute))
+		if err != nil || claimed == nil || claimed.ID != delivery.ID {
+			t.Fatalf("ClaimDue = %+v, %v, want the delivery", claimed, err)
+		}
+		if again, err := store.WebhookDeliveries.ClaimDue(ctx, now, now.Add(time.Minute)); err != nil || again != nil {
+			t.Errorf("ClaimDue while leased = %+v, %v, want nil", again, err)
+		}
+
+		claimed.Status = DeliveryStatusPending
+		claimed.Attempts = 1
+		claimed.NextAttemptAt = now
+		if err := store.WebhookDeliveries.RecordAttempt(ctx, *claimed, DeliveryAttempt{At: now, StatusCode: 500}); err != nil {
+			t.Fatal(err)
+		}
+		retried, err := store.WebhookDeliveries.ClaimDue(ctx, now, now.Add(time.Minute))
+		if err != nil || retried == nil || retried.Attempts != 1 || len(retried.History) != 1 || retried.History[0].StatusCode != 500 {
+			t.Errorf("ClaimDue after a failed attempt = %+v, %v, want the attempt recorded", retried, err)
+		}
+	})
+}
+
+func TestStoreEscalation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		if policy, err := store.Escalation.Get(ctx); err != nil || policy != nil {
+			t.Errorf("Get before Save = %+v, %v, want nil", policy, err)
+		}
+
+		first, err := store.Escalation.Save(ctx, EscalationPolicy{Tiers: []EscalationTier{{Target: "ON_CALL", TimeoutSeconds: 30}}, UpdatedAt: time.Now()})
+		if err != nil || first == nil || first.Name != DefaultEscalationPolicy {
+			t.Fatalf("Save = %+v, %v", first, err)
+		}
+		second, err := store.Escalation.Save(ctx, EscalationPolicy{Tiers: []EscalationTier{{Target: "ALL_ACTIVE", TimeoutSeconds: 20}}, UpdatedAt: time.Now()})
+		if err != nil || second.ID != first.ID || len(second.Tiers) != 1 || second.Tiers[0].Target != "ALL_ACTIVE" {
+			t.Errorf("second Save = %+v, %v, want the policy replaced in place", second, err)
+		}
+
+		if deleted, err := store.Escalation.Delete(ctx); err != nil || !deleted {
+			t.Errorf("Delete = %v, %v, want true", deleted, err)
+		}
+	})
+}
+
+func TestSQLMigrationClosesDuplicateActiveThreads(t *testing.T) {
+	ctx := context.Background()
+	driverName, dataSourceName, err := sqlDriver("sqlite://" + filepath.Join(t.TempDir(), "relay.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetMaxOpenConns(1)
+	db := &sqlDB{DB: conn}
+
+	// Create the tables as they were before the unique active thread index.
+	if _, err := db.ExecContext(ctx, "CREATE TABLE schema_migrations (version TEXT PRIMARY KEY, applied_at BIGINT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	script, err := sqlMigrations.ReadFile("migrations/0001_create_tables.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.applyMigration(ctx, "0001_create_tables", string(script)); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newSQLStore(db)
+	older := addThread(t, store, "+14155550123", "AB12")
+	newer := older
+	newer.ID = bson.NewObjectID()
+	newer.Code = "CD34"
+	newer.CreatedAt = older.CreatedAt.Add(time.Minute)
+	if err := store.Threads.Insert(ctx, newer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.migrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	closed, err := store.Threads.FindLastClosed(ctx, older.PhoneNumber)
+	if err != nil || closed == nil || closed.ID != older.ID {
+		t.Fatalf("FindLastClosed = %+v, %v, want the older thread", closed, err)
+	}
+	if closed.ClosedBy != migrationActor || closed.ClosedAt == nil || len(closed.Transitions) != 1 || closed.Transitions[0].By != migrationActor {
+		t.Errorf("closed thread = %+v, want closed by %s with a transition", closed, migrationActor)
+	}
+
+	active, err := store.Threads.FindActiveByPhoneNumber(ctx, older.PhoneNumber)
+	if err != nil || active == nil || active.ID != newer.ID {
+		t.Errorf("active thread = %+v, %v, want the newer thread", active, err)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrDuplicate is returned when a write would give two records a value that
+// must be unique, such as a staff phone number.
+var ErrDuplicate = errors.New("duplicate record")
+
+// ErrNotFound is returned when a write targets a record that does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// migrationActor is recorded as who closed the threads a data migration
+// closes, in both the MongoDB and SQL stores.
+const migrationActor = "system:migration"
+
+// Store holds the repositories the service reads and writes. Lookups of a
+// single record return nil, not an error, when nothing matches.
+type Store struct {
+	Staff             StaffRepository
+	Threads           ThreadRepository
+	BlockList         BlockListRepository
+	Schedules         ScheduleRepository
+	Config            ConfigRepository
+	Messages          MessageRepository
+	WebhookDeliveries WebhookDeliveryRepository
+	Escalation        EscalationPolicyRepository
+}
+
+// StaffRepository stores staff members.
+type StaffRepository interface {
+	// List returns every staff member by phone number.
+	List(ctx context.Context) ([]Staff, error)
+	ListActive(ctx context.Context) ([]Staff, error)
+	// ListWithoutPublicID returns staff created before public IDs existed.
+	ListWithoutPublicID(ctx context.Context) ([]Staff, error)
+	FindByPhoneNumber(ctx context.Context, phoneNumber string) (*Staff, error)
+	FindByPhoneNumbers(ctx context.Context, phoneNumbers []string) ([]Staff, error)
+	FindByPublicID(ctx context.Context, publicID string) (*Staff, error)
+	FindByPublicIDs(ctx context.Context, publicIDs []string) ([]Staff, error)
+	// PhoneNumberTaken reports whether a staff member other than exceptID
+	// has phoneNumber. A zero exceptID matches any staff member.
+	PhoneNumberTaken(ctx context.Context, phoneNumber string, exceptID bson.ObjectID) (bool, error)
+	// Insert adds a staff member. It returns ErrDuplicate if the phone
+	// number is taken.
+	Insert(ctx context.Context, staff Staff) error
+	// Update saves the phone number, active flag, email and channels of a
+	// staff member. It returns ErrDuplicate if the phone number is taken.
+	Update(ctx context.Context, staff Staff) error
+	SetActive(ctx context.Context, id bson.ObjectID, active bool) error
+	SetPublicID(ctx context.Context, id bson.ObjectID, publicID string) error
+	// MarkAlerted records when staff were last alerted.
+	MarkAlerted(ctx context.Context, ids []bson.ObjectID, at time.Time) error
+	// Delete removes a staff member and reports whether one existed.
+	Delete(ctx context.Context, publicID string) (bool, error)
+}
+
+// ThreadRepository stores conversation threads. Active threads are OPEN or
+// ACKNOWLEDGED.
+type ThreadRepository interface {
+	FindByID(ctx context.Context, id bson.ObjectID) (*Thread, error)
+	FindActiveByPhoneNumber(ctx context.Context, phoneNumber string) (*Thread, error)
+	FindActiveByCode(ctx context.Context, code string) (*Thread, error)
+	// FindLastClosed returns the most recently created closed thread for a
+	// phone number.
+	FindLastClosed(ctx context.Context, phoneNumber string) (*Thread, error)
+	// ListActive returns every active thread, oldest first.
+	ListActive(ctx context.Context) ([]Thread, error)
+	// Insert adds a thread. It returns ErrDuplicate if the thread is active
+	// and its reporter already has an active thread.
+	Insert(ctx context.Context, thread Thread) error
+	SetCode(ctx context.Context, id bson.ObjectID, code string) error
+	// Touch records activity on a thread.
+	Touch(ctx context.Context, id bson.ObjectID, now time.Time) error
+	// Transition moves a thread to status to if it is in one of the from
+	// statuses, and returns the updated thread or nil if it was not.
+	Transition(ctx context.Context, id bson.ObjectID, from []string, to string, by string, now time.Time) (*Thread, error)
+	// CloseInactive closes one active thread with no activity since cutoff
+	// and returns it, or nil if there is none.
+	CloseInactive(ctx context.Context, cutoff time.Time, by string, now time.Time) (*Thread, error)
+	// SetEscalation records the escalation tier a thread reached and when
+	// the next tier is due. A nil next means no tier is left.
+	SetEscalation(ctx context.Context, id bson.ObjectID, tier int, next *time.Time) error
+	// ClaimDueEscalation clears the due time of one OPEN thread whose next
+	// escalation is due and returns it, or nil if there is none.
+	ClaimDueEscalation(ctx context.Context, now time.Time) (*Thread, error)
+	// Assign gives a thread to one staff member until groupAlertAt.
+	Assign(ctx context.Context, id bson.ObjectID, publicID string, groupAlertAt time.Time) error
+	// ClaimDueGroupAlert clears the group alert time of one OPEN thread
+	// whose group alert is due and returns it, or nil if there is none.
+	ClaimDueGroupAlert(ctx context.Context, now time.Time) (*Thread, error)
+	// SaveVoicemail adds a recording to a thread, or updates the recording
+	// with the same RecordingSid. It returns ErrNotFound if the thread does
+	// not exist.
+	SaveVoicemail(ctx context.Context, id bson.ObjectID, voicemail Voicemail) error
+	// SaveTranscription stores the transcript of a recording, adding the
+	// recording if it has not been saved yet.
+	SaveTranscription(ctx context.Context, id bson.ObjectID, recordingSid string, status string, text string) error
+}
+
+// BlockListRepository stores blocked phone numbers.
+type BlockListRepository interface {
+	// IsBlocked reports whether a phone number has an unexpired entry.
+	IsBlocked(ctx context.Context, phoneNumber string, now time.Time) (bool, error)
+	// Upsert adds an entry, replacing any existing entry for its phone
+	// number, and returns the stored entry.
+	Upsert(ctx context.Context, blocked BlockedNumber) (*BlockedNumber, error)
+	// List returns a page of entries, newest first, with the total count.
+	// Expired entries are left out unless includeExpired is set.
+	List(ctx context.Context, includeExpired bool, now time.Time, skip int64, limit int64) ([]BlockedNumber, int64, error)
+	// Delete removes every entry for a phone number and reports whether
+	// there was one.
+	Delete(ctx context.Context, phoneNumber string) (bool, error)
+}
+
+// ScheduleRepository stores on-call schedule entries.
+type ScheduleRepository interface {
+	Count(ctx context.Context) (int64, error)
+	// List returns the entries for a phone number, or every entry if it is
+	// empty, by phone number, day of week and start time.
+	List(ctx context.Context, phoneNumber string) ([]Schedule, error)
+	// FindCandidates returns the entries that are always on, recur on one
+	// of daysOfWeek, or fall on one of dates (YYYY-MM-DD).
+	FindCandidates(ctx context.Context, daysOfWeek []int, dates []string) ([]Schedule, error)
+	FindByID(ctx context.Context, id bson.ObjectID) (*Schedule, error)
+	Insert(ctx context.Context, schedule Schedule) error
+	// Replace saves an entry and reports whether it existed.
+	Replace(ctx context.Context, schedule Schedule) (bool, error)
+	// Delete removes an entry and reports whether it existed.
+	Delete(ctx context.Context, id bson.ObjectID) (bool, error)
+	// ChangePhoneNumber moves every entry for one phone number to another.
+	ChangePhoneNumber(ctx context.Context, from string, to string) error
+	// DeleteByPhoneNumber removes every entry for a phone number.
+	DeleteByPhoneNumber(ctx context.Context, phoneNumber string) error
+}
+
+// ConfigRepository stores service settings.
+type ConfigRepository interface {
+	// Get returns a setting, or "" if it is not set.
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string) error
+	// CompareAndSet sets a setting only if it still holds old, where ""
+	// means unset, and reports whether it did.
+	CompareAndSet(ctx context.Context, key string, old string, value string) (bool, error)
+	// VoiceMenu returns the voice menu, or nil if none is configured.
+	VoiceMenu(ctx context.Context) (*VoiceMenu, error)
+	SetVoiceMenu(ctx context.Context, menu *VoiceMenu) error
+	// DeleteVoiceMenu removes the voice menu and reports whether there was
+	// one.
+	DeleteVoiceMenu(ctx context.Context) (bool, error)
+}
+
+// MessageRepository stores the messages and calls of each thread.
+type MessageRepository interface {
+	Insert(ctx context.Context, message Message) error
+	// FindLast returns the most recent message of a kind on a thread.
+	FindLast(ctx context.Context, threadID bson.ObjectID, kind string) (*Message, error)
+}
+
+// WebhookDeliveryRepository stores event webhook deliveries.
+type WebhookDeliveryRepository interface {
+	Insert(ctx context.Context, delivery WebhookDelivery) error
+	// ClaimDue leases the pending delivery that has been due longest until
+	// leaseUntil and returns it, or nil if none is due.
+	ClaimDue(ctx context.Context, now time.Time, leaseUntil time.Time) (*WebhookDelivery, error)
+	// RecordAttempt saves the status, attempts, next attempt time, last
+	// error and update time of a delivery and adds attempt to its history.
+	RecordAttempt(ctx context.Context, delivery WebhookDelivery, attempt DeliveryAttempt) error
+}
+
+// EscalationPolicyRepository stores the escalation policy.
+type EscalationPolicyRepository interface {
+	// Get returns the policy, or nil if none is configured.
+	Get(ctx context.Context) (*EscalationPolicy, error)
+	// Save replaces the policy and returns it as stored.
+	Save(ctx context.Context, policy EscalationPolicy) (*EscalationPolicy, error)
+	// Delete removes the policy and reports whether there was one.
+	Delete(ctx context.Context) (bool, error)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	testInboundNumber  = "+15105550100"
+	testOutboundNumber = "+15105550199"
+)
+
+func newSQLiteStore(t *testing.T, file string) Store {
+	t.Helper()
+
+	store, db, err := OpenSQLStore(context.Background(), "sqlite://"+file)
+	if err != nil {
+		t.Fatalf("OpenSQLStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return store
+}
+
+// forEachStore runs a test against the in-memory store and a SQLite store,
+// so both behave the same way the handlers expect.
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryStore()) })
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newSQLiteStore(t, filepath.Join(t.TempDir(), "relay.db")))
+	})
+}
+
+// addStaff stores a staff member and returns it.
+func addStaff(t *testing.T, store Store, phoneNumber string, active bool) Staff {
+	t.Helper()
+
+	staff := Staff{ID: bson.NewObjectID(), PublicID: "staff" + phoneNumber[len(phoneNumber)-4:], PhoneNumber: phoneNumber, Active: active}
+	if err := store.Staff.Insert(context.Background(), staff); err != nil {
+		t.Fatal(err)
+	}
+	return staff
+}
+
+// addThread stores an open thread for a reporter and returns it.
+func addThread(t *testing.T, store Store, phoneNumber string, code string) Thread {
+	t.Helper()
+
+	now := time.Now()
+	thread := Thread{
+		ID:             bson.NewObjectID(),
+		PhoneNumber:    phoneNumber,
+		Code:           code,
+		Status:         ThreadStatusOpen,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		LastActivityAt: now,
+	}
+	if err := store.Threads.Insert(context.Background(), thread); err != nil {
+		t.Fatal(err)
+	}
+	return thread
+}
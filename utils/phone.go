@@ -0,0 +1,16 @@
+package utils
+
+// IsValidPhoneNumber reports whether s is an E.164 phone number, e.g. +15105550123
+func IsValidPhoneNumber(s string) bool {
+	if len(s) < 8 || len(s) > 16 || s[0] != '+' || s[1] == '0' {
+		return false
+	}
+
+	for i := 1; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}